@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/database/mod"
@@ -24,7 +25,13 @@ import (
 	"github.com/mokasin/musicrawler/lib/source"
 	"github.com/mokasin/musicrawler/model/album"
 	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/book"
+	"github.com/mokasin/musicrawler/model/genre"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/scan"
 	"github.com/mokasin/musicrawler/model/track"
+	"time"
 )
 
 // define databse actions
@@ -32,29 +39,43 @@ const (
 	TRACK_NOUPDATE = iota
 	TRACK_UPDATE
 	TRACK_ADD
+	TRACK_SKIP
 )
 
 type trackMtime struct {
 	ID    int   `column:"ID" set:"0"`
 	Mtime int64 `column:"filemtime"`
+	Added int64 `column:"added"`
 }
 
 type trackDBMtime struct {
 	DBMtime int64 `column:"dbmtime"`
 }
 
-// Holds information of how the track at path was handeled. If the transaction
-// was successfully err is nil.
+type trackFingerprint struct {
+	ID          int    `column:"ID" set:"0"`
+	Added       int64  `column:"added"`
+	Fingerprint string `column:"fingerprint"`
+}
+
+// Holds information of how the track at path was handeled. The path is the
+// location of the track given by source.Location. If the transaction was
+// successfully err is nil. A path that couldn't be crawled is reported with
+// action TRACK_SKIP and the crawl error.
 type UpdateStatus struct {
 	Path   string
 	Action uint8
 	Err    error
 }
 
-// Holds information if the operation was successful.
+// Holds information if the operation was successful. Moved tracks are reported
+// as added by UpdateStatus. Skipped are the locations that couldn't be crawled.
 type UpdateResult struct {
-	Deleted int64
-	Err     error
+	Deleted   int64
+	Moved     int64
+	Skipped   []string
+	Cancelled bool
+	Err       error
 }
 
 // Update is a wrapper for update method, that should be called when using in a
@@ -62,18 +83,39 @@ type UpdateResult struct {
 //
 // It makes sure everything is cleaned up nicely before the signal gets emmitted
 // to prevent racing conditions when closing the database connection.
-func UpdateDatabase(db *database.Database, tracks <-chan source.TrackInfo,
+func UpdateDatabase(ctx context.Context, db *database.Database,
+	roots []string, libraries map[string]string,
+	tracks <-chan source.TrackInfo,
 	status chan<- *UpdateStatus, result chan<- *UpdateResult) {
 	// signal is emitted, not untils index.Update() has cleaned up everything
-	result <- updateDatabase(db, tracks, status)
+	result <- updateDatabase(ctx, db, roots, libraries, tracks, status)
 }
 
+// number of new tracks that are collected before inserting them at once
+const insertBatchSize = 256
+
+// interval the changes are committed in, so the database isn't locked for the
+// whole update
+const commitInterval = time.Second
+
 // Updates or adds tracks that are received at the tracks channel.
 //
 // For every track a status update UpdateStatus is emitted to the status
 // channel. If the method finishes, the overall result is emitted on the result
 // channel.
-func updateDatabase(db *database.Database, tracks <-chan source.TrackInfo,
+//
+// The result and the errors are saved as scan of the sources with the given
+// roots. The tracks are added to the libraries named by libraries for their
+// sources, missing libraries are added. Tracks of other sources belong to the
+// default library.
+//
+// The changes are committed every commitInterval. If ctx is cancelled, the
+// remaining tracks are ignored and the changes made so far are committed.
+// Tracks that weren't seen are kept then, as they may still exist. Unless ctx
+// was cancelled by context.Canceled, its cause is returned as error.
+func updateDatabase(ctx context.Context, db *database.Database,
+	roots []string, libraries map[string]string,
+	tracks <-chan source.TrackInfo,
 	status chan<- *UpdateStatus) *UpdateResult {
 
 	err := db.BeginTransaction()
@@ -83,118 +125,197 @@ func updateDatabase(db *database.Database, tracks <-chan source.TrackInfo,
 	}
 	defer db.EndTransaction()
 
-	var trackAction uint8
-
-	tm := &trackMtime{}
-
-	martists := mod.New(db, "artist")
 	malbums := mod.New(db, "album")
 	mtracks := mod.New(db, "track")
 
-	// traverse all catched pathes and update or add database entries
-	for ti := range tracks {
-		var statusErr error
+	sc, err := scan.Start(db, roots)
+	if err != nil {
+		close(status)
+		return &UpdateResult{Err: err}
+	}
 
-		trackAction = TRACK_NOUPDATE
+	// the articles may have changed since the last update
+	if err := artist.DeriveSortNames(db); err != nil {
+		close(status)
+		return &UpdateResult{Err: err}
+	}
+
+	defaultID, err := library.Ensure(db, library.Default)
+	if err != nil {
+		close(status)
+		return &UpdateResult{Err: err}
+	}
+
+	// IDs of the libraries by the sources of their tracks
+	libraryIDs := make(map[string]int64)
+	for root, name := range libraries {
+		if libraryIDs[root], err = library.Ensure(db, name); err != nil {
+			close(status)
+			return &UpdateResult{Err: err}
+		}
+	}
+
+	// libraryID returns the ID of the library of the tracks of src
+	libraryID := func(src string) int64 {
+		if id, ok := libraryIDs[src]; ok {
+			return id
+		}
+
+		return defaultID
+	}
+
+	// emit sends s to the status channel and counts it for the scan result
+	emit := func(s *UpdateStatus) {
+		if s.Action == TRACK_SKIP {
+			sc.Skipped++
+		}
 
-		// check if mtime has changed and decide what to do
-		err := query.New(db, "track").Where("path =", ti.Path()).Exec(tm)
 		switch {
-		case err == nil: // track is in database
-			// check if track has changed since the last time
-			if ti.Mtime() != tm.Mtime {
-				trackAction = TRACK_UPDATE
+		case s.Err != nil:
+			// the error is still reported by the status, if it can't be
+			// saved
+			sc.AddError(db, s.Path, s.Err)
+		case s.Action == TRACK_ADD:
+			sc.Added++
+		case s.Action == TRACK_UPDATE:
+			sc.Updated++
+		}
 
-			} else {
-				tdbm := &trackDBMtime{db.Mtime()}
-				statusErr = mtracks.Update(tm.ID, tdbm)
-			}
-		case err == sql.ErrNoRows: // track is not in database
-			trackAction = TRACK_ADD
-			tag, err := ti.Tags()
-			if err != nil {
-				statusErr = err
-				break
-			}
+		status <- s
+	}
 
-			artist := &artist.Artist{
-				Name: tag.Artist,
-			}
+	// new tracks are collected and inserted in batches
+	var batch []*track.RawTrack
+	batchPaths := make(map[string]bool)
 
-			res, err := martists.InsertIgnore(artist)
+	flush := func() {
+		_, err := mtracks.InsertAll(batch)
+
+		for _, t := range batch {
+			// a failed batch is inserted track by track to find the
+			// tracks that can't be inserted. Without journal, tracks of the
+			// failed statement may have been inserted already.
+			var insertErr error
 			if err != nil {
-				statusErr = err
-				break
+				var n int
+				n, insertErr = query.New(db, "track").
+					Where("source =", t.Source).
+					Where("path =", t.Path).
+					Count()
+				if insertErr == nil && n == 0 {
+					_, insertErr = mtracks.Insert(t)
+				}
 			}
 
-			aff, _ := res.RowsAffected()
+			emit(&UpdateStatus{
+				Path:   source.Location(t.Source, t.Path),
+				Action: TRACK_ADD,
+				Err:    insertErr})
+		}
 
-			var artist_id int64
+		batch = batch[:0]
+		batchPaths = make(map[string]bool)
+	}
 
-			// if entry exists
-			if aff == 0 {
-				err = query.New(db, "artist").
-					Where("name =", tag.Artist).Limit(1).Exec(artist)
-				if err != nil {
-					statusErr = err
-					break
-				}
+	var skipped []string
 
-				artist_id = artist.Id
-			} else {
-				artist_id, _ = res.LastInsertId()
-			}
+	// a failed commit stops the update like a cancellation
+	var commitErr error
+	committed := time.Now()
 
-			album := &album.Album{
-				Name:     tag.Album,
-				ArtistID: artist_id,
-			}
+	// traverse all catched pathes and update or add database entries
+	for ti := range tracks {
+		// the channel is drained, so the crawlers can finish
+		if ctx.Err() != nil || commitErr != nil {
+			continue
+		}
 
-			res, err = malbums.InsertIgnore(album)
-			if err != nil {
+		if time.Since(committed) >= commitInterval {
+			flush()
+			commitErr = db.Checkpoint()
+			committed = time.Now()
+		}
+
+		location := source.Location(ti.Source(), ti.Path())
+
+		if ce, ok := ti.(*source.CrawlError); ok {
+			skipped = append(skipped, location)
+
+			// the tracks below a skipped path may still exist
+			statusErr := ce.Err
+			if err := track.Touch(db, ce.Source(), ce.Path()); err != nil {
 				statusErr = err
-				break
 			}
 
-			aff, _ = res.RowsAffected()
+			emit(&UpdateStatus{
+				Path:   location,
+				Action: TRACK_SKIP,
+				Err:    statusErr})
+			continue
+		}
+
+		var statusErr error
+
+		trackAction := uint8(TRACK_NOUPDATE)
+		tm := &trackMtime{}
 
-			var album_id int64
+		// check if mtime has changed and decide what to do
+		err := query.New(db, "track").
+			Where("source =", ti.Source()).
+			Where("path =", ti.Path()).
+			Exec(tm)
+		switch {
+		case err == nil: // track is in database
+			// check if track has changed since the last time
+			if ti.Mtime() != tm.Mtime {
+				trackAction = TRACK_UPDATE
+
+				rt, err := newRawTrack(db, malbums, ti,
+					libraryID(ti.Source()))
+				if err == nil {
+					rt.Added = tm.Added
+					var id int64
+					id, err = mtracks.Upsert(rt, "source", "path")
+					if err == nil {
+						// genres and books are linked again after the update
+						err = genre.Unlink(db, id)
+					}
+					if err == nil {
+						err = book.Unlink(db, id)
+					}
+				}
 
-			// if entry exists
-			if aff == 0 {
-				err = query.New(db, "album").
-					Where("name =", tag.Album).
-					Where("artist_id =", artist_id).
-					Limit(1).Exec(album)
 				if err != nil {
+					// keep the old entry, so it can be updated the next time
+					mtracks.Update(tm.ID, &trackDBMtime{db.Mtime()})
 					statusErr = err
-					break
 				}
-
-				album_id = album.Id
 			} else {
-				album_id, _ = res.LastInsertId()
+				statusErr = mtracks.Update(tm.ID, &trackDBMtime{db.Mtime()})
 			}
-
-			track := &track.RawTrack{
-				Path:        ti.Path(),
-				Title:       tag.Title,
-				Tracknumber: tag.Track,
-				Year:        tag.Year,
-				Length:      tag.Length,
-				Genre:       tag.Genre,
-				AlbumID:     album_id,
-				Filemtime:   ti.Mtime(),
-				DBMtime:     db.Mtime(),
+		case err == sql.ErrNoRows: // track is not in database
+			// the same root can be crawled twice
+			if batchPaths[location] {
+				break
 			}
 
-			_, err = mtracks.Insert(track)
+			rt, err := newRawTrack(db, malbums, ti,
+				libraryID(ti.Source()))
 			if err != nil {
+				trackAction = TRACK_ADD
 				statusErr = err
 				break
 			}
-			statusErr = nil
 
+			batch = append(batch, rt)
+			batchPaths[location] = true
+
+			if len(batch) >= insertBatchSize {
+				flush()
+			}
+
+			// status is emitted when the batch is inserted
+			continue
 		default:
 			// if something is wrong update timestamp, so track is not
 			// deleted the next time
@@ -203,42 +324,243 @@ func updateDatabase(db *database.Database, tracks <-chan source.TrackInfo,
 			statusErr = err
 		}
 
-		status <- &UpdateStatus{
-			Path:   ti.Path(),
+		emit(&UpdateStatus{
+			Path:   location,
 			Action: trackAction,
-			Err:    statusErr}
+			Err:    statusErr})
 	}
 
-	// clean up
-	del, err := deleteDanglingEntries(db)
+	if commitErr != nil {
+		close(status)
+		return &UpdateResult{Err: commitErr, Skipped: skipped}
+	}
+
+	// insert the remaining new tracks
+	flush()
+
+	cancelled := ctx.Err() != nil
+
+	var del, moved int64
+
+	// tracks are moved and deleted only if all tracks were seen
+	if !cancelled {
+		moved, err = moveTracks(db)
+
+		// clean up
+		if err == nil {
+			del, err = deleteDanglingEntries(db)
+		}
+	}
+	if err == nil {
+		err = genre.LinkTracks(db)
+	}
+	if err == nil {
+		err = book.LinkTracks(db)
+	}
+	if err == nil {
+		err = book.DeleteDangling(db)
+	}
+	if err == nil {
+		err = album.UpdateFromTracks(db)
+	}
+
+	// errors of the whole scan are saved without path
+	if err != nil {
+		sc.AddError(db, "", err)
+	}
+
+	if cancelled {
+		sc.Cancelled = 1
+
+		// a failed source cancels the update, too
+		if cause := context.Cause(ctx); cause != context.Canceled {
+			sc.AddError(db, "", cause)
+
+			if err == nil {
+				err = cause
+			}
+		}
+	}
+
+	if serr := finishScan(db, sc, moved, del); err == nil {
+		err = serr
+	}
 
 	close(status)
-	return &UpdateResult{Err: err, Deleted: del}
+	return &UpdateResult{Err: err, Deleted: del, Moved: moved,
+		Skipped: skipped, Cancelled: cancelled}
+}
+
+// finishScan completes the result of the scan sc and saves it. Moved tracks
+// were counted as added.
+func finishScan(db *database.Database, sc *scan.Scan, moved, deleted int64) error {
+	sc.Added -= moved
+	sc.Moved = moved
+	sc.Deleted = deleted
+
+	return sc.Finish(db)
+}
+
+// newRawTrack reads the tags of ti and returns a track entry referencing its
+// album and the library with the ID libraryID. Artist and album are added to
+// the database if they don't exist yet.
+func newRawTrack(db *database.Database, malbums *mod.Mod,
+	ti source.TrackInfo, libraryID int64) (*track.RawTrack, error) {
+
+	tag, err := ti.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	// a track without fingerprint is indexed anyway, it just isn't
+	// recognized when moved
+	fingerprint, err := ti.Fingerprint()
+	if err != nil {
+		fingerprint = ""
+	}
+
+	artistID, err := artist.Upsert(db, artist.New(tag.Artist, tag.ArtistSort))
+	if err != nil {
+		return nil, err
+	}
+
+	albumID, err := malbums.Upsert(
+		&album.Album{Name: tag.Album, ArtistID: artistID},
+		"name", "artist_id",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	chapters := make([]book.Chapter, len(tag.Chapters))
+	for i, c := range tag.Chapters {
+		chapters[i] = book.Chapter{Title: c.Title, Start: c.Start, End: c.End}
+	}
+
+	return &track.RawTrack{
+		Source:      ti.Source(),
+		Path:        ti.Path(),
+		Title:       tag.Title,
+		Tracknumber: tag.Track,
+		Year:        tag.Year,
+		Length:      tag.Length,
+		Genre:       tag.Genre,
+		Format:      track.Format(ti.Path()),
+		Bitrate:     tag.Bitrate,
+		Size:        ti.Size(),
+		Fingerprint: fingerprint,
+		AlbumID:     albumID,
+		LibraryID:   libraryID,
+		Chapters:    book.EncodeChapters(chapters),
+		Description: tag.Description,
+		Published:   tag.Published,
+		Added:       db.Mtime(),
+		Filemtime:   ti.Mtime(),
+		DBMtime:     db.Mtime(),
+	}, nil
+}
+
+// moveTracks recognizes tracks, that were moved since the last update. A track
+// added by this update takes over the entry of a track with the same
+// fingerprint, that wasn't found anymore. So the ID of a moved track and
+// everything referencing it is kept.
+//
+// Returns the number of moved tracks.
+func moveTracks(db *database.Database) (int64, error) {
+	var missing []trackFingerprint
+
+	err := query.New(db, "track").
+		Where("dbmtime <>", db.Mtime()).
+		Where("fingerprint <>", "").
+		Exec(&missing)
+	if err != nil || len(missing) == 0 {
+		return 0, err
+	}
+
+	old := make(map[string][]trackFingerprint)
+	for _, t := range missing {
+		old[t.Fingerprint] = append(old[t.Fingerprint], t)
+	}
+
+	var added []track.RawTrack
+
+	err = query.New(db, "track").
+		Where("added =", db.Mtime()).
+		Where("dbmtime =", db.Mtime()).
+		Where("fingerprint <>", "").
+		Exec(&added)
+	if err != nil {
+		return 0, err
+	}
+
+	mtracks := mod.New(db, "track")
+
+	var moved int64
+
+	for i := 0; i < len(added); i++ {
+		candidates := old[added[i].Fingerprint]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		o := candidates[0]
+		old[added[i].Fingerprint] = candidates[1:]
+
+		// the path is unique, so the new entry has to be deleted first
+		if err := mtracks.Delete(int(added[i].Id)); err != nil {
+			return moved, err
+		}
+
+		added[i].Added = o.Added
+		if err := mtracks.Update(o.ID, &added[i]); err != nil {
+			return moved, err
+		}
+
+		// genres and books are linked again after the update
+		if err := genre.Unlink(db, int64(o.ID)); err != nil {
+			return moved, err
+		}
+		if err := book.Unlink(db, int64(o.ID)); err != nil {
+			return moved, err
+		}
+
+		moved++
+	}
+
+	return moved, nil
 }
 
 // Deletes all entries that have an outdated timestamp dbmtime. Also cleans up
-// entries in Artist and Album table that are not referenced anymore in the
-// Track-table.
+// entries in Artist, Album and Genre table that are not referenced anymore in
+// the Track-table.
 //
 // Returns the number of deleted rows and an error.
 func deleteDanglingEntries(db *database.Database) (int64, error) {
-	r, err := db.Execute("DELETE FROM Track WHERE dbmtime <> ?", db.Mtime())
-	deletedTracks, _ := r.RowsAffected()
+	deletedTracks, err := mod.New(db, "track").DeleteWhere(
+		query.New(db, "track").Where("dbmtime <>", db.Mtime()))
 	if err != nil {
 		return deletedTracks, err
 	}
 
-	if _, err := db.Execute("DELETE FROM Album WHERE ID IN " +
-		"(SELECT Album.ID FROM Album LEFT JOIN Track ON " +
-		"Album.ID = Track.album_id WHERE Track.album_id " +
-		"IS NULL);"); err != nil {
+	if _, err := mod.New(db, "album").DeleteWhere(
+		query.New(db, "album").
+			LeftJoin("track", "album_id", "", "ID").
+			Where("track.album_id IS", nil)); err != nil {
+		return deletedTracks, err
+	}
+
+	if _, err := mod.New(db, "artist").DeleteWhere(
+		query.New(db, "artist").
+			LeftJoin("album", "artist_id", "", "ID").
+			Where("album.artist_id IS", nil)); err != nil {
+		return deletedTracks, err
+	}
+
+	if err := genre.DeleteDangling(db); err != nil {
 		return deletedTracks, err
 	}
 
-	if _, err := db.Execute("DELETE FROM Artist WHERE ID IN " +
-		"(SELECT Artist.ID FROM Artist LEFT JOIN Album ON " +
-		"Artist.ID = Album.artist_id WHERE Album.artist_id " +
-		"IS NULL);"); err != nil {
+	if err := play.DeleteDangling(db); err != nil {
 		return deletedTracks, err
 	}
 
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/source"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/book"
+	"github.com/mokasin/musicrawler/model/genre"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/playlist"
+	"github.com/mokasin/musicrawler/model/queue"
+	"github.com/mokasin/musicrawler/model/scan"
+	"github.com/mokasin/musicrawler/model/track"
+	"github.com/mokasin/musicrawler/model/user"
+	"github.com/mokasin/musicrawler/test"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDatabase creates an empty database with all tables in a temporary
+// directory.
+func newTestDatabase(tb testing.TB) (*database.Database, func()) {
+	dir, err := ioutil.TempDir("", "musicrawler")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	db, err := database.NewDatabase(filepath.Join(dir, "index.db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	db.Register(artist.CreateArtistTable)
+	db.Register(album.CreateAlbumTable)
+	db.Register(track.CreateTrackTable)
+	db.Register(genre.CreateGenreTable)
+	db.Register(library.CreateLibraryTable)
+	db.Register(book.CreateBookTable)
+	db.Register(user.CreateUserTable)
+	db.Register(play.CreatePlayTable)
+	db.Register(queue.CreateQueueTable)
+	db.Register(scan.CreateScanTable)
+	db.Register(playlist.CreatePlaylistTable)
+
+	if err := db.CreateDatabase(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// BenchmarkUpdateDatabase crawls test.TRACKNUMBER synthetic tracks into an
+// empty database.
+func BenchmarkUpdateDatabase(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db, cleanup := newTestDatabase(b)
+		sl := NewSourceList(db)
+		sl.Add(test.NewCrawler(test.TRACKNUMBER))
+
+		status := make(chan *UpdateStatus, 100)
+		result := make(chan *UpdateResult)
+		b.StartTimer()
+
+		go sl.Update(context.Background(), status, result)
+
+		for s := range status {
+			if s.Err != nil {
+				b.Fatal(s.Err)
+			}
+		}
+
+		if r := <-result; r.Err != nil {
+			b.Fatal(r.Err)
+		}
+
+		b.StopTimer()
+		cleanup()
+		b.StartTimer()
+	}
+}
+
+// movedInfo is a track with fixed tags and fingerprint.
+type movedInfo struct {
+	path, fingerprint string
+}
+
+func (self *movedInfo) Source() string               { return "moved" }
+func (self *movedInfo) Path() string                 { return self.path }
+func (self *movedInfo) Mtime() int64                 { return 1 }
+func (self *movedInfo) Size() int64                  { return 1 }
+func (self *movedInfo) Fingerprint() (string, error) { return self.fingerprint, nil }
+
+func (self *movedInfo) Tags() (*source.TrackTags, error) {
+	return &source.TrackTags{Title: self.fingerprint, Artist: "Artist",
+		Album: "Album", Genre: "Rock"}, nil
+}
+
+// movedSource emits its tracks.
+type movedSource []*movedInfo
+
+func (self movedSource) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	for _, t := range self {
+		tracks <- t
+	}
+
+	return nil
+}
+
+func (self movedSource) Root() string {
+	return "moved"
+}
+
+// trackIDs updates db with the tracks of src and returns the IDs of the tracks
+// by title.
+func trackIDs(t *testing.T, db *database.Database, src movedSource) map[string]int64 {
+	sl := NewSourceList(db)
+	sl.Add(src)
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	for s := range status {
+		if s.Err != nil {
+			t.Fatal(s.Err)
+		}
+	}
+
+	if r := <-result; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+
+	var tracks []track.RawTrack
+	if err := query.New(db, "track").Exec(&tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]int64)
+	for _, rt := range tracks {
+		ids[rt.Title] = rt.Id
+	}
+
+	return ids
+}
+
+func TestMoveTracks(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	before := trackIDs(t, db, movedSource{
+		{"a/1.mp3", "one"}, {"a/2.mp3", "two"}, {"a/3.mp3", "three"},
+	})
+
+	// the modification time of the database has a resolution of seconds
+	time.Sleep(1100 * time.Millisecond)
+
+	after := trackIDs(t, db, movedSource{
+		{"b/1.mp3", "one"}, {"a/2.mp3", "two"}, {"b/4.mp3", "four"},
+	})
+
+	if len(after) != 3 {
+		t.Fatalf("Want 3 tracks, got %v.", after)
+	}
+
+	for _, title := range []string{"one", "two"} {
+		if before[title] != after[title] {
+			t.Errorf("%s: ID changed from %d to %d.", title, before[title],
+				after[title])
+		}
+	}
+
+	if _, ok := after["three"]; ok {
+		t.Errorf("Deleted track is still there.")
+	}
+}
+
+// failingSource fails without emitting tracks.
+type failingSource struct{}
+
+func (self failingSource) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	return errors.New("broken")
+}
+
+func (self failingSource) Root() string {
+	return "failing"
+}
+
+// TestUpdateSourceError checks that a failing source cancels the update and the
+// tracks that weren't seen are kept.
+func TestUpdateSourceError(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	before := trackIDs(t, db, movedSource{{"a/1.mp3", "one"}})
+
+	// the modification time of the database has a resolution of seconds
+	time.Sleep(1100 * time.Millisecond)
+
+	sl := NewSourceList(db)
+	sl.Add(failingSource{})
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	for range status {
+	}
+
+	r := <-result
+	if r.Err == nil || r.Err.Error() != "broken" || !r.Cancelled {
+		t.Errorf("Want cancelled update with error, got %+v.", r)
+	}
+
+	var tracks []track.RawTrack
+	if err := query.New(db, "track").Exec(&tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracks) != 1 || tracks[0].Id != before["one"] {
+		t.Errorf("Want track %d kept, got %v.", before["one"], tracks)
+	}
+
+	s, err := scan.Last(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Cancelled != 1 || s.Errors != 1 {
+		t.Errorf("Want cancelled scan with an error, got %+v.", s)
+	}
+}
+
+// TestUpdateBatchError checks that only the tracks of a batch that can't be
+// inserted are reported as errors.
+func TestUpdateBatchError(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	_, err := db.Execute(`CREATE TRIGGER reject BEFORE INSERT ON track
+	WHEN NEW.title = 'bad' BEGIN SELECT RAISE(ABORT, 'rejected'); END;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sl := NewSourceList(db)
+	sl.Add(movedSource{{"a/1.mp3", "one"}, {"a/2.mp3", "bad"},
+		{"a/3.mp3", "three"}})
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	var failed []string
+	for s := range status {
+		if s.Err != nil {
+			failed = append(failed, s.Path)
+		}
+	}
+
+	if r := <-result; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+
+	if len(failed) != 1 || failed[0] != source.Location("moved", "a/2.mp3") {
+		t.Errorf("Want only a/2.mp3 failed, got %v.", failed)
+	}
+
+	n, err := query.New(db, "track").Count()
+	if err != nil || n != 2 {
+		t.Errorf("Want 2 tracks, got %d (%v).", n, err)
+	}
+}
+
+// skippingSource emits its tracks and a path it couldn't crawl.
+type skippingSource struct {
+	movedSource
+	skipped string
+}
+
+func (self skippingSource) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	tracks <- source.NewCrawlError("moved", self.skipped, errors.New("denied"))
+	return self.movedSource.Crawl(ctx, tracks)
+}
+
+// TestUpdateSkipped checks that tracks below a skipped path are kept.
+func TestUpdateSkipped(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	trackIDs(t, db, movedSource{
+		{"a/1.mp3", "one"}, {"ab/2.mp3", "two"}, {"b/3.mp3", "three"},
+	})
+
+	// the modification time of the database has a resolution of seconds
+	time.Sleep(1100 * time.Millisecond)
+
+	sl := NewSourceList(db)
+	sl.Add(skippingSource{movedSource{{"b/3.mp3", "three"}}, "a"})
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	for range status {
+	}
+
+	r := <-result
+	if r.Err != nil || len(r.Skipped) != 1 || r.Deleted != 1 {
+		t.Errorf("Want one skipped and one deleted path, got %+v.", r)
+	}
+
+	var tracks []track.RawTrack
+	if err := query.New(db, "track").Order("path").Exec(&tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracks) != 2 || tracks[0].Path != "a/1.mp3" ||
+		tracks[1].Path != "b/3.mp3" {
+		t.Errorf("Want a/1.mp3 and b/3.mp3 kept, got %v.", tracks)
+	}
+}
+
+// TestLibraries checks that tracks are added to the library of their source and
+// restricted libraries are visible only to granted users.
+func TestLibraries(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	sl := NewSourceList(db)
+	sl.AddTo("Kids", movedSource{{"a/1.mp3", "one"}})
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	for range status {
+	}
+
+	if r := <-result; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+
+	kids, err := library.ByName(db, "Kids")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tracks []track.RawTrack
+	if err := query.New(db, "track").Exec(&tracks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracks) != 1 || tracks[0].LibraryID != kids.Id {
+		t.Errorf("Want track in library %d, got %v.", kids.Id, tracks)
+	}
+
+	granted, _ := user.Add(db, "granted", false)
+	other, _ := user.Add(db, "other", false)
+	admin, _ := user.Add(db, "admin", true)
+
+	if err := library.Grant(db, kids.Id, granted.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		u    *user.User
+		want int
+	}{{nil, 1}, {granted, 2}, {other, 1}, {admin, 2}} {
+		libs, err := library.Visible(db, c.u)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(libs) != c.want {
+			t.Errorf("Want %d libraries visible to %v, got %v.", c.want,
+				c.u, libs)
+		}
+	}
+
+	// artists of other libraries aren't indexed
+	for _, c := range []struct {
+		ids  []int64
+		want int
+	}{{nil, 1}, {[]int64{kids.Id}, 1}, {[]int64{kids.Id + 1}, 0}} {
+		letters, err := artist.FirstLetters(db, c.ids)
+		if err != nil && err != artist.ErrNoEntries {
+			t.Fatal(err)
+		}
+
+		if len(letters) != c.want {
+			t.Errorf("Want %d letters in libraries %v, got %v.", c.want,
+				c.ids, letters)
+		}
+	}
+}
+
+// TestBooks checks that the tracks of audiobook libraries are grouped by books
+// and that positions are saved per book.
+func TestBooks(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	id, err := library.Ensure(db, "Books")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := library.SetKind(db, id, library.Audiobooks); err != nil {
+		t.Fatal(err)
+	}
+
+	sl := NewSourceList(db)
+	sl.AddTo("Books", movedSource{{"a/1.mp3", "one"}, {"a/2.mp3", "two"}})
+
+	status := make(chan *UpdateStatus, 100)
+	result := make(chan *UpdateResult)
+
+	go sl.Update(context.Background(), status, result)
+
+	for range status {
+	}
+
+	if r := <-result; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+
+	var books []book.Book
+	if err := query.New(db, "book").Exec(&books); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(books) != 1 || books[0].Title != "Album" {
+		t.Fatalf("Want one book 'Album', got %v.", books)
+	}
+
+	var parts []book.Part
+	if err := books[0].PartsQuery(db).Exec(&parts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("Want 2 parts, got %v.", parts)
+	}
+
+	u, _ := user.Add(db, "listener", false)
+
+	if err := book.SavePosition(db, parts[1].Id, u.Id, 1500); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := book.BookmarkOf(db, u.Id, books[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.TrackID != parts[1].Id || b.Position != 1500 {
+		t.Errorf("Want position 1500 in track %d, got %v.", parts[1].Id, b)
+	}
+
+	// books of libraries, that don't hold audiobooks anymore, are removed
+	if err := library.SetKind(db, id, library.Music); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := book.LinkTracks(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := book.DeleteDangling(db); err != nil {
+		t.Fatal(err)
+	}
+
+	err = book.SavePosition(db, parts[1].Id, u.Id, 0)
+	if err != book.ErrNoBook {
+		t.Errorf("Want ErrNoBook, got %v.", err)
+	}
+
+	n, err := book.ProgressQuery(db, u.Id).Count()
+	if err != nil || n != 0 {
+		t.Errorf("Want no bookmarks, got %d (%v).", n, err)
+	}
+}
+
+func TestArtistSortNames(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	defer func(articles []string) { artist.Articles = articles }(artist.Articles)
+	artist.Articles = []string{"The"}
+
+	sortName := func(name string) string {
+		var a artist.Artist
+		if err := query.New(db, "artist").Where("name =", name).Exec(&a); err != nil {
+			t.Fatal(err)
+		}
+		return a.SortName
+	}
+
+	for _, a := range []*artist.Artist{
+		artist.New("The Who", ""),
+		artist.New("The Who", "Who, The"),
+		artist.New("The Who", ""),
+		artist.New("The Band", ""),
+	} {
+		if _, err := artist.Upsert(db, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a derived sort name doesn't override a tagged one
+	if s := sortName("The Who"); s != "Who, The" {
+		t.Errorf("Want tagged sort name 'Who, The', got %q.", s)
+	}
+	if s := sortName("The Band"); s != "Band" {
+		t.Errorf("Want derived sort name 'Band', got %q.", s)
+	}
+
+	// derived sort names follow the articles
+	artist.Articles = nil
+	if err := artist.DeriveSortNames(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := sortName("The Band"); s != "The Band" {
+		t.Errorf("Want derived sort name 'The Band', got %q.", s)
+	}
+	if s := sortName("The Who"); s != "Who, The" {
+		t.Errorf("Want tagged sort name 'Who, The', got %q.", s)
+	}
+}
+
+// albumInfo is a track of the album album, modified at mtime.
+type albumInfo struct {
+	movedInfo
+	album string
+	mtime int64
+}
+
+func (self *albumInfo) Mtime() int64 { return self.mtime }
+
+func (self *albumInfo) Tags() (*source.TrackTags, error) {
+	return &source.TrackTags{Title: self.fingerprint, Artist: "Artist",
+		Album: self.album}, nil
+}
+
+// albumSource emits its tracks.
+type albumSource []*albumInfo
+
+func (self albumSource) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	for _, t := range self {
+		tracks <- t
+	}
+
+	return nil
+}
+
+func (self albumSource) Root() string {
+	return "moved"
+}
+
+// TestBookAlbumChange checks that a track whose album changed is linked to the
+// book of the new album.
+func TestBookAlbumChange(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	id, err := library.Ensure(db, "Books")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := library.SetKind(db, id, library.Audiobooks); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, album := range []string{"First", "Second"} {
+		sl := NewSourceList(db)
+		sl.AddTo("Books", albumSource{
+			{movedInfo{"a/1.mp3", "one"}, album, int64(i + 1)}})
+
+		status := make(chan *UpdateStatus, 100)
+		result := make(chan *UpdateResult)
+
+		go sl.Update(context.Background(), status, result)
+
+		for range status {
+		}
+
+		if r := <-result; r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+
+	var books []book.Book
+	if err := query.New(db, "book").Exec(&books); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(books) != 1 || books[0].Title != "Second" {
+		t.Fatalf("Want one book 'Second', got %v.", books)
+	}
+
+	var parts []book.Part
+	if err := books[0].PartsQuery(db).Exec(&parts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parts) != 1 {
+		t.Errorf("Want the track in book 'Second', got %v.", parts)
+	}
+}
@@ -22,13 +22,14 @@ import (
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"os"
+	"sync"
 	"time"
 )
 
 var (
-	ErrNoOpenTransaction   = errors.New("No open transaction.")
-	ErrExistingTransaction = errors.New("There is an existing transaction.")
-	ErrDatabaseExists      = errors.New("Can't create new database. A database already exists.")
+	ErrNoOpenTransaction = errors.New("No open transaction.")
+	ErrDatabaseExists    = errors.New("Can't create new database. A database already exists.")
+	ErrNewerSchema       = errors.New("The database has a newer schema than this version can use.")
 )
 
 type CreateTableFunc func(db *Database) error
@@ -42,9 +43,20 @@ type Database struct {
 	mtime    int64
 
 	tx       *sql.Tx // global transaction
-	txOpen   bool    // flag true, when exists an open transaction
+	users    int     // number of users sharing the open transaction
 	fctables []CreateTableFunc
 
+	// migrations[v] migrates the schema of version v to version v+1
+	migrations []CreateTableFunc
+
+	// prepared statements of the open transaction keyed by their SQL text
+	stmts map[string]*sql.Stmt
+
+	// guards tx, users and stmts, as the transaction is shared by the
+	// handlers of concurrent requests. It's held while a statement runs, as
+	// the users share the cached statements.
+	mu sync.Mutex
+
 	newDB bool
 }
 
@@ -84,10 +96,15 @@ func (self *Database) Close() {
 	self.db.Close()
 }
 
-// Creates the basic database structure.
+// Creates the basic database structure. The version of the created schema is
+// the number of registered migrations.
+//
+// An existing database of an older schema is migrated to the current one
+// instead. If it already has the current schema, ErrDatabaseExists is
+// returned.
 func (self *Database) CreateDatabase() error {
 	if !self.newDB {
-		return ErrDatabaseExists
+		return self.migrate()
 	}
 
 	if len(self.fctables) == 0 {
@@ -100,6 +117,13 @@ func (self *Database) CreateDatabase() error {
 	}
 	defer self.EndTransaction()
 
+	return self.CreateTables()
+}
+
+// CreateTables creates the tables of all registered functions in the open
+// transaction and sets the schema version to the current one. Migrations may
+// use it to start over with a new schema.
+func (self *Database) CreateTables() error {
 	for _, t := range self.fctables {
 		err := t(self)
 		if err != nil {
@@ -107,18 +131,99 @@ func (self *Database) CreateDatabase() error {
 		}
 	}
 
+	return self.setVersion(len(self.migrations))
+}
+
+// migrate runs the migrations from the schema version of the existing
+// database on.
+func (self *Database) migrate() error {
+	if err := self.BeginTransaction(); err != nil {
+		return err
+	}
+	defer self.EndTransaction()
+
+	version, err := self.Version()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case version == len(self.migrations):
+		return ErrDatabaseExists
+	case version > len(self.migrations):
+		return ErrNewerSchema
+	}
+
+	for version < len(self.migrations) {
+		if err := self.migrations[version](self); err != nil {
+			return fmt.Errorf("Migrating schema version %d failed: %v",
+				version, err)
+		}
+
+		// migrations creating the tables anew already set the version
+		next, err := self.Version()
+		if err != nil {
+			return err
+		}
+
+		if next <= version {
+			next = version + 1
+			if err := self.setVersion(next); err != nil {
+				return err
+			}
+		}
+
+		version = next
+	}
+
 	return nil
 }
 
+// Version returns the schema version of the database. Databases created
+// before schemas were versioned have version 0.
+func (self *Database) Version() (int, error) {
+	res, err := self.Query("PRAGMA user_version;")
+	if err != nil {
+		return 0, err
+	}
+
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	version, _ := res[0]["user_version"].(int64)
+
+	return int(version), nil
+}
+
+// setVersion stores the schema version of the database.
+func (self *Database) setVersion(version int) error {
+	_, err := self.Execute(fmt.Sprintf("PRAGMA user_version = %d;", version))
+	return err
+}
+
 // Add registers a new function to create a table.
 func (self *Database) Register(m CreateTableFunc) {
 	self.fctables = append(self.fctables, m)
 }
 
-// BeginTransaction starts a new database transaction.
+// RegisterMigration registers a function that migrates the schema from the
+// version of the number of migrations registered before to the next one.
+// Register a migration whenever the created tables change.
+func (self *Database) RegisterMigration(m CreateTableFunc) {
+	self.migrations = append(self.migrations, m)
+}
+
+// BeginTransaction starts a new database transaction. If there is an open
+// one already, it is joined instead. Every call has to be followed by a call of
+// EndTransaction.
 func (self *Database) BeginTransaction() (err error) {
-	if self.txOpen {
-		return ErrExistingTransaction
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.users > 0 {
+		self.users++
+		return nil
 	}
 
 	self.tx, err = self.db.Begin()
@@ -126,7 +231,8 @@ func (self *Database) BeginTransaction() (err error) {
 		return err
 	}
 
-	self.txOpen = true
+	self.users = 1
+	self.stmts = make(map[string]*sql.Stmt)
 
 	// Updating mtime when something has changed
 	self.mtime = time.Now().Unix()
@@ -134,45 +240,131 @@ func (self *Database) BeginTransaction() (err error) {
 	return nil
 }
 
-// EndTransaction closes a opened database transaction.
+// EndTransaction leaves the open database transaction. It is committed, when
+// the last user left it.
 func (self *Database) EndTransaction() error {
-	if !self.txOpen {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.users == 0 {
 		return ErrNoOpenTransaction
 	}
 
-	self.txOpen = false
+	self.users--
+	if self.users > 0 {
+		return nil
+	}
+
+	// statements are bound to the transaction and closed by the commit
+	self.stmts = nil
 
 	return self.tx.Commit()
 }
 
+// Checkpoint commits the open transaction and opens a new one. Unlike ending
+// and beginning a transaction, the modification time is kept, so long running
+// updates can let other connections write in between. While others share the
+// transaction, nothing is committed, as their statements are bound to it. If
+// the new transaction can't be opened, none is open anymore.
+func (self *Database) Checkpoint() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	switch {
+	case self.users == 0:
+		return ErrNoOpenTransaction
+	case self.users > 1:
+		return nil
+	}
+
+	self.users = 0
+	self.stmts = nil
+
+	if err := self.tx.Commit(); err != nil {
+		return err
+	}
+
+	tx, err := self.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	self.tx = tx
+	self.users = 1
+	self.stmts = make(map[string]*sql.Stmt)
+
+	return nil
+}
+
+// Prepare returns a prepared statement for the SQL-string sql in the open
+// transaction. Statements are cached by their SQL text as long as the
+// transaction is open, so repeated queries are only prepared once.
+func (self *Database) Prepare(sql string) (*sql.Stmt, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.prepare(sql)
+}
+
+// prepare is Prepare for callers holding the mutex.
+func (self *Database) prepare(sql string) (*sql.Stmt, error) {
+	if self.users == 0 {
+		return nil, ErrNoOpenTransaction
+	}
+
+	if stmt, ok := self.stmts[sql]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := self.tx.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	self.stmts[sql] = stmt
+
+	return stmt, nil
+}
+
 // Execute just executes sql query in global transaction.
 func (self *Database) Execute(sql string, args ...interface{}) (res sql.Result, err error) {
-	if !self.txOpen {
-		err = self.BeginTransaction()
-		if err != nil {
-			return nil, err
-		}
-		defer self.EndTransaction()
+	// a transaction is opened if there isn't one
+	if err = self.BeginTransaction(); err != nil {
+		return nil, err
 	}
+	defer self.EndTransaction()
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
 
-	res, err = self.tx.Exec(sql, args...)
+	stmt, err := self.prepare(sql)
+	if err != nil {
+		return nil, err
+	}
 
-	return res, err
+	return stmt.Exec(args...)
 }
 
 // QueryDB queries the database with a given SQL-string and arguments args and
 // returns the result as a map from column name to its value.
 func (self *Database) Query(sql string, args ...interface{}) ([]Result, error) {
-	if !self.txOpen {
-		err := self.BeginTransaction()
-		if err != nil {
-			return nil, err
-		}
-		defer self.EndTransaction()
+	// a transaction is opened if there isn't one
+	if err := self.BeginTransaction(); err != nil {
+		return nil, err
+	}
+	defer self.EndTransaction()
+
+	// the rows are read before another user runs the statement
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	stmt, err := self.prepare(sql)
+	if err != nil {
+		return nil, err
 	}
 
 	// do the actual query
-	rows, err := self.tx.Query(sql, args...)
+	rows, err := stmt.Query(args...)
 	if err != nil {
 		return nil, err
 	}
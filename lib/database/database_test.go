@@ -0,0 +1,196 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentTransaction(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Execute("CREATE TABLE T (ID INTEGER PRIMARY KEY);"); err != nil {
+		t.Fatal(err)
+	}
+
+	// handlers of concurrent requests share the transaction, some of them
+	// end it while the others are still using it
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*50*2)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				if err := db.BeginTransaction(); err != nil {
+					errs <- err
+					return
+				}
+				defer db.EndTransaction()
+			}
+
+			for j := 0; j < 50; j++ {
+				_, err := db.Execute("INSERT INTO T VALUES (?);", i*50+j)
+				if err != nil {
+					errs <- fmt.Errorf("Execute: %v", err)
+				}
+
+				_, err = db.Query(fmt.Sprintf("SELECT %d, ID FROM T;", j%5))
+				if err != nil {
+					errs <- fmt.Errorf("Query: %v", err)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if _, err := db.Prepare("SELECT ID FROM T;"); err != ErrNoOpenTransaction {
+		t.Errorf("Prepare after end: want ErrNoOpenTransaction, got %v.", err)
+	}
+
+	res, err := db.Query("SELECT count(*) AS n FROM T;")
+	if err != nil {
+		t.Fatalf("Query without transaction: %v", err)
+	}
+	if n := res[0]["n"].(int64); n != 8*50 {
+		t.Errorf("Want %d rows, got %d.", 8*50, n)
+	}
+}
+
+func TestJoinTransaction(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := db.BeginTransaction(); err != nil {
+			t.Fatalf("Begin %d: %v", i, err)
+		}
+	}
+
+	// the transaction stays open until the last user ends it
+	if err := db.EndTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Prepare("SELECT 1;"); err != nil {
+		t.Errorf("Prepare in joined transaction: %v", err)
+	}
+	if err := db.EndTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EndTransaction(); err != ErrNoOpenTransaction {
+		t.Errorf("End without transaction: want ErrNoOpenTransaction, got %v.", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "index.db")
+
+	open := func(tables ...string) *Database {
+		db, err := NewDatabase(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, table := range tables {
+			table := table
+			db.Register(func(db *Database) error {
+				_, err := db.Execute("CREATE TABLE " + table + " (ID INTEGER);")
+				return err
+			})
+		}
+
+		return db
+	}
+
+	// an unversioned database
+	db := open("A")
+	if err := db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = open("A", "B")
+	db.RegisterMigration(func(db *Database) error {
+		_, err := db.Execute("CREATE TABLE B (ID INTEGER);")
+		return err
+	})
+	if err := db.CreateDatabase(); err != nil {
+		t.Fatalf("Migration: %v", err)
+	}
+	if _, err := db.Query("SELECT ID FROM B;"); err != nil {
+		t.Errorf("Migrated table: %v", err)
+	}
+	if err := db.CreateDatabase(); err != ErrDatabaseExists {
+		t.Errorf("Current schema: want ErrDatabaseExists, got %v.", err)
+	}
+	db.Close()
+
+	// an older version can't use the newer schema
+	db = open("A")
+	if err := db.CreateDatabase(); err != ErrNewerSchema {
+		t.Errorf("Newer schema: want ErrNewerSchema, got %v.", err)
+	}
+	db.Close()
+}
+
+func TestCheckpoint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "index.db")
+
+	db, err := NewDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Execute("CREATE TABLE T (ID INTEGER PRIMARY KEY);"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.BeginTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	defer db.EndTransaction()
+
+	mtime := db.Mtime()
+
+	if _, err := db.Execute("INSERT INTO T VALUES (1);"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// other connections can write, while the transaction stays open
+	other, err := NewDatabase(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if _, err := other.Execute("INSERT INTO T VALUES (2);"); err != nil {
+		t.Errorf("Write of other connection: %v", err)
+	}
+
+	if _, err := db.Execute("INSERT INTO T VALUES (3);"); err != nil {
+		t.Errorf("Write after checkpoint: %v", err)
+	}
+	if db.Mtime() != mtime {
+		t.Errorf("Checkpoint changed the modification time.")
+	}
+}
@@ -43,9 +43,16 @@ func isExported(name string) bool {
 	return unicode.IsUpper(rune)
 }
 
+// isEmbedded reports whether f is an embedded struct, whose fields are handled
+// like fields of the embedding struct.
+func isEmbedded(f reflect.StructField) bool {
+	return f.Anonymous && f.Type.Kind() == reflect.Struct
+}
+
 // Encode eats a pointer to a struct src and converts all exported fields into a
 // map
 // 		"field name" => <values>
+// Fields of embedded structs are encoded, too.
 func Encode(src interface{}) (ent Entries, err error) {
 	v := reflect.ValueOf(src)
 	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
@@ -60,6 +67,15 @@ func Encode(src interface{}) (ent Entries, err error) {
 			continue
 		}
 
+		if isEmbedded(t.Field(i)) {
+			embedded, err := Encode(v.Field(i).Addr().Interface())
+			if err != nil {
+				return nil, err
+			}
+			ent = append(ent, embedded...)
+			continue
+		}
+
 		col := t.Field(i).Tag.Get("column")
 
 		// check struct's tag if value should be set (!= "0")
@@ -75,7 +91,7 @@ func Encode(src interface{}) (ent Entries, err error) {
 
 // Decode reads a map of type Result and a structure like
 // 		"field name" => <value>
-// and spits out a struct to dest.
+// and spits out a struct to dest. Fields of embedded structs are decoded, too.
 func Decode(src database.Result, dest interface{}) error {
 	v := reflect.ValueOf(dest)
 	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
@@ -90,6 +106,13 @@ func Decode(src database.Result, dest interface{}) error {
 			continue
 		}
 
+		if isEmbedded(t.Field(i)) {
+			if err := Decode(src, v.Field(i).Addr().Interface()); err != nil {
+				return err
+			}
+			continue
+		}
+
 		column := t.Field(i).Tag.Get("column")
 		if column == "" {
 			continue
@@ -203,7 +226,18 @@ func ExtractColumns(str interface{}) (columns []string, err error) {
 		t = t.Elem()
 	}
 
+	return columnsOf(t), nil
+}
+
+// columnsOf returns the column names of the struct type t including those of
+// embedded structs.
+func columnsOf(t reflect.Type) (columns []string) {
 	for i := 0; i < t.NumField(); i++ {
+		if isEmbedded(t.Field(i)) {
+			columns = append(columns, columnsOf(t.Field(i).Type)...)
+			continue
+		}
+
 		tag := t.Field(i).Tag.Get("column")
 
 		// ignore fields with empty tag
@@ -215,5 +249,5 @@ func ExtractColumns(str interface{}) (columns []string, err error) {
 		columns = append(columns, tag)
 	}
 
-	return columns, nil
+	return columns
 }
@@ -77,3 +77,49 @@ func BenchmarkDecode(b *testing.B) {
 		Decode(res, s)
 	}
 }
+
+type Embedded struct {
+	I int    `column:"myint"`
+	S string `column:"mystring"`
+}
+
+type embeddingStruct struct {
+	Embedded
+	Extra string `column:"extra"`
+}
+
+func TestEmbedded(t *testing.T) {
+	cols, err := ExtractColumns(&embeddingStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[myint mystring extra]"
+	if got := fmt.Sprintf("%v", cols); got != want {
+		t.Errorf("Want: %v, Got: %v", want, got)
+	}
+
+	src := database.Result{
+		"myint":    int64(2),
+		"mystring": "a string",
+		"extra":    "extra",
+	}
+
+	e := &embeddingStruct{}
+	if err := Decode(src, e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.I != 2 || e.S != "a string" || e.Extra != "extra" {
+		t.Errorf("Decoded wrong values: %+v", e)
+	}
+
+	ent, err := Encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ent) != 3 {
+		t.Errorf("Want 3 entries, Got: %v", ent)
+	}
+}
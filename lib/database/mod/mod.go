@@ -18,10 +18,18 @@ package mod
 
 import (
 	"database/sql"
+	"fmt"
 	. "github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/database/encoding"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"reflect"
+	"strings"
 )
 
+// maxVariables is the maximum number of arguments that are bound to a single
+// statement. Older SQLite versions don't allow more than 999.
+const maxVariables = 999
+
 type Mod struct {
 	db    *Database
 	table string
@@ -105,3 +113,192 @@ func (self *Mod) Update(id int, item interface{}) error {
 
 	return nil
 }
+
+// InsertAll adds all structs of the slice items to the associated table. The
+// elements of items can be structs or pointers to structs. The rows are
+// inserted with as few statements as possible, so all items must have the same
+// columns.
+//
+// Returns the number of inserted rows.
+func (self *Mod) InsertAll(items interface{}) (int64, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return 0, fmt.Errorf("items must be a slice.")
+	}
+
+	if v.Len() == 0 {
+		return 0, nil
+	}
+
+	var cols string
+	var vals []interface{}
+	var rows int
+
+	// encode all items
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		if item.Kind() == reflect.Interface {
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Ptr {
+			// values in interfaces aren't addressable
+			if !item.CanAddr() {
+				c := reflect.New(item.Type())
+				c.Elem().Set(item)
+				item = c
+			} else {
+				item = item.Addr()
+			}
+		}
+
+		entries, err := encoding.Encode(item.Interface())
+		if err != nil {
+			return 0, err
+		}
+
+		if len(entries) == 0 {
+			return 0, fmt.Errorf("Item %d has no columns to insert.", i)
+		}
+
+		var icols string
+		for j := 0; j < len(entries); j++ {
+			icols += entries[j].Column + ","
+		}
+		// remove last comma
+		icols = icols[:len(icols)-1]
+
+		// all rows of a statement have the same columns
+		if i == 0 {
+			cols = icols
+			rows = maxVariables / len(entries)
+		} else if icols != cols {
+			return 0, fmt.Errorf("Item %d has the columns (%s) instead of (%s).",
+				i, icols, cols)
+		}
+
+		for j := 0; j < len(entries); j++ {
+			vals = append(vals, entries[j].Value)
+		}
+	}
+
+	// one row of question marks
+	ncols := len(vals) / v.Len()
+	qmarks := "(" + strings.Repeat("?,", ncols)
+	qmarks = qmarks[:len(qmarks)-1] + ")"
+
+	var inserted int64
+
+	// split rows into chunks that don't exceed the maximum number of variables
+	for len(vals) > 0 {
+		n := len(vals) / ncols
+		if n > rows {
+			n = rows
+		}
+
+		values := strings.Repeat(qmarks+",", n)
+		sql := "INSERT INTO " + self.table + "(" + cols + ") VALUES" +
+			values[:len(values)-1]
+
+		res, err := self.db.Execute(sql, vals[:n*ncols]...)
+		if err != nil {
+			return inserted, err
+		}
+
+		aff, _ := res.RowsAffected()
+		inserted += aff
+
+		vals = vals[n*ncols:]
+	}
+
+	return inserted, nil
+}
+
+// Upsert adds a new row to the associated table from the given struct. If the
+// row conflicts with an existing row on the unique columns conflict, the
+// existing row is updated instead.
+//
+// Returns the ID of the inserted or updated row.
+func (self *Mod) Upsert(item interface{}, conflict ...string) (int64, error) {
+	return self.UpsertKeep(item, nil, conflict...)
+}
+
+// UpsertKeep works like Upsert, but the columns keep are only set when a new
+// row is inserted. An updated row keeps their values.
+func (self *Mod) UpsertKeep(item interface{}, keep []string,
+	conflict ...string) (int64, error) {
+
+	entries, err := encoding.Encode(item)
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make(map[string]bool)
+	for _, c := range keep {
+		kept[c] = true
+	}
+
+	var cols, qmarks, set string
+	vals := make([]interface{}, len(entries))
+
+	// prepare arguments
+	for i := 0; i < len(entries); i++ {
+		cols += entries[i].Column + ","
+		if !kept[entries[i].Column] {
+			set += entries[i].Column + " = excluded." + entries[i].Column + ","
+		}
+		vals[i] = entries[i].Value
+		qmarks += "?,"
+	}
+
+	if set == "" {
+		return 0, fmt.Errorf("No columns to update.")
+	}
+
+	// remove last comma
+	cols = cols[:len(cols)-1]
+	set = set[:len(set)-1]
+	qmarks = qmarks[:len(qmarks)-1]
+
+	stmt := "INSERT INTO " + self.table + "(" + cols + ") VALUES(" + qmarks +
+		") ON CONFLICT(" + strings.Join(conflict, ",") + ") DO UPDATE SET " +
+		set + " RETURNING ID"
+
+	res, err := self.db.Query(stmt, vals...)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(res) == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	id, ok := res[0]["ID"].(int64)
+	if !ok {
+		return 0, fmt.Errorf("Returned ID is no int.")
+	}
+
+	return id, nil
+}
+
+// Delete deletes the entry with ID id in the associated table.
+func (self *Mod) Delete(id int) error {
+	_, err := self.db.Execute("DELETE FROM "+self.table+" WHERE ID = ?", id)
+	return err
+}
+
+// DeleteWhere deletes all entries of the associated table that are matched by
+// the query q. The query can join other tables, but must select rows of the
+// associated table.
+//
+// Returns the number of deleted rows.
+func (self *Mod) DeleteWhere(q *query.Query) (int64, error) {
+	sub, args := q.SQL(self.table + ".ID")
+
+	res, err := self.db.Execute(
+		"DELETE FROM "+self.table+" WHERE ID IN ("+sub+")", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
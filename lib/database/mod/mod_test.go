@@ -0,0 +1,30 @@
+package mod
+
+import (
+	"testing"
+)
+
+type noColumns struct {
+	Id int64 `column:"ID" set:"0"`
+}
+
+type name struct {
+	Name string `column:"name"`
+}
+
+type nameYear struct {
+	Name string `column:"name"`
+	Year int    `column:"year"`
+}
+
+func TestInsertAllColumns(t *testing.T) {
+	m := New(nil, "test")
+
+	if _, err := m.InsertAll([]noColumns{{}}); err == nil {
+		t.Error("Items without columns are inserted.")
+	}
+
+	if _, err := m.InsertAll([]interface{}{name{}, &nameYear{}}); err == nil {
+		t.Error("Items of different columns are inserted.")
+	}
+}
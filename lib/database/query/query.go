@@ -22,6 +22,7 @@ import (
 )
 
 type join struct {
+	Type                                         string
 	OnTable, OnFieldName, OwnTable, OwnFieldName string
 }
 
@@ -35,11 +36,22 @@ type wherein struct {
 	Values    []interface{}
 }
 
+type whereinquery struct {
+	FieldName string
+	Query     *Query
+	Column    string
+}
+
 type like struct {
 	Constriction string
 	Value        interface{}
 }
 
+type cursor struct {
+	FieldNames []string
+	Values     []interface{}
+}
+
 type sortDirection int
 
 const (
@@ -66,7 +78,10 @@ type Query struct {
 	join    []join
 	where   []where
 	wherein []wherein
+	insub   []whereinquery
 	like    []like
+	cursor  *cursor
+	groupBy []string
 	order   []order
 	limit   uint
 	offset  uint
@@ -87,7 +102,7 @@ type sqlQuery struct {
 
 // toSQL encodes the query into an SQL-Query.
 func (self *Query) toSQL() *sqlQuery {
-	var cols, join, where, wherein, order, limit, offset string
+	var cols, join, groupBy, order, limit, offset string
 	sql := &sqlQuery{}
 
 	// set columns
@@ -104,62 +119,19 @@ func (self *Query) toSQL() *sqlQuery {
 
 	// add join statement
 	for _, v := range self.join {
-		join += " JOIN " + v.OnTable + " ON " +
+		join += " " + v.Type + " " + v.OnTable + " ON " +
 			v.OwnTable + "." + v.OwnFieldName + " = " +
 			v.OnTable + "." + v.OnFieldName
 
 	}
 
-	// add constriction if available
-	if len(self.where) > 0 || len(self.like) > 0 || len(self.wherein) > 0 {
-		where = " WHERE"
-	}
-
-	// add boolean constrictions
-	for i, v := range self.where {
-		where += " " + v.Constriction + " ?"
-
-		if i < len(self.where)-1 {
-			where += " AND"
-		}
-
-		sql.Args = append(sql.Args, v.Value)
-	}
-
-	if len(self.where) > 0 && len(self.wherein) > 0 {
-		where += " AND"
-	}
-
-	// add in set constriction
-	for i, v := range self.wherein {
-		wherein += " " + v.FieldName + " IN ("
-		for i := 0; i < len(v.Values); i++ {
-			wherein += "?,"
-		}
-		// trim the last comma
-		wherein = wherein[:len(wherein)-1]
-		wherein += ")"
+	// add constrictions
+	where, args := self.whereSQL()
+	sql.Args = append(sql.Args, args...)
 
-		if i < len(self.where)-1 {
-			wherein += " AND"
-		}
-
-		sql.Args = append(sql.Args, v.Values...)
-	}
-
-	if len(self.wherein) > 0 && len(self.like) > 0 {
-		where += " AND"
-	}
-
-	// add wildcard constriction
-	for i, v := range self.like {
-		where += " " + v.Constriction + " LIKE ?"
-
-		if i < len(self.like)-1 {
-			where += " AND"
-		}
-
-		sql.Args = append(sql.Args, v.Value)
+	// add grouping statement
+	if len(self.groupBy) > 0 {
+		groupBy = " GROUP BY " + strings.Join(self.groupBy, ",")
 	}
 
 	// add ordering statement
@@ -178,6 +150,9 @@ func (self *Query) toSQL() *sqlQuery {
 	if self.limit != 0 {
 		limit = " LIMIT ?"
 		sql.Args = append(sql.Args, self.limit)
+	} else if self.offset != 0 {
+		// SQLite needs a limit to use an offset
+		limit = " LIMIT -1"
 	}
 
 	// ...and offset
@@ -188,11 +163,89 @@ func (self *Query) toSQL() *sqlQuery {
 
 	// put everything together
 	sql.SQL = "SELECT " + cols + " FROM " +
-		self.table + join + where + wherein + order + limit + offset
+		self.table + join + where + groupBy + order + limit + offset
 
 	return sql
 }
 
+// whereSQL encodes all constrictions of the query into a WHERE clause and
+// returns it with its arguments. If there are no constrictions an empty
+// string is returned.
+func (self *Query) whereSQL() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	// add boolean constrictions
+	for _, v := range self.where {
+		conds = append(conds, v.Constriction+" ?")
+		args = append(args, v.Value)
+	}
+
+	// add in set constriction
+	for _, v := range self.wherein {
+		// trim the last comma, an empty set matches nothing
+		qmarks := strings.TrimSuffix(strings.Repeat("?,", len(v.Values)), ",")
+
+		conds = append(conds, v.FieldName+" IN ("+qmarks+")")
+		args = append(args, v.Values...)
+	}
+
+	// add constriction by subquery
+	for _, v := range self.insub {
+		sub, subArgs := v.Query.SQL(v.Column)
+
+		conds = append(conds, v.FieldName+" IN ("+sub+")")
+		args = append(args, subArgs...)
+	}
+
+	// add wildcard constriction
+	for _, v := range self.like {
+		conds = append(conds, v.Constriction+" LIKE ?")
+		args = append(args, v.Value)
+	}
+
+	// add keyset constriction
+	if self.cursor != nil {
+		var cols []string
+		op := " > "
+
+		for _, v := range self.cursor.FieldNames {
+			if strings.HasPrefix(v, "-") {
+				op = " < "
+				v = v[1:]
+			}
+			cols = append(cols, v)
+		}
+
+		qmarks := strings.Repeat("?,", len(cols))
+		qmarks = qmarks[:len(qmarks)-1]
+
+		conds = append(conds,
+			"("+strings.Join(cols, ",")+")"+op+"("+qmarks+")")
+		args = append(args, self.cursor.Values...)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// SQL returns the SQL-string and the arguments of the query. If cols are
+// given only those columns are selected, otherwise all columns of the table.
+//
+// It is meant to use the query as a subquery in other statements.
+func (self *Query) SQL(cols ...string) (string, []interface{}) {
+	sql := self.columns(cols...).toSQL()
+	return sql.SQL, sql.Args
+}
+
+// Table returns the name of the queried table.
+func (self *Query) Table() string {
+	return self.table
+}
+
 // columns returns a derivated Query that returns only the given cols. A '*'
 // selects all available columns.
 //
@@ -210,11 +263,22 @@ func (self *Query) columns(cols ...string) *Query {
 // to the fields onFieldName and ownFieldname.
 // If ownFieldname is an empty string "", self.table is used.
 func (self *Query) Join(onTable, onFieldName, ownTable, ownFieldName string) *Query {
+	return self.addJoin("JOIN", onTable, onFieldName, ownTable, ownFieldName)
+}
+
+// LeftJoin works like Join, but keeps rows of ownTable that have no matching
+// row in onTable. The columns of onTable are NULL then.
+func (self *Query) LeftJoin(onTable, onFieldName, ownTable, ownFieldName string) *Query {
+	return self.addJoin("LEFT JOIN", onTable, onFieldName, ownTable, ownFieldName)
+}
+
+func (self *Query) addJoin(typ, onTable, onFieldName, ownTable, ownFieldName string) *Query {
 	if ownTable == "" {
 		ownTable = self.table
 	}
 
 	self.join = append(self.join, join{
+		Type:         typ,
 		OnTable:      onTable,
 		OnFieldName:  onFieldName,
 		OwnTable:     ownTable,
@@ -262,6 +326,17 @@ func (self *Query) WhereIn(fieldname string, values ...interface{}) *Query {
 	return self
 }
 
+// WhereInQuery returns a derivated Query with an applied constriction. The
+// fieldName has to be in the results of the column col of the query q.
+// Example:
+//
+// 		WhereInQuery("ID", query.New(db, "album").Where("year =", 1977), "artist_id")
+//
+func (self *Query) WhereInQuery(fieldName string, q *Query, col string) *Query {
+	self.insub = append(self.insub, whereinquery{fieldName, q, col})
+	return self
+}
+
 // Like returns a derivated Query with an applied constriction. The
 // constriction must be a string of the form
 //
@@ -302,6 +377,31 @@ func (self *Query) Order(fieldName string) *Query {
 	return self
 }
 
+// GroupBy returns a derivated Query that groups the results by fieldName.
+// Multiple calls group by all given fieldNames.
+func (self *Query) GroupBy(fieldName string) *Query {
+	self.groupBy = append(self.groupBy, fieldName)
+	return self
+}
+
+// After returns a derivated Query that only matches the rows coming after the
+// row, whose fields fieldNames have the given values. This makes it possible
+// to page through results with a cursor instead of an offset.
+//
+// The query should be ordered by the same fieldNames, which should be unique
+// in combination. Like in Order, a fieldName prefixed with a minus sign '-'
+// means descending order. All fieldNames must have the same direction.
+//
+// Example:
+//
+// 		Order("name").Order("ID").After([]string{"name", "ID"}, "Foo", 42)
+//
+// Multiple calls just override the previous one.
+func (self *Query) After(fieldNames []string, values ...interface{}) *Query {
+	self.cursor = &cursor{FieldNames: fieldNames, Values: values}
+	return self
+}
+
 // Limit returns a derivated Query that the number of results are limited to
 // limit. Multiple calls just overrides the previous one.
 func (self *Query) Limit(limit uint) *Query {
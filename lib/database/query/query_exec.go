@@ -60,58 +60,10 @@ func (self *Query) Count() (int, error) {
 		return 0, nil
 	}
 
-	v, ok := res[0]["COUNT(*)"].(int)
+	v, ok := res[0]["COUNT(*)"].(int64)
 	if !ok {
 		return -1, fmt.Errorf("Result is no int.")
 	}
 
-	return v, nil
-}
-
-const (
-	SQLLetterSet = "'A','B','C','D','E','F','G','H','I','J','K','L','M','N'," +
-		"'O','P','Q','R','S','T','U','V','W','X','Y','Z'"
-)
-
-// Letters returns string of first letters in the column named column.
-func (self *Query) Letters(column string) (alpha, nonalpha string, err error) {
-	sqlQuery := self.toSQL()
-
-	sql := "SELECT DISTINCT SUBSTR(UPPER(" + column + "),1,1) FROM (" +
-		sqlQuery.SQL + ") WHERE SUBSTR(UPPER(" + column +
-		"),1,1) IN (" + SQLLetterSet + ")"
-
-	res, err := self.db.Query(sql, sqlQuery.Args...)
-	if err != nil {
-		return "", "", err
-	}
-
-	for i := 0; i < len(res); i++ {
-		v, ok := res[i][fmt.Sprintf("SUBSTR(UPPER(%s),1,1)", column)].(string)
-		if !ok {
-			return "", "", fmt.Errorf("Result is no string.")
-		}
-
-		alpha += v
-	}
-
-	sql = "SELECT DISTINCT SUBSTR(UPPER(" + column + "),1,1) FROM (" +
-		sqlQuery.SQL + ") WHERE SUBSTR(UPPER(" + column +
-		"),1,1) NOT IN (" + SQLLetterSet + ")"
-
-	res, err = self.db.Query(sql, sqlQuery.Args...)
-	if err != nil {
-		return "", "", err
-	}
-
-	for i := 0; i < len(res); i++ {
-		v, ok := res[i][fmt.Sprintf("SUBSTR(UPPER(%s),1,1)", column)].(string)
-		if !ok {
-			return "", "", fmt.Errorf("Result is no string.")
-		}
-
-		nonalpha += v
-	}
-
-	return alpha, nonalpha, nil
+	return int(v), nil
 }
@@ -0,0 +1,120 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package helper
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Latin letters with diacritics, grouped by the letter they fold to.
+var foldGroups = map[string]string{
+	"A":  "ÀÁÂÃÄÅĀĂĄǍǺȀȂȦẠẢẤẦẨẪẬẮẰẲẴẶ",
+	"C":  "ÇĆĈĊČ",
+	"D":  "ĎĐÐ",
+	"E":  "ÈÉÊËĒĔĖĘĚȄȆȨẸẺẼẾỀỂỄỆ",
+	"G":  "ĜĞĠĢǦ",
+	"H":  "ĤĦ",
+	"I":  "ÌÍÎÏĨĪĬĮİǏȈȊỈỊ",
+	"J":  "Ĵ",
+	"K":  "ĶǨ",
+	"L":  "ĹĻĽĿŁ",
+	"N":  "ÑŃŅŇǸ",
+	"O":  "ÒÓÔÕÖØŌŎŐƠǑǾȌȎȪȬȮȰỌỎỐỒỔỖỘỚỜỞỠỢ",
+	"R":  "ŔŖŘȐȒ",
+	"S":  "ŚŜŞŠȘ",
+	"T":  "ŢŤŦȚ",
+	"U":  "ÙÚÛÜŨŪŬŮŰŲƯǓǕǗǙǛȔȖỤỦỨỪỬỮỰ",
+	"W":  "ŴẀẂẄ",
+	"Y":  "ÝŶŸȲỲỴỶỸ",
+	"Z":  "ŹŻŽ",
+	"AE": "ÆǼ",
+	"OE": "Œ",
+	"TH": "Þ",
+	"SS": "ẞ",
+	"a":  "àáâãäåāăąǎǻȁȃȧạảấầẩẫậắằẳẵặ",
+	"c":  "çćĉċč",
+	"d":  "ďđð",
+	"e":  "èéêëēĕėęěȅȇȩẹẻẽếềểễệ",
+	"g":  "ĝğġģǧ",
+	"h":  "ĥħ",
+	"i":  "ìíîïĩīĭįıǐȉȋỉị",
+	"j":  "ĵ",
+	"k":  "ķǩ",
+	"l":  "ĺļľŀł",
+	"n":  "ñńņňǹ",
+	"o":  "òóôõöøōŏőơǒǿȍȏȫȭȯȱọỏốồổỗộớờởỡợ",
+	"r":  "ŕŗřȑȓ",
+	"s":  "śŝşšș",
+	"t":  "ţťŧț",
+	"u":  "ùúûüũūŭůűųưǔǖǘǚǜȕȗụủứừửữự",
+	"w":  "ŵẁẃẅ",
+	"y":  "ýÿŷȳỳỵỷỹ",
+	"z":  "źżž",
+	"ae": "æǽ",
+	"oe": "œ",
+	"th": "þ",
+	"ss": "ß",
+}
+
+// Maps every letter of foldGroups to its replacement.
+var foldTable = make(map[rune]string)
+
+func init() {
+	for replacement, letters := range foldGroups {
+		for _, r := range letters {
+			foldTable[r] = replacement
+		}
+	}
+}
+
+// Fold replaces Latin letters with diacritics by their base letters, e.g.
+//
+// 		"Björk" → "Bjork", "Ærøskøbing" → "AEroskobing"
+//
+// Other characters are kept unchanged.
+func Fold(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		if f, ok := foldTable[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// NonAlphaLetter is the index letter of names that don't start with a letter.
+const NonAlphaLetter = "0"
+
+// IndexLetter returns the letter name is listed under in an alphabetical
+// index. It is the first letter of the folded and upper cased name, so
+// "Ásgeir" is listed under "A". Names starting with a non letter character are
+// listed under NonAlphaLetter.
+func IndexLetter(name string) string {
+	r, _ := utf8.DecodeRuneInString(Fold(strings.TrimSpace(name)))
+
+	if !unicode.IsLetter(r) {
+		return NonAlphaLetter
+	}
+
+	return string(unicode.ToUpper(r))
+}
@@ -29,7 +29,9 @@ type activelink struct {
 
 type Pager []activelink
 
-func NewPager(baseurl string, labels []string, active string) Pager {
+// NewPager creates a pager with a link for every label. The label is set as
+// value of the URL parameter key.
+func NewPager(baseurl, key string, labels []string, active string) Pager {
 	// creating pager
 	pager := make(Pager, len(labels))
 
@@ -39,7 +41,7 @@ func NewPager(baseurl string, labels []string, active string) Pager {
 		}
 		pager[i].Label = labels[i]
 		v := url.Values{}
-		v.Add("page", labels[i])
+		v.Add(key, labels[i])
 		pager[i].Link = "/" + strings.TrimLeft(baseurl, "/") + "?" + v.Encode()
 	}
 
@@ -0,0 +1,200 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package helper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 500
+)
+
+// Pagination describes which part of a listing is requested. It is read from
+// the URL parameters
+//
+// 		page=<number>&per_page=<number>&cursor=<cursor>
+//
+// If a cursor is given, page is ignored and the listing continues after the
+// row the cursor points to.
+type Pagination struct {
+	Page    uint          `json:"page"`
+	PerPage uint          `json:"per_page"`
+	Total   int           `json:"total"`
+	Cursor  []interface{} `json:"-"`
+}
+
+// NewPagination reads the pagination parameters from values. Missing
+// parameters are set to their defaults. fields is the number of fieldNames the
+// listing is ordered by, a cursor must have a value for each of them.
+func NewPagination(values url.Values, fields int) (*Pagination, error) {
+	p := &Pagination{Page: 1, PerPage: DefaultPerPage}
+
+	if v := values.Get("page"); v != "" {
+		page, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || page == 0 {
+			return nil, fmt.Errorf("Invalid page '%s'.", v)
+		}
+		p.Page = uint(page)
+	}
+
+	if v := values.Get("per_page"); v != "" {
+		perPage, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || perPage == 0 || perPage > MaxPerPage {
+			return nil, fmt.Errorf("Invalid per_page '%s'. Must be between "+
+				"1 and %d.", v, MaxPerPage)
+		}
+		p.PerPage = uint(perPage)
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := DecodeCursor(v)
+		if err != nil || len(cursor) != fields {
+			return nil, fmt.Errorf("Invalid cursor '%s'.", v)
+		}
+		p.Cursor = cursor
+	}
+
+	return p, nil
+}
+
+// Pages returns the number of pages of the listing.
+func (self *Pagination) Pages() uint {
+	if self.Total <= 0 {
+		return 1
+	}
+
+	return (uint(self.Total) + self.PerPage - 1) / self.PerPage
+}
+
+// Apply orders q by fieldNames and limits it to the requested page. The
+// combination of fieldNames must be unique, so the last row of a page can be
+// used as a cursor. See query.Query's After method.
+//
+// Total should be set before, because counting a limited query is useless.
+func (self *Pagination) Apply(q *query.Query, fieldNames ...string) *query.Query {
+	for _, v := range fieldNames {
+		q.Order(v)
+	}
+
+	if self.Cursor != nil {
+		q.After(fieldNames, self.Cursor...)
+	} else {
+		q.Offset((self.Page - 1) * self.PerPage)
+	}
+
+	return q.Limit(self.PerPage)
+}
+
+// EncodeCursor encodes the values of the ordered fields of a row into an
+// opaque string, that can be used as cursor parameter.
+func EncodeCursor(values ...interface{}) string {
+	b, _ := json.Marshal(values)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor decodes a cursor created by EncodeCursor. Only strings, numbers,
+// booleans and null are accepted as values, as they are compared to columns.
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	b, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("Empty cursor.")
+	}
+
+	for _, v := range values {
+		switch v.(type) {
+		case string, float64, bool, nil:
+		default:
+			return nil, fmt.Errorf("Cursor value %v is no scalar.", v)
+		}
+	}
+
+	return values, nil
+}
+
+// number of page links around the active page
+const pagerWindow = 4
+
+// NumberPager contains links to numbered pages of a listing and to the
+// previous and next page. Prev and Next are empty on the first respectively
+// last page.
+type NumberPager struct {
+	Pages []activelink
+	Prev  string
+	Next  string
+}
+
+// NewNumberPager creates a pager for the listing at baseurl. All parameters in
+// values are kept in the links, except page and cursor.
+func NewNumberPager(baseurl string, values url.Values, p *Pagination) *NumberPager {
+	pager := &NumberPager{}
+	last := p.Pages()
+
+	link := func(page uint) string {
+		v := url.Values{}
+		for k, vs := range values {
+			if k == "page" || k == "cursor" {
+				continue
+			}
+			v[k] = vs
+		}
+		v.Set("page", strconv.FormatUint(uint64(page), 10))
+
+		return "/" + strings.TrimLeft(baseurl, "/") + "?" + v.Encode()
+	}
+
+	from, to := uint(1), last
+	if p.Page > pagerWindow+1 {
+		from = p.Page - pagerWindow
+	}
+	if p.Page+pagerWindow < last {
+		to = p.Page + pagerWindow
+	}
+
+	for i := from; i <= to; i++ {
+		pager.Pages = append(pager.Pages, activelink{
+			Label:  strconv.FormatUint(uint64(i), 10),
+			Link:   link(i),
+			Active: i == p.Page,
+		})
+	}
+
+	if p.Page > 1 {
+		pager.Prev = link(p.Page - 1)
+	}
+	if p.Page < last {
+		pager.Next = link(p.Page + 1)
+	}
+
+	return pager
+}
@@ -0,0 +1,31 @@
+package helper
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestNewPaginationCursor(t *testing.T) {
+	valid := EncodeCursor("Foo", 42)
+
+	if p, err := NewPagination(url.Values{"cursor": {valid}}, 2); err != nil {
+		t.Errorf("Valid cursor: %v", err)
+	} else if len(p.Cursor) != 2 {
+		t.Errorf("Valid cursor: got %v.", p.Cursor)
+	}
+
+	invalid := []string{
+		"!",
+		valid + "x",
+		EncodeCursor("Foo"),
+		EncodeCursor("Foo", 42, 1),
+		EncodeCursor("Foo", []int{1}),
+		EncodeCursor(map[string]int{"a": 1}, 42),
+	}
+
+	for _, v := range invalid {
+		if _, err := NewPagination(url.Values{"cursor": {v}}, 2); err == nil {
+			t.Errorf("Cursor '%s' accepted.", v)
+		}
+	}
+}
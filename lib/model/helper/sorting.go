@@ -0,0 +1,92 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package helper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Sorting maps the keys that can be given by the URL parameter
+//
+// 		sort=<key>
+//
+// to the columns they sort by. A key prefixed with a minus sign '-' sorts
+// descending. As only whitelisted keys are accepted, user input never reaches
+// a query directly.
+type Sorting map[string]string
+
+// ParseSort splits the value of a sort parameter into key and direction.
+func ParseSort(value string) (key string, desc bool) {
+	if strings.HasPrefix(value, "-") {
+		return value[1:], true
+	}
+
+	return value, false
+}
+
+// FieldNames returns the fieldNames to order a query by for the value of a
+// sort parameter. If value is empty, def is used. The fieldName unique is
+// appended in the same direction to make the order unique, like needed by
+// Pagination's Apply.
+func (self Sorting) FieldNames(value, def, unique string) ([]string, error) {
+	if value == "" {
+		value = def
+	}
+
+	key, desc := ParseSort(value)
+
+	column, ok := self[key]
+	if !ok {
+		return nil, fmt.Errorf("Can't sort by '%s'.", key)
+	}
+
+	if desc {
+		return []string{"-" + column, "-" + unique}, nil
+	}
+
+	return []string{column, unique}, nil
+}
+
+// Links returns a link for every key of the sorting to the listing at baseurl.
+// All parameters in values are kept in the links, except sort, page and cursor.
+// The link of the active key reverses its direction.
+func (self Sorting) Links(baseurl string, values url.Values, active string) map[string]string {
+	links := make(map[string]string)
+	activeKey, desc := ParseSort(active)
+
+	for key := range self {
+		v := url.Values{}
+		for k, vs := range values {
+			if k == "sort" || k == "page" || k == "cursor" {
+				continue
+			}
+			v[k] = vs
+		}
+
+		if key == activeKey && !desc {
+			v.Set("sort", "-"+key)
+		} else {
+			v.Set("sort", key)
+		}
+
+		links[key] = "/" + strings.TrimLeft(baseurl, "/") + "?" + v.Encode()
+	}
+
+	return links
+}
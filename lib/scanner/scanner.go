@@ -0,0 +1,217 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The scanner package runs scans of the library in the background. At most one
+// scan runs at a time. Its progress can be polled or subscribed to.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRunning    = errors.New("A scan is already running.")
+	ErrNotRunning = errors.New("No scan is running.")
+)
+
+// Actions of an event.
+const (
+	Unchanged = iota
+	Updated
+	Added
+	Skipped
+)
+
+// Event is the status of a file handled by a scan.
+type Event struct {
+	Path   string
+	Action int
+	Err    error
+}
+
+// Func runs a scan. It sends an event for every handled file to events and
+// returns when the scan is finished. If ctx is cancelled, the scan should stop
+// as soon as possible.
+type Func func(ctx context.Context, events chan<- *Event) error
+
+// Progress of the running or last scan. Start and end are given as Unix time.
+// Skipped paths are counted as errors, too.
+type Progress struct {
+	Running   bool   `json:"running"`
+	Cancelled bool   `json:"cancelled"`
+	Started   int64  `json:"started"`
+	Finished  int64  `json:"finished,omitempty"`
+	Seen      int64  `json:"seen"`
+	Added     int64  `json:"added"`
+	Updated   int64  `json:"updated"`
+	Skipped   int64  `json:"skipped"`
+	Errors    int64  `json:"errors"`
+	Current   string `json:"current"`
+	Err       string `json:"error,omitempty"`
+}
+
+// Scanner runs scans by its Func.
+type Scanner struct {
+	run Func
+
+	mu       sync.Mutex
+	progress Progress
+	cancel   context.CancelFunc
+	subs     map[chan Progress]bool
+}
+
+// Constructor.
+func New(run Func) *Scanner {
+	return &Scanner{run: run, subs: make(map[chan Progress]bool)}
+}
+
+// Start starts a scan in the background. If a scan is running already,
+// ErrRunning is returned.
+func (self *Scanner) Start() (Progress, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.progress.Running {
+		return self.progress, ErrRunning
+	}
+
+	self.progress = Progress{Running: true, Started: time.Now().Unix()}
+
+	var ctx context.Context
+	ctx, self.cancel = context.WithCancel(context.Background())
+
+	events := make(chan *Event, 100)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- self.run(ctx, events)
+		close(events)
+	}()
+
+	go self.watch(events, done)
+
+	self.notify()
+
+	return self.progress, nil
+}
+
+// watch updates the progress by the events until the scan is done.
+func (self *Scanner) watch(events <-chan *Event, done <-chan error) {
+	for e := range events {
+		self.mu.Lock()
+
+		p := &self.progress
+		p.Seen++
+		p.Current = e.Path
+
+		if e.Action == Skipped {
+			p.Skipped++
+		}
+
+		switch {
+		case e.Err != nil:
+			p.Errors++
+		case e.Action == Added:
+			p.Added++
+		case e.Action == Updated:
+			p.Updated++
+		}
+
+		self.notify()
+		self.mu.Unlock()
+	}
+
+	err := <-done
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	// release the resources of the context
+	self.cancel()
+
+	p := &self.progress
+	p.Running = false
+	p.Current = ""
+	p.Finished = time.Now().Unix()
+
+	if err != nil {
+		p.Err = err.Error()
+	}
+
+	self.notify()
+}
+
+// Cancel cancels the running scan. If no scan is running, ErrNotRunning is
+// returned.
+func (self *Scanner) Cancel() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if !self.progress.Running {
+		return ErrNotRunning
+	}
+
+	if !self.progress.Cancelled {
+		self.progress.Cancelled = true
+		self.cancel()
+		self.notify()
+	}
+
+	return nil
+}
+
+// Progress returns the progress of the running or the last scan.
+func (self *Scanner) Progress() Progress {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return self.progress
+}
+
+// Subscribe returns a channel receiving the progress on every change. If the
+// receiver is too slow, intermediate states are dropped, but the latest one is
+// always delivered. The returned function ends the subscription.
+func (self *Scanner) Subscribe() (<-chan Progress, func()) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	c := make(chan Progress, 1)
+	c <- self.progress
+	self.subs[c] = true
+
+	return c, func() {
+		self.mu.Lock()
+		defer self.mu.Unlock()
+
+		delete(self.subs, c)
+	}
+}
+
+// notify sends the progress to all subscribers. The mutex must be held.
+func (self *Scanner) notify() {
+	for c := range self.subs {
+		// replace a state the subscriber didn't receive yet
+		select {
+		case <-c:
+		default:
+		}
+
+		c <- self.progress
+	}
+}
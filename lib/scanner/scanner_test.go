@@ -0,0 +1,71 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// wait returns the progress, when the scan has finished.
+func wait(s *Scanner) Progress {
+	c, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	for p := range c {
+		if !p.Running {
+			return p
+		}
+	}
+
+	panic("unreachable")
+}
+
+func TestScanner(t *testing.T) {
+	started := make(chan bool)
+
+	s := New(func(ctx context.Context, events chan<- *Event) error {
+		events <- &Event{Path: "a", Action: Added}
+		events <- &Event{Path: "b", Action: Updated}
+		events <- &Event{Path: "c", Err: errors.New("broken")}
+		started <- true
+
+		<-ctx.Done()
+		return nil
+	})
+
+	if err := s.Cancel(); err != ErrNotRunning {
+		t.Errorf("Want ErrNotRunning, got %v.", err)
+	}
+
+	if _, err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if _, err := s.Start(); err != ErrRunning {
+		t.Errorf("Want ErrRunning, got %v.", err)
+	}
+
+	if err := s.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := wait(s)
+	if !p.Cancelled || p.Seen != 3 || p.Added != 1 || p.Updated != 1 ||
+		p.Errors != 1 {
+		t.Errorf("Wrong progress: %+v", p)
+	}
+
+	// a new scan can be started after the last one finished
+	s.run = func(ctx context.Context, events chan<- *Event) error {
+		return errors.New("failed")
+	}
+
+	if _, err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := wait(s); p.Err != "failed" || p.Cancelled {
+		t.Errorf("Wrong progress: %+v", p)
+	}
+}
@@ -17,15 +17,35 @@
 package filecrawler
 
 import (
+	"context"
+	"errors"
 	"github.com/mokasin/gotaglib"
 	"github.com/mokasin/musicrawler/lib/source"
+	"github.com/mokasin/musicrawler/lib/source/rawtag"
+	"io"
+	"io/fs"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
+// FileInfo is a file crawled by a FileCrawler. Its filename is the path within
+// the file system of the crawler. If the file system is a local directory,
+// local is the path of the file in the operating system.
 type FileInfo struct {
+	fsys     fs.FS
+	source   string
 	filename string
+	local    string
 	mtime    int64
+	size     int64
+}
+
+// Getter of FileInfo.source
+func (fi *FileInfo) Source() string {
+	return fi.source
 }
 
 // Getter of FileInfo.filename
@@ -38,15 +58,59 @@ func (fi *FileInfo) Mtime() int64 {
 	return fi.mtime
 }
 
+// Getter of FileInfo.size
+func (fi *FileInfo) Size() int64 {
+	return fi.size
+}
+
+// localFile returns a path of the file in the operating system. Files of other
+// file systems are copied to a temporary file, that is removed by calling
+// cleanup.
+func (fi *FileInfo) localFile() (filename string, cleanup func(), err error) {
+	if fi.local != "" {
+		return fi.local, func() {}, nil
+	}
+
+	f, err := fi.fsys.Open(fi.filename)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	// TagLib recognizes the format by the extension
+	tmp, err := ioutil.TempFile("", "musicrawler-*"+path.Ext(fi.filename))
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = io.Copy(tmp, f)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, err
+	}
+
+	return tmp.Name(), func() { os.Remove(tmp.Name()) }, nil
+}
+
 // Reads tags (id3, vorbis,…) from file
 func (fi *FileInfo) Tags() (*source.TrackTags, error) {
-	tag, err := gotaglib.Read(fi.filename)
+	filename, cleanup, err := fi.localFile()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	tag, err := gotaglib.Read(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	return &source.TrackTags{
-		Path:    tag.Filename,
+	tags := &source.TrackTags{
+		Path:    fi.filename,
 		Title:   tag.Title,
 		Artist:  tag.Artist,
 		Album:   tag.Album,
@@ -56,40 +120,291 @@ func (fi *FileInfo) Tags() (*source.TrackTags, error) {
 		Track:   tag.Track,
 		Bitrate: tag.Bitrate,
 		Length:  tag.Length,
-	}, nil
+	}
+
+	// fields TagLib doesn't provide are optional, so errors are ignored
+	if fields, err := rawtag.Read(filename); err == nil {
+		tags.ArtistSort = fields.Get("ARTISTSORT")
+	}
+
+	if chapters, err := rawtag.ReadChapters(filename); err == nil {
+		for _, c := range chapters {
+			tags.Chapters = append(tags.Chapters,
+				source.Chapter{Title: c.Title, Start: c.Start, End: c.End})
+		}
+	}
+
+	return tags, nil
 }
 
+// Fingerprint returns a fingerprint of the file's audio data. Only the parts of
+// the file needed are read, if the file system supports random access.
+func (fi *FileInfo) Fingerprint() (string, error) {
+	if fi.local != "" {
+		return rawtag.Fingerprint(fi.local)
+	}
+
+	f, err := fi.fsys.Open(fi.filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if r, ok := f.(io.ReaderAt); ok {
+		return rawtag.FingerprintFrom(r, fi.size)
+	}
+
+	filename, cleanup, err := fi.localFile()
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	return rawtag.Fingerprint(filename)
+}
+
+// ErrSymlinkLoop is reported for a symlink pointing to a directory above it.
+var ErrSymlinkLoop = errors.New("symlink loop")
+
+// FileCrawler crawls the files of a file system with one of the extensions
+// Filetypes, ignoring their case. The file system is either the local
+// directory Dir or any fs.FS identified by Dir.
+//
+// Paths matching one of the gitignore-style patterns Exclude are skipped, just
+// like paths matching the patterns of a file IgnoreFile in any directory. If
+// Include is given, only files matching one of its patterns are crawled. The
+// patterns are relative to the root of the file system.
+//
+// Hidden files and directories are skipped, unless Hidden is set. Symlinks to
+// files are always crawled, symlinks to directories only if FollowSymlinks is
+// set and the file system resolves symlinks.
 type FileCrawler struct {
-	Dir       string
-	Filetypes []string
+	Dir            string
+	Filetypes      []string
+	Include        []string
+	Exclude        []string
+	Hidden         bool
+	FollowSymlinks bool
+
+	fsys  fs.FS
+	local bool
 }
 
-// Constructor of FileCrawler
+// Constructor of FileCrawler crawling the local directory dir.
 func New(dir string, filetypes []string) *FileCrawler {
-	return &FileCrawler{Dir: dir, Filetypes: filetypes}
+	return &FileCrawler{
+		Dir:       dir,
+		Filetypes: filetypes,
+		fsys:      os.DirFS(dir),
+		local:     true,
+	}
 }
 
-// Sends source.TrackInfo to receiver if filetype matches one of w.Filetypes.
-func (w *FileCrawler) walkfunc(receiver chan<- source.TrackInfo, path string,
-	info os.FileInfo, err error) error {
+// NewFS returns a FileCrawler crawling the file system fsys, that is
+// identified by id, e.g. the URL it is served from.
+func NewFS(id string, fsys fs.FS, filetypes []string) *FileCrawler {
+	return &FileCrawler{Dir: id, Filetypes: filetypes, fsys: fsys}
+}
+
+// Root returns the crawled directory or the ID of the file system.
+func (w *FileCrawler) Root() string {
+	return w.Dir
+}
+
+// FS returns the crawled file system.
+func (w *FileCrawler) FS() fs.FS {
+	return w.fsys
+}
+
+// matches returns true if the filetype of name is one of w.Filetypes.
+func (w *FileCrawler) matches(name string) bool {
 	for _, v := range w.Filetypes {
-		if filepath.Ext(path) == "."+v {
-			receiver <- &FileInfo{filename: path, mtime: info.ModTime().Unix()}
+		if strings.EqualFold(path.Ext(name), "."+v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// crawl holds the state of a running crawl of a FileCrawler.
+type crawl struct {
+	*FileCrawler
+	ctx      context.Context
+	receiver chan<- source.TrackInfo
+	include  []*pattern
+}
+
+// send sends ti to the receiver. Returns an error if the crawl is cancelled.
+func (c *crawl) send(ti source.TrackInfo) error {
+	select {
+	case c.receiver <- ti:
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// skip sends the path that couldn't be crawled because of err.
+func (c *crawl) skip(name string, err error) error {
+	return c.send(source.NewCrawlError(c.Dir, name, err))
+}
+
+// sendFile sends the file name, if it is a track that isn't excluded.
+func (c *crawl) sendFile(name string, info fs.FileInfo) error {
+	if !info.Mode().IsRegular() || !c.matches(name) {
+		return nil
+	}
+
+	if len(c.include) > 0 && !matchAny(c.include, name, false) {
+		return nil
+	}
+
+	fi := &FileInfo{
+		fsys:     c.fsys,
+		source:   c.Dir,
+		filename: name,
+		mtime:    info.ModTime().Unix(),
+		size:     info.Size(),
+	}
+
+	if c.local {
+		fi.local = filepath.Join(c.Dir, filepath.FromSlash(name))
+	}
+
+	return c.send(fi)
+}
+
+// walk sends the files below the directory dir to the receiver. Paths that
+// can't be read are sent as source.CrawlError. ancestors are the directories
+// above dir including itself, to detect loops of symlinks. Paths matching
+// ignore are skipped.
+func (c *crawl) walk(dir string, ancestors []fs.FileInfo,
+	ignore []*pattern) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(c.fsys, dir)
+	if err != nil {
+		// the directory is reported once and its content is skipped
+		return c.skip(dir, err)
+	}
+
+	// the root is "." and the base of patterns is ""
+	base := strings.TrimPrefix(dir, ".")
+
+	for _, e := range entries {
+		if e.Name() != IgnoreFile {
+			continue
+		}
+
+		name := path.Join(dir, IgnoreFile)
+
+		patterns, err := readIgnoreFile(c.fsys, name, base)
+		if err != nil {
+			if err := c.skip(name, err); err != nil {
+				return err
+			}
 			break
 		}
+
+		// the patterns of the parent directories are shared
+		ignore = append(ignore[:len(ignore):len(ignore)], patterns...)
+		break
+	}
+
+	for _, e := range entries {
+		if !c.Hidden && strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		name := path.Join(dir, e.Name())
+
+		var info fs.FileInfo
+
+		if e.Type()&fs.ModeSymlink != 0 {
+			info, err = fs.Stat(c.fsys, name)
+		} else {
+			info, err = e.Info()
+		}
+
+		if err != nil {
+			// broken symlinks are only reported if they look like tracks
+			if e.Type()&fs.ModeSymlink != 0 && !c.matches(name) {
+				continue
+			}
+
+			if err := c.skip(name, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if matchAny(ignore, name, info.IsDir()) {
+			continue
+		}
+
+		if !info.IsDir() {
+			if err := c.sendFile(name, info); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if e.Type()&fs.ModeSymlink != 0 {
+			if !c.FollowSymlinks {
+				continue
+			}
+
+			if loops(info, ancestors) {
+				if err := c.skip(name, ErrSymlinkLoop); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		err := c.walk(name, append(ancestors, info), ignore)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// loops returns true if the directory info is one of ancestors.
+func loops(info fs.FileInfo, ancestors []fs.FileInfo) bool {
+	for _, a := range ancestors {
+		if os.SameFile(info, a) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Sends all filepathes of type filetypes to the receiver channel. Is meant to
-// be a goroutine.
-func (w *FileCrawler) Crawl(tracks chan<- source.TrackInfo, done chan<- bool) {
-	// have to use closure because argument as to be a function not a method
-	filepath.Walk(w.Dir,
-		func(p string, i os.FileInfo, e error) error {
-			return w.walkfunc(tracks, p, i, e)
-		})
-
-	done <- true
+// be a goroutine. Fails if a pattern of Include or Exclude is malformed.
+func (w *FileCrawler) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	include, err := parsePatterns("", w.Include)
+	if err != nil {
+		return err
+	}
+
+	exclude, err := parsePatterns("", w.Exclude)
+	if err != nil {
+		return err
+	}
+
+	c := &crawl{FileCrawler: w, ctx: ctx, receiver: tracks, include: include}
+
+	info, err := fs.Stat(w.fsys, ".")
+	if err != nil {
+		return c.skip(".", err)
+	}
+
+	return c.walk(".", []fs.FileInfo{info}, exclude)
 }
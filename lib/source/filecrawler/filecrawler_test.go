@@ -0,0 +1,151 @@
+package filecrawler
+
+import (
+	"context"
+	"github.com/mokasin/musicrawler/lib/source"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+// crawlPaths returns the paths of the tracks and the skipped paths of fc.
+func crawlPaths(t *testing.T, fc *FileCrawler) (tracks, skipped []string) {
+	c := make(chan source.TrackInfo, 100)
+
+	if err := fc.Crawl(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	close(c)
+
+	for ti := range c {
+		if _, ok := ti.(*source.CrawlError); ok {
+			skipped = append(skipped, ti.Path())
+		} else {
+			tracks = append(tracks, ti.Path())
+		}
+	}
+
+	sort.Strings(tracks)
+	return tracks, skipped
+}
+
+// makeTree creates the files in a temporary directory and returns it. The
+// files have the given content.
+func makeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "filecrawler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, content := range files {
+		p = filepath.Join(dir, p)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestCrawlSymlinks(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"a/1.mp3": "", "a/2.txt": "", "b/3.ogg": "",
+	})
+	defer os.RemoveAll(dir)
+
+	for link, target := range map[string]string{
+		"a/b":           "../b",
+		"a/loop":        "..",
+		"a/missing.mp3": "nothing.mp3",
+		"a/other":       "nothing",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fc := New(dir, []string{"mp3", "ogg"})
+
+	tracks, skipped := crawlPaths(t, fc)
+	if want := []string{"a/1.mp3", "b/3.ogg"}; !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Want tracks %v, got %v.", want, tracks)
+	}
+	if want := []string{"a/missing.mp3"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("Want skipped %v, got %v.", want, skipped)
+	}
+
+	fc.FollowSymlinks = true
+
+	tracks, skipped = crawlPaths(t, fc)
+	if want := []string{"a/1.mp3", "a/b/3.ogg", "b/3.ogg"}; !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Want tracks %v, got %v.", want, tracks)
+	}
+	if want := []string{"a/loop", "a/missing.mp3"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("Want skipped %v, got %v.", want, skipped)
+	}
+}
+
+func TestCrawlMissingRoot(t *testing.T) {
+	fc := New(filepath.Join(os.TempDir(), "filecrawler-missing"), nil)
+
+	if _, skipped := crawlPaths(t, fc); len(skipped) != 1 {
+		t.Errorf("Want missing root skipped, got %v.", skipped)
+	}
+}
+
+func TestCrawlIgnore(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"a/1.MP3":                "",
+		"a/.hidden.mp3":          "",
+		".Trash/2.mp3":           "",
+		"@eaDir/3.mp3":           "",
+		"b/Samples/4.mp3":        "",
+		"b/5.mp3":                "",
+		"b/6.mp3":                "",
+		"b/c/7.mp3":              "",
+		"b/.musicrawlerignore":   "# comment\n*.mp3\n!6.mp3\nc/\n",
+		"d/e/Sample/8.mp3":       "",
+		"d/9.mp3":                "",
+		"d/e/.musicrawlerignore": "/Sample\n",
+	})
+	defer os.RemoveAll(dir)
+
+	fc := New(dir, []string{"mp3"})
+	fc.Exclude = []string{"@eaDir/", "**/Samples"}
+
+	tracks, _ := crawlPaths(t, fc)
+	want := []string{"a/1.MP3", "b/6.mp3", "d/9.mp3"}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Want tracks %v, got %v.", want, tracks)
+	}
+
+	fc.Hidden = true
+	fc.Include = []string{"a/**"}
+
+	tracks, _ = crawlPaths(t, fc)
+	want = []string{"a/.hidden.mp3", "a/1.MP3"}
+	if !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Want tracks %v, got %v.", want, tracks)
+	}
+}
+
+func TestCrawlFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/1.mp3":              {},
+		"a/2.flac":             {},
+		"b/3.OGG":              {},
+		"b/.musicrawlerignore": {Data: []byte("3.*")},
+	}
+
+	fc := NewFS("mem", fsys, []string{"mp3", "ogg"})
+
+	tracks, _ := crawlPaths(t, fc)
+	if want := []string{"a/1.mp3"}; !reflect.DeepEqual(tracks, want) {
+		t.Errorf("Want tracks %v, got %v.", want, tracks)
+	}
+}
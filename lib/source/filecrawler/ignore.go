@@ -0,0 +1,186 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package filecrawler
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Name of the files with patterns of paths to ignore in their directory.
+const IgnoreFile = ".musicrawlerignore"
+
+// pattern is a gitignore-style pattern. Patterns without a slash match the
+// name of a file or directory at any depth, others match the path relative to
+// the directory base. '**' matches any number of directories. A trailing slash
+// matches directories only and a leading '!' includes paths again, that were
+// matched by previous patterns.
+type pattern struct {
+	base     string
+	segments []string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// parsePattern parses the pattern line relative to the directory base. Returns
+// nil for empty lines and comments.
+func parsePattern(base, line string) (*pattern, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	p := &pattern{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// escapes a leading '!' or '#'
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	p.anchored = strings.Contains(line, "/")
+	p.segments = strings.Split(strings.TrimPrefix(line, "/"), "/")
+
+	for _, s := range p.segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// parsePatterns parses the pattern lines relative to the directory base.
+func parsePatterns(base string, lines []string) ([]*pattern, error) {
+	var patterns []*pattern
+
+	for _, l := range lines {
+		p, err := parsePattern(base, l)
+		if err != nil {
+			return nil, err
+		}
+
+		if p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns, nil
+}
+
+// readIgnoreFile reads the patterns of the ignore file name of the file system
+// fsys, that is in the directory base.
+func readIgnoreFile(fsys fs.FS, name, base string) ([]*pattern, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return parsePatterns(base, lines)
+}
+
+// match returns true if p matches the path rel within the crawled file system.
+// isDir tells whether rel is a directory.
+func (p *pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+
+	segments := strings.Split(rel, "/")
+
+	if !p.anchored {
+		segments = segments[len(segments)-1:]
+	}
+
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments returns true if the path segments match the pattern segments.
+func matchSegments(patterns, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+
+	if patterns[0] == "**" {
+		// a trailing '**' matches everything inside, but not the directory
+		// itself
+		if len(patterns) == 1 {
+			return len(segments) > 0
+		}
+
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(patterns[0], segments[0]); !ok {
+		return false
+	}
+
+	return matchSegments(patterns[1:], segments[1:])
+}
+
+// matchAny returns true if the path rel is matched by patterns. The last
+// matching pattern decides, so negated patterns can include paths again.
+func matchAny(patterns []*pattern, rel string, isDir bool) bool {
+	matched := false
+
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			matched = !p.negate
+		}
+	}
+
+	return matched
+}
@@ -0,0 +1,257 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package podcast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknownFeed = errors.New("Unknown feed format.")
+
+// Feed is a podcast feed with its episodes, latest first.
+type Feed struct {
+	Title    string    `json:"title"`
+	Author   string    `json:"author"`
+	Episodes []Episode `json:"episodes"`
+}
+
+// Episode of a podcast. Published is given as Unix time, Length in seconds. The
+// audio data is found at URL. File is the name of the downloaded file within
+// the directory of the feed, it is empty for episodes not downloaded.
+type Episode struct {
+	GUID        string `json:"guid"`
+	Title       string `json:"title"`
+	Published   int64  `json:"published"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Length      int    `json:"length"`
+	File        string `json:"file,omitempty"`
+}
+
+// rss is a RSS 2.0 feed.
+type rss struct {
+	Title  string `xml:"channel>title"`
+	Author string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd channel>author"`
+	Items  []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		PubDate     string `xml:"pubDate"`
+		Description string `xml:"description"`
+		Duration    string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+		Enclosure   struct {
+			URL string `xml:"url,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+}
+
+// atom is an Atom feed.
+type atom struct {
+	Title  string `xml:"title"`
+	Author string `xml:"author>name"`
+	Items  []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Links     []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse parses a RSS 2.0 or Atom feed. Items without audio enclosure are no
+// episodes and left out.
+func Parse(r io.Reader) (*Feed, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root struct {
+		XMLName xml.Name
+	}
+
+	if err := decode(data, &root); err != nil {
+		return nil, err
+	}
+
+	var feed *Feed
+
+	switch root.XMLName.Local {
+	case "rss":
+		feed, err = parseRSS(data)
+	case "feed":
+		feed, err = parseAtom(data)
+	default:
+		return nil, ErrUnknownFeed
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(feed.Episodes, func(i, j int) bool {
+		return feed.Episodes[i].Published > feed.Episodes[j].Published
+	})
+
+	return feed, nil
+}
+
+// decode decodes the XML document data into v. As feeds are often sloppy,
+// HTML entities and unclosed elements are accepted.
+func decode(data []byte, v interface{}) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	return d.Decode(v)
+}
+
+func parseRSS(data []byte) (*Feed, error) {
+	var f rss
+
+	if err := decode(data, &f); err != nil {
+		return nil, err
+	}
+
+	feed := &Feed{Title: strings.TrimSpace(f.Title),
+		Author: strings.TrimSpace(f.Author)}
+
+	for _, item := range f.Items {
+		if item.Enclosure.URL == "" {
+			continue
+		}
+
+		e := Episode{
+			GUID:        strings.TrimSpace(item.GUID),
+			Title:       strings.TrimSpace(item.Title),
+			Published:   parseTime(item.PubDate),
+			Description: strings.TrimSpace(item.Description),
+			URL:         strings.TrimSpace(item.Enclosure.URL),
+			Length:      parseDuration(item.Duration),
+		}
+
+		if e.GUID == "" {
+			e.GUID = e.URL
+		}
+
+		feed.Episodes = append(feed.Episodes, e)
+	}
+
+	return feed, nil
+}
+
+func parseAtom(data []byte) (*Feed, error) {
+	var f atom
+
+	if err := decode(data, &f); err != nil {
+		return nil, err
+	}
+
+	feed := &Feed{Title: strings.TrimSpace(f.Title),
+		Author: strings.TrimSpace(f.Author)}
+
+	for _, item := range f.Items {
+		e := Episode{
+			GUID:        strings.TrimSpace(item.ID),
+			Title:       strings.TrimSpace(item.Title),
+			Published:   parseTime(item.Published),
+			Description: strings.TrimSpace(item.Summary),
+		}
+
+		if e.Published == 0 {
+			e.Published = parseTime(item.Updated)
+		}
+
+		if e.Description == "" {
+			e.Description = strings.TrimSpace(item.Content)
+		}
+
+		for _, l := range item.Links {
+			if l.Rel == "enclosure" {
+				e.URL = strings.TrimSpace(l.Href)
+				break
+			}
+		}
+
+		if e.URL == "" {
+			continue
+		}
+
+		if e.GUID == "" {
+			e.GUID = e.URL
+		}
+
+		feed.Episodes = append(feed.Episodes, e)
+	}
+
+	return feed, nil
+}
+
+// layouts of dates in feeds
+var layouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// parseTime returns the date s as Unix time, or 0 if it isn't a date.
+func parseTime(s string) int64 {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Unix()
+		}
+	}
+
+	return 0
+}
+
+// parseDuration returns the duration s of the form [[hh:]mm:]ss in seconds, or
+// 0 if it is malformed.
+func parseDuration(s string) int {
+	var seconds int
+
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+
+		seconds = seconds*60 + n
+	}
+
+	return seconds
+}
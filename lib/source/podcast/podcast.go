@@ -0,0 +1,527 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The podcast package subscribes to podcast feeds. New episodes are downloaded
+// into a directory with a subdirectory per feed and crawled like files, but
+// tagged with the metadata of their feed.
+//
+// Every directory of a feed holds the index file .feed.json with the URL and
+// the metadata of the feed and its downloaded episodes. As hidden file, it
+// isn't crawled itself.
+package podcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/source"
+	"github.com/mokasin/musicrawler/lib/source/filecrawler"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name of the index file of a feed directory.
+const indexName = ".feed.json"
+
+// Genre of episodes.
+const Genre = "Podcast"
+
+// Podcast is a source of the episodes of subscribed feeds. Only the Latest
+// episodes of a feed are downloaded, all if Latest is 0. Episodes whose file
+// type isn't one of Filetypes are skipped.
+type Podcast struct {
+	Dir       string
+	Feeds     []string
+	Filetypes []string
+	Latest    int
+
+	client  *http.Client
+	crawler *filecrawler.FileCrawler
+}
+
+// Constructor of Podcast downloading the episodes of feeds into the local
+// directory dir. Feeds and episodes are fetched by client, or
+// http.DefaultClient if it is nil.
+func New(dir string, feeds []string, filetypes []string,
+	client *http.Client) *Podcast {
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Podcast{
+		Dir:       dir,
+		Feeds:     feeds,
+		Filetypes: filetypes,
+		client:    client,
+		crawler:   filecrawler.New(dir, filetypes),
+	}
+}
+
+// Root returns the directory the episodes are downloaded to.
+func (self *Podcast) Root() string {
+	return self.Dir
+}
+
+// FS returns the directory the episodes are downloaded to.
+func (self *Podcast) FS() fs.FS {
+	return self.crawler.FS()
+}
+
+// index is the index file of a feed directory.
+type index struct {
+	URL string `json:"url"`
+	Feed
+
+	dir string
+}
+
+// episode returns the downloaded episode with the file name, or nil if there
+// is none.
+func (self *index) episode(name string) *Episode {
+	for i := 0; i < len(self.Episodes); i++ {
+		if self.Episodes[i].File == name {
+			return &self.Episodes[i]
+		}
+	}
+
+	return nil
+}
+
+// has reports whether the episode e was downloaded already.
+func (self *index) has(e *Episode) bool {
+	for _, d := range self.Episodes {
+		if d.GUID == e.GUID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// save writes the index to the directory of its feed within dir.
+func (self *index) save(dir string) error {
+	data, err := json.MarshalIndent(self, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(dir, self.dir, indexName)
+	tmp := name + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// indexes reads the index files of all feed directories by the directories.
+// Directories without readable index file aren't feed directories.
+func (self *Podcast) indexes() (map[string]*index, error) {
+	entries, err := ioutil.ReadDir(self.Dir)
+	if os.IsNotExist(err) {
+		return map[string]*index{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]*index)
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(self.Dir, e.Name(), indexName))
+		if err != nil {
+			continue
+		}
+
+		idx := &index{dir: e.Name()}
+		if json.Unmarshal(data, idx) == nil {
+			indexes[idx.dir] = idx
+		}
+	}
+
+	return indexes, nil
+}
+
+// get requests rawurl and returns the body of the response. The body has to
+// be closed.
+func (self *Podcast) get(ctx context.Context, rawurl string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := self.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", rawurl, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// Fetch fetches and parses the feed at rawurl.
+func (self *Podcast) Fetch(ctx context.Context, rawurl string) (*Feed, error) {
+	body, err := self.get(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return Parse(body)
+}
+
+// sync fetches the feed at rawurl and downloads its new episodes into the
+// feed directory of idx. A nil idx is created for the feed. The index is saved
+// after every episode, so episodes downloaded before an error are kept.
+//
+// Returns the index of the feed.
+func (self *Podcast) sync(ctx context.Context, rawurl string,
+	idx *index) (*index, error) {
+
+	feed, err := self.Fetch(ctx, rawurl)
+	if err != nil {
+		return idx, err
+	}
+
+	if idx == nil {
+		idx = &index{URL: rawurl}
+
+		idx.dir, err = self.newDir(feed.Title, rawurl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	idx.Title, idx.Author = feed.Title, feed.Author
+
+	episodes := feed.Episodes
+	if self.Latest > 0 && len(episodes) > self.Latest {
+		episodes = episodes[:self.Latest]
+	}
+
+	for i := 0; i < len(episodes); i++ {
+		e := &episodes[i]
+
+		if idx.has(e) || !self.matches(e.URL) {
+			continue
+		}
+
+		e.File, err = self.download(ctx, idx.dir, e)
+		if err != nil {
+			return idx, err
+		}
+
+		idx.Episodes = append(idx.Episodes, *e)
+
+		if err := idx.save(self.Dir); err != nil {
+			return idx, err
+		}
+	}
+
+	// metadata of the feed is updated without new episodes, too
+	return idx, idx.save(self.Dir)
+}
+
+// matches reports whether the file type of the episode at rawurl is one of
+// self.Filetypes.
+func (self *Podcast) matches(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range self.Filetypes {
+		if strings.EqualFold(path.Ext(u.Path), "."+v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newDir creates a new feed directory named after title or, if it is empty,
+// after the host of rawurl.
+//
+// Returns the name of the directory.
+func (self *Podcast) newDir(title, rawurl string) (string, error) {
+	name := sanitize(title)
+	if name == "" {
+		if u, err := url.Parse(rawurl); err == nil {
+			name = sanitize(u.Host)
+		}
+	}
+	if name == "" {
+		name = "feed"
+	}
+
+	if err := os.MkdirAll(self.Dir, 0755); err != nil {
+		return "", err
+	}
+
+	// feeds with the same title get distinct directories
+	dir := name
+	for i := 2; ; i++ {
+		err := os.Mkdir(filepath.Join(self.Dir, dir), 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+
+		dir = fmt.Sprintf("%s (%d)", name, i)
+	}
+}
+
+// download downloads the episode e into the feed directory dir. The file is
+// named after the date of publishing and the name of the file at e.URL,
+// numbered if an episode of the same name exists. It is written to a hidden
+// temporary file first, so partly downloaded episodes are never crawled.
+//
+// Returns the name of the file.
+func (self *Podcast) download(ctx context.Context, dir string,
+	e *Episode) (string, error) {
+
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", err
+	}
+
+	name := sanitize(path.Base(u.Path))
+	if e.Published != 0 {
+		name = time.Unix(e.Published, 0).UTC().Format("2006-01-02") + " " + name
+	}
+
+	body, err := self.get(ctx, e.URL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Join(self.Dir, dir), ".download-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		name, err = uniqueName(filepath.Join(self.Dir, dir), name)
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(self.Dir, dir, name))
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return name, nil
+}
+
+// uniqueName returns name, or if a file of that name exists in dir, name
+// numbered before its extension like "episode (2).mp3".
+func uniqueName(dir, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	unique := name
+	for i := 2; ; i++ {
+		_, err := os.Lstat(filepath.Join(dir, unique))
+		if os.IsNotExist(err) {
+			return unique, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		unique = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// sanitize returns name usable as file name. Path separators and control
+// characters are replaced and leading dots removed, so the file isn't hidden.
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '-'
+		case r < ' ':
+			return -1
+		}
+		return r
+	}, name)
+
+	return strings.TrimLeft(strings.TrimSpace(name), ".")
+}
+
+// Crawl syncs all feeds and sends the downloaded episodes over the tracks
+// channel. Feeds that can't be synced are sent as CrawlError, the episodes
+// downloaded before are crawled anyway.
+func (self *Podcast) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+
+	indexes, err := self.indexes()
+	if err != nil {
+		return err
+	}
+
+	byURL := make(map[string]*index)
+	for _, idx := range indexes {
+		byURL[idx.URL] = idx
+	}
+
+	for _, feed := range self.Feeds {
+		idx, err := self.sync(ctx, feed, byURL[feed])
+		if idx != nil {
+			indexes[idx.dir] = idx
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			// tracks of a feed never synced can't be below any path
+			p := feed
+			if idx != nil {
+				p = idx.dir
+			}
+
+			err = send(ctx, tracks, source.NewCrawlError(self.Dir, p, err))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return self.crawl(ctx, tracks, indexes)
+}
+
+// crawl crawls the feed directories and sends the episodes with the metadata
+// of their feeds found in indexes.
+func (self *Podcast) crawl(ctx context.Context, tracks chan<- source.TrackInfo,
+	indexes map[string]*index) error {
+
+	files := make(chan source.TrackInfo)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- self.crawler.Crawl(ctx, files)
+		close(files)
+	}()
+
+	var err error
+
+	for ti := range files {
+		if err != nil {
+			continue
+		}
+
+		dir, name := path.Split(ti.Path())
+		idx := indexes[strings.TrimSuffix(dir, "/")]
+
+		if _, ok := ti.(*source.CrawlError); !ok && idx != nil {
+			if e := idx.episode(name); e != nil {
+				ti = &EpisodeInfo{TrackInfo: ti, Feed: &idx.Feed, Episode: e}
+			}
+		}
+
+		// the crawler stops after cancelling, too
+		err = send(ctx, tracks, ti)
+	}
+
+	if cerr := <-done; err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// send sends ti over tracks. Returns an error if ctx is cancelled.
+func send(ctx context.Context, tracks chan<- source.TrackInfo,
+	ti source.TrackInfo) error {
+
+	select {
+	case tracks <- ti:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EpisodeInfo is a downloaded episode. It is tagged with the metadata of its
+// feed instead of the tags of its file.
+type EpisodeInfo struct {
+	source.TrackInfo
+	Feed    *Feed
+	Episode *Episode
+}
+
+// Tags returns the metadata of the episode. Bitrate and length are read from
+// the file, if possible.
+func (self *EpisodeInfo) Tags() (*source.TrackTags, error) {
+	tags, err := self.TrackInfo.Tags()
+	if err != nil {
+		// the feed tags the episode anyway
+		tags = &source.TrackTags{Path: self.Path()}
+	}
+
+	tags.Title = self.Episode.Title
+	tags.Album = self.Feed.Title
+	tags.Artist = self.Feed.Author
+	tags.ArtistSort = ""
+	tags.Genre = Genre
+	tags.Description = self.Episode.Description
+	tags.Published = self.Episode.Published
+
+	if tags.Artist == "" {
+		tags.Artist = self.Feed.Title
+	}
+
+	if self.Episode.Published != 0 {
+		tags.Year = time.Unix(self.Episode.Published, 0).UTC().Year()
+	}
+
+	if tags.Length == 0 {
+		tags.Length = self.Episode.Length
+	}
+
+	return tags, nil
+}
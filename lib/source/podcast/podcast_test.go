@@ -0,0 +1,205 @@
+package podcast
+
+import (
+	"context"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/source"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const rssFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>Test Cast</title>
+	<itunes:author>Host</itunes:author>
+	<item>
+		<title>First</title>
+		<guid>ep1</guid>
+		<pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate>
+		<description>The first&nbsp;episode.</description>
+		<itunes:duration>1:02:03</itunes:duration>
+		<enclosure url="%[1]s/ep1.mp3" type="audio/mpeg" />
+	</item>
+	<item>
+		<title>Third</title>
+		<guid>ep3</guid>
+		<pubDate>Wed, 04 Jan 2006 15:04:05 +0000</pubDate>
+		<enclosure url="%[1]s/ep3.mp3" type="audio/mpeg" />
+	</item>
+	<item>
+		<title>Second</title>
+		<guid>ep2</guid>
+		<pubDate>Tue, 03 Jan 2006 15:04:05 +0000</pubDate>
+		<description>The second episode.</description>
+		<enclosure url="%[1]s/ep2.mp3" type="audio/mpeg" />
+	</item>
+	<item>
+		<title>Show notes only</title>
+	</item>
+</channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Atom Cast</title>
+	<author><name>Writer</name></author>
+	<entry>
+		<id>urn:a1</id>
+		<title>Entry</title>
+		<updated>2006-01-02T15:04:05Z</updated>
+		<summary>Summary.</summary>
+		<link rel="alternate" href="http://example.com/a1" />
+		<link rel="enclosure" href="http://example.com/a1.ogg" />
+	</entry>
+</feed>`
+
+func TestParse(t *testing.T) {
+	feed, err := Parse(strings.NewReader(fmt.Sprintf(rssFeed, "http://x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if feed.Title != "Test Cast" || feed.Author != "Host" {
+		t.Errorf("Got feed %q by %q.", feed.Title, feed.Author)
+	}
+
+	var titles []string
+	for _, e := range feed.Episodes {
+		titles = append(titles, e.Title)
+	}
+
+	if strings.Join(titles, ",") != "Third,Second,First" {
+		t.Errorf("Want episodes latest first, got %v.", titles)
+	}
+
+	first := feed.Episodes[2]
+	if first.Length != 3723 || first.Published != 1136214245 ||
+		first.Description != "The first episode." {
+		t.Errorf("Got %+v.", first)
+	}
+
+	feed, err = Parse(strings.NewReader(atomFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feed.Episodes) != 1 || feed.Author != "Writer" ||
+		feed.Episodes[0].URL != "http://example.com/a1.ogg" ||
+		feed.Episodes[0].Published != 1136214245 {
+		t.Errorf("Got %+v.", feed)
+	}
+
+	if _, err := Parse(strings.NewReader("<html></html>")); err != ErrUnknownFeed {
+		t.Errorf("Want ErrUnknownFeed, got %v.", err)
+	}
+}
+
+// crawl crawls p and returns the episodes by title and the crawl errors.
+func crawl(t *testing.T, p *Podcast) (map[string]*source.TrackTags,
+	[]*source.CrawlError) {
+	tracks := make(chan source.TrackInfo)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- p.Crawl(context.Background(), tracks)
+		close(tracks)
+	}()
+
+	episodes := make(map[string]*source.TrackTags)
+	var errs []*source.CrawlError
+
+	for ti := range tracks {
+		if ce, ok := ti.(*source.CrawlError); ok {
+			errs = append(errs, ce)
+			continue
+		}
+
+		tags, err := ti.Tags()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		episodes[tags.Title] = tags
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	return episodes, errs
+}
+
+func TestCrawl(t *testing.T) {
+	downloads := 0
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			fmt.Fprintf(w, rssFeed, ts.URL)
+		case "/ep1.mp3", "/ep2.mp3", "/ep3.mp3":
+			downloads++
+			fmt.Fprint(w, "audio of "+r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+
+	p := New(dir, []string{ts.URL + "/feed.xml", ts.URL + "/gone.xml"},
+		[]string{"mp3"}, ts.Client())
+	p.Latest = 2
+
+	episodes, errs := crawl(t, p)
+
+	if downloads != 2 || len(episodes) != 2 {
+		t.Fatalf("Want the 2 latest episodes, got %d downloads and %v.",
+			downloads, episodes)
+	}
+
+	second := episodes["Second"]
+	if second == nil || second.Album != "Test Cast" ||
+		second.Artist != "Host" || second.Genre != Genre ||
+		second.Year != 2006 || second.Published != 1136300645 ||
+		second.Description != "The second episode." {
+		t.Errorf("Got %+v.", second)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "404") {
+		t.Errorf("Want crawl error of the missing feed, got %v.", errs)
+	}
+
+	// episodes are downloaded once and crawled with their metadata later on
+	episodes, _ = crawl(t, New(dir, p.Feeds[:1], p.Filetypes, ts.Client()))
+	if downloads != 3 || len(episodes) != 3 || episodes["First"].Length != 3723 {
+		t.Errorf("Want 3 episodes after 3 downloads, got %d and %v.",
+			downloads, episodes)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"ep.mp3", "ep (2).mp3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"ep.mp3":    "ep (3).mp3",
+		"other.mp3": "other.mp3",
+	} {
+		if got, err := uniqueName(dir, name); err != nil || got != want {
+			t.Errorf("%s: want %s, got %s and %v.", name, want, got, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rawtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+var ErrInvalidMP4 = errors.New("Invalid MP4 file.")
+
+// Chapter is a chapter of a track. Start and End are given in milliseconds
+// from the beginning of the track. An End of 0 means the end of the track.
+type Chapter struct {
+	Title string
+	Start int
+	End   int
+}
+
+// Maximal size of an MP4 box read into memory.
+const maxBoxSize = 1 << 20
+
+// ReadChapters reads the chapter markers of the file at path.
+func ReadChapters(path string) ([]Chapter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ChaptersFrom(f)
+}
+
+// ChaptersFrom reads the chapter markers from r. Chapters are read from the
+// CHAP frames of ID3v2 tags and from the Nero chapter list (chpl) of MP4 files
+// like M4B audiobooks. The chapters are ordered by their start.
+func ChaptersFrom(r io.ReadSeeker) ([]Chapter, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var chapters []Chapter
+	var err error
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		chapters, err = readID3v2Chapters(r)
+	case bytes.Equal(magic[4:], []byte("ftyp")):
+		chapters, err = readMP4Chapters(r)
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].Start < chapters[j].Start
+	})
+
+	return chapters, err
+}
+
+// readID3v2Chapters reads the CHAP frames of an ID3v2 tag. The title of a
+// chapter is read from its embedded TIT2 frame.
+func readID3v2Chapters(r io.Reader) ([]Chapter, error) {
+	tag, version, err := readID3v2Tag(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []Chapter
+
+	err = eachID3v2Frame(tag, version, func(id string, data []byte) {
+		if id != "CHAP" {
+			return
+		}
+
+		// element ID, start and end time, start and end offset
+		i := bytes.IndexByte(data, 0)
+		if i < 0 || len(data) < i+17 {
+			return
+		}
+
+		c := Chapter{
+			Start: int(binary.BigEndian.Uint32(data[i+1:])),
+			End:   int(binary.BigEndian.Uint32(data[i+5:])),
+		}
+
+		// errors of the embedded frames just leave the title empty
+		eachID3v2Frame(data[i+17:], version, func(id string, data []byte) {
+			if id == "TIT2" && len(data) > 0 {
+				if values := decodeText(data[0], data[1:]); len(values) > 0 {
+					c.Title = values[0]
+				}
+			}
+		})
+
+		chapters = append(chapters, c)
+	})
+
+	return chapters, err
+}
+
+// readMP4Chapters reads the Nero chapter list at moov/udta/chpl of an MP4 file.
+// Chapters given by a QuickTime chapter track aren't read.
+func readMP4Chapters(r io.ReadSeeker) ([]Chapter, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	chpl, err := findMP4Box(r, 0, size, "moov", "udta", "chpl")
+	if err != nil || chpl == nil {
+		return nil, err
+	}
+
+	// version, flags and for version 1 a reserved field
+	offset := 4
+	if len(chpl) > 0 && chpl[0] == 1 {
+		offset += 4
+	}
+
+	if len(chpl) <= offset {
+		return nil, ErrInvalidMP4
+	}
+
+	n := int(chpl[offset])
+	b := chpl[offset+1:]
+
+	chapters := make([]Chapter, 0, n)
+
+	for i := 0; i < n; i++ {
+		if len(b) < 9 || len(b) < 9+int(b[8]) {
+			return nil, ErrInvalidMP4
+		}
+
+		// the start is given in units of 100 ns
+		start := binary.BigEndian.Uint64(b)
+		titleLen := int(b[8])
+
+		chapters = append(chapters, Chapter{
+			Title: string(b[9 : 9+titleLen]),
+			Start: int(start / 10000),
+		})
+
+		b = b[9+titleLen:]
+	}
+
+	// a chapter ends where the next one starts
+	for i := 0; i+1 < len(chapters); i++ {
+		chapters[i].End = chapters[i+1].Start
+	}
+
+	return chapters, nil
+}
+
+// findMP4Box returns the content of the box at path within the boxes between
+// the offsets start and end of r. If there is no such box, nil is returned.
+func findMP4Box(r io.ReadSeeker, start, end int64, path ...string) ([]byte, error) {
+	header := make([]byte, 16)
+
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+
+		switch size {
+		case 0:
+			// the box extends to the end
+			size = end - pos
+		case 1:
+			if _, err := io.ReadFull(r, header[8:]); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:]))
+			headerLen = 16
+		}
+
+		if size < headerLen || pos+size > end {
+			return nil, ErrInvalidMP4
+		}
+
+		if typ == path[0] {
+			if len(path) > 1 {
+				return findMP4Box(r, pos+headerLen, pos+size, path[1:]...)
+			}
+
+			if size-headerLen > maxBoxSize {
+				return nil, ErrInvalidMP4
+			}
+
+			content := make([]byte, size-headerLen)
+			_, err := io.ReadFull(r, content)
+
+			return content, err
+		}
+
+		pos += size
+	}
+
+	return nil, nil
+}
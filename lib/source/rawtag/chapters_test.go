@@ -0,0 +1,73 @@
+package rawtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// chapFrame builds an ID3v2.3 CHAP frame with an embedded title.
+func chapFrame(id string, start, end uint32, title string) []byte {
+	data := append([]byte(id), 0)
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times, start)
+	binary.BigEndian.PutUint32(times[4:], end)
+	data = append(data, times...)
+	data = append(data, id3Frame("TIT2", append([]byte{3}, title...))...)
+	return id3Frame("CHAP", data)
+}
+
+// mp4Box builds an MP4 box around the content.
+func mp4Box(typ string, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	return append(append(b, typ...), body...)
+}
+
+func TestID3v2Chapters(t *testing.T) {
+	data := id3Tag(3,
+		id3Frame("TIT2", append([]byte{3}, "Book"...)),
+		chapFrame("ch1", 60000, 120000, "Two"),
+		chapFrame("ch0", 0, 60000, "One"),
+	)
+
+	chapters, err := ChaptersFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Chapter{{"One", 0, 60000}, {"Two", 60000, 120000}}
+	if !reflect.DeepEqual(chapters, want) {
+		t.Errorf("Want: %v, Got: %v", want, chapters)
+	}
+}
+
+func TestMP4Chapters(t *testing.T) {
+	chpl := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2}
+	for i, title := range []string{"Intro", "Chapter 1"} {
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(i)*90*1e7)
+		chpl = append(chpl, start...)
+		chpl = append(chpl, byte(len(title)))
+		chpl = append(chpl, title...)
+	}
+
+	data := bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("M4B ")),
+		mp4Box("mdat", make([]byte, 100)),
+		mp4Box("moov", mp4Box("mvhd", make([]byte, 20)),
+			mp4Box("udta", mp4Box("chpl", chpl))),
+	}, nil)
+
+	chapters, err := ChaptersFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Chapter{{"Intro", 0, 90000}, {"Chapter 1", 90000, 0}}
+	if !reflect.DeepEqual(chapters, want) {
+		t.Errorf("Want: %v, Got: %v", want, chapters)
+	}
+}
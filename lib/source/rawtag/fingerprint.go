@@ -0,0 +1,190 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rawtag
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Number of bytes hashed at the beginning and at the end of the audio data.
+const fingerprintChunk = 64 << 10
+
+// Fingerprint returns a fingerprint of the audio data of the file at path. See
+// FingerprintFrom.
+func Fingerprint(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return FingerprintFrom(f, info.Size())
+}
+
+// FingerprintFrom returns a fingerprint of the audio data of r, that has the
+// length size. Tags are left out, so the fingerprint doesn't change when a file
+// is retagged. The fingerprint is a hash of the length of the audio data and
+// of its first and last 64 KiB.
+//
+// Without audio data the fingerprint is empty, as it would be the same for all
+// such files.
+func FingerprintFrom(r io.ReaderAt, size int64) (string, error) {
+	start, end, err := audioRegion(r, size)
+	if err != nil {
+		return "", err
+	}
+
+	if end <= start {
+		return "", nil
+	}
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%d\n", end-start)
+
+	head := end - start
+	if head > fingerprintChunk {
+		head = fingerprintChunk
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(r, start, head)); err != nil {
+		return "", err
+	}
+
+	tail := end - start - head
+	if tail > fingerprintChunk {
+		tail = fingerprintChunk
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(r, end-tail, tail)); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// audioRegion returns the offsets of the beginning and the end of the audio
+// data of r, that has the length size. Leading ID3v2 tags, FLAC metadata
+// blocks, Ogg header pages and a trailing ID3v1 tag are skipped.
+func audioRegion(r io.ReaderAt, size int64) (start, end int64, err error) {
+	end = size
+
+	b := make([]byte, 27)
+
+	// read reads n bytes at offset off into b. Reading beyond end is no error,
+	// but returns false.
+	read := func(off int64, n int) (bool, error) {
+		if off < 0 || off+int64(n) > end {
+			return false, nil
+		}
+
+		if _, err := r.ReadAt(b[:n], off); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	// trailing ID3v1 tag
+	if ok, err := read(end-128, 3); err != nil {
+		return 0, 0, err
+	} else if ok && bytes.Equal(b[:3], []byte("TAG")) {
+		end -= 128
+	}
+
+	// leading ID3v2 tags, there may be more than one
+	for {
+		ok, err := read(start, 10)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if !ok || !bytes.Equal(b[:3], []byte("ID3")) {
+			break
+		}
+
+		start += 10 + int64(syncsafe(b[6:10]))
+
+		// footer present
+		if b[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+
+	ok, err := read(start, 4)
+	if err != nil || !ok {
+		return start, end, err
+	}
+
+	switch {
+	case bytes.Equal(b[:4], []byte("fLaC")):
+		start += 4
+
+		for {
+			ok, err := read(start, 4)
+			if err != nil || !ok {
+				return start, end, err
+			}
+
+			start += 4 + (int64(b[1])<<16 | int64(b[2])<<8 | int64(b[3]))
+
+			if b[0]&0x80 != 0 {
+				break
+			}
+		}
+	case bytes.Equal(b[:4], []byte("OggS")):
+		// header packets end on pages with granule position 0, pages
+		// without finished packet have -1
+		for {
+			ok, err := read(start, 27)
+			if err != nil || !ok || !bytes.Equal(b[:4], []byte("OggS")) {
+				return start, end, err
+			}
+
+			granule := binary.LittleEndian.Uint64(b[6:14])
+			if granule != 0 && granule != ^uint64(0) {
+				break
+			}
+
+			segments := make([]byte, b[26])
+			if _, err := r.ReadAt(segments, start+27); err != nil {
+				return 0, 0, err
+			}
+
+			start += 27 + int64(len(segments))
+			for _, s := range segments {
+				start += int64(s)
+			}
+		}
+	}
+
+	if start > end {
+		start = end
+	}
+
+	return start, end, nil
+}
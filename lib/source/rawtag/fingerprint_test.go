@@ -0,0 +1,39 @@
+package rawtag
+
+import (
+	"bytes"
+	"testing"
+)
+
+func fingerprint(t *testing.T, data []byte) string {
+	fp, err := FingerprintFrom(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fp
+}
+
+func TestFingerprintIgnoresTags(t *testing.T) {
+	audio := bytes.Repeat([]byte("\xff\xfbaudio"), 30000)
+
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	plain := fingerprint(t, audio)
+	tagged := fingerprint(t, append(append(id3Tag(3,
+		id3Frame("TIT2", []byte("\x00Title"))), audio...), id3v1...))
+
+	if plain != tagged {
+		t.Errorf("Tags changed fingerprint: %s != %s", plain, tagged)
+	}
+
+	changed := append([]byte{}, audio...)
+	changed[len(changed)-1] = 0
+	if fingerprint(t, changed) == plain {
+		t.Errorf("Different audio data has the same fingerprint.")
+	}
+
+	if fp := fingerprint(t, id3v1); fp != "" {
+		t.Errorf("No audio data has the fingerprint %s.", fp)
+	}
+}
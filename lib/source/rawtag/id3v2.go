@@ -0,0 +1,259 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rawtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+var ErrInvalidID3v2 = errors.New("Invalid ID3v2 tag.")
+
+// ID3v2 frames that are mapped to Vorbis comment field names. ID3v2.2 uses
+// three character frame IDs.
+var id3v2Names = map[string]string{
+	"TIT2": "TITLE", "TT2": "TITLE",
+	"TPE1": "ARTIST", "TP1": "ARTIST",
+	"TPE2": "ALBUMARTIST", "TP2": "ALBUMARTIST",
+	"TALB": "ALBUM", "TAL": "ALBUM",
+	"TCON": "GENRE", "TCO": "GENRE",
+	"TSOP": "ARTISTSORT", "TSP": "ARTISTSORT",
+	"TSO2": "ALBUMARTISTSORT", "TS2": "ALBUMARTISTSORT",
+	"TSOA": "ALBUMSORT", "TSA": "ALBUMSORT",
+	"TSOT": "TITLESORT", "TST": "TITLESORT",
+}
+
+// syncsafe decodes a 28 bit integer stored in 4 bytes of 7 bits each.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 |
+		int(b[3]&0x7f)
+}
+
+// unsynchronise reverts the unsynchronisation scheme, that inserts a zero byte
+// after every 0xff.
+func unsynchronise(b []byte) []byte {
+	return bytes.Replace(b, []byte{0xff, 0x00}, []byte{0xff}, -1)
+}
+
+// readID3v2Tag reads an ID3v2.2, ID3v2.3 or ID3v2.4 tag from r. It returns
+// the frames of the tag without extended header and the major version.
+func readID3v2Tag(r io.Reader) ([]byte, byte, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	version := header[3]
+	flags := header[5]
+
+	if version < 2 || version > 4 {
+		return nil, 0, ErrInvalidID3v2
+	}
+
+	tag := make([]byte, syncsafe(header[6:10]))
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, 0, err
+	}
+
+	// ID3v2.4 unsynchronises on frame level
+	if flags&0x80 != 0 && version < 4 {
+		tag = unsynchronise(tag)
+	}
+
+	// skip extended header
+	if flags&0x40 != 0 && version > 2 {
+		if len(tag) < 4 {
+			return nil, 0, ErrInvalidID3v2
+		}
+
+		size := int(binary.BigEndian.Uint32(tag))
+		if version == 4 {
+			size = syncsafe(tag)
+		} else {
+			size += 4
+		}
+
+		if size > len(tag) {
+			return nil, 0, ErrInvalidID3v2
+		}
+
+		tag = tag[size:]
+	}
+
+	return tag, version, nil
+}
+
+// eachID3v2Frame calls f with the ID and the data of every frame in tag, that
+// are frames of an ID3v2 tag of the given version. Compressed and encrypted
+// frames are skipped.
+func eachID3v2Frame(tag []byte, version byte, f func(id string, data []byte)) error {
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+
+		var size int
+		var frameFlags byte
+
+		switch version {
+		case 2:
+			size = int(tag[3])<<16 | int(tag[4])<<8 | int(tag[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(tag[4:8]))
+			frameFlags = tag[9]
+		case 4:
+			size = syncsafe(tag[4:8])
+			frameFlags = tag[9]
+		}
+
+		if size > len(tag)-headerLen {
+			return ErrInvalidID3v2
+		}
+
+		data := tag[headerLen : headerLen+size]
+		tag = tag[headerLen+size:]
+
+		// skip compressed and encrypted frames
+		if (version == 3 && frameFlags&0xc0 != 0) ||
+			(version == 4 && frameFlags&0x0c != 0) {
+			continue
+		}
+
+		if version == 4 {
+			// data length indicator
+			if frameFlags&0x01 != 0 {
+				if len(data) < 4 {
+					continue
+				}
+				data = data[4:]
+			}
+			if frameFlags&0x02 != 0 {
+				data = unsynchronise(data)
+			}
+		}
+
+		f(id, data)
+	}
+
+	return nil
+}
+
+// readID3v2 reads the text frames of an ID3v2.2, ID3v2.3 or ID3v2.4 tag.
+func readID3v2(r io.Reader) (Fields, error) {
+	tag, version, err := readID3v2Tag(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(Fields)
+
+	err = eachID3v2Frame(tag, version, func(id string, data []byte) {
+		if id[0] != 'T' || len(data) == 0 {
+			return
+		}
+
+		values := decodeText(data[0], data[1:])
+
+		if id == "TXXX" || id == "TXX" {
+			// first value is the description
+			if len(values) < 2 {
+				return
+			}
+			for _, v := range values[1:] {
+				fields.add(values[0], v)
+			}
+			return
+		}
+
+		name, ok := id3v2Names[id]
+		if !ok {
+			name = id
+		}
+
+		for _, v := range values {
+			fields.add(name, v)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// decodeText decodes the text of a text frame in the given encoding. The text
+// may consist of several values separated by null characters.
+func decodeText(encoding byte, b []byte) []string {
+	var s string
+
+	switch encoding {
+	case 0:
+		// ISO-8859-1 maps directly to the first 256 code points
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	case 1, 2:
+		s = decodeUTF16(encoding, b)
+	case 3:
+		s = string(b)
+	default:
+		return nil
+	}
+
+	s = strings.TrimRight(s, "\x00")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\x00")
+}
+
+// decodeUTF16 decodes UTF-16 text. With encoding 1 every value starts with a
+// byte order mark, encoding 2 is big endian without byte order mark.
+func decodeUTF16(encoding byte, b []byte) string {
+	var order binary.ByteOrder = binary.BigEndian
+
+	u := make([]uint16, 0, len(b)/2)
+
+	for i := 0; i+1 < len(b); i += 2 {
+		c := order.Uint16(b[i:])
+
+		if encoding == 1 {
+			switch c {
+			case 0xfeff:
+				continue
+			case 0xfffe:
+				// byte order mark read in wrong order
+				order = binary.LittleEndian
+				continue
+			}
+		}
+
+		u = append(u, c)
+	}
+
+	return string(utf16.Decode(u))
+}
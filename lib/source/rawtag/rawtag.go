@@ -0,0 +1,86 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The rawtag package reads tag fields, that are not accessible through the C
+// interface of TagLib, directly from ID3v2 tags and Vorbis comments (Ogg and
+// FLAC).
+//
+// Field names follow the Vorbis comment convention, so ID3v2 frames of known
+// meaning are mapped to them, e.g. TSOP to ARTISTSORT. Other frames keep their
+// frame ID and user defined TXXX frames their description.
+package rawtag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+var ErrUnknownFormat = errors.New("Unknown tag format.")
+
+// Fields maps upper case field names to their values.
+type Fields map[string][]string
+
+// Get returns the first value of field name or an empty string.
+func (self Fields) Get(name string) string {
+	if v := self[strings.ToUpper(name)]; len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// add appends value to the field name.
+func (self Fields) add(name, value string) {
+	name = strings.ToUpper(name)
+	self[name] = append(self[name], value)
+}
+
+// Read reads the tag fields of the file at path. The format is detected by the
+// content of the file.
+func Read(path string) (Fields, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadFrom(f)
+}
+
+// ReadFrom reads tag fields from r.
+func ReadFrom(r io.Reader) (Fields, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	// put the magic bytes back in front
+	r = io.MultiReader(bytes.NewReader(magic), r)
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("ID3")):
+		return readID3v2(r)
+	case bytes.Equal(magic, []byte("OggS")):
+		return readOgg(r)
+	case bytes.Equal(magic, []byte("fLaC")):
+		return readFLAC(r)
+	}
+
+	return nil, ErrUnknownFormat
+}
@@ -0,0 +1,136 @@
+package rawtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// id3Frame builds an ID3v2.3 frame.
+func id3Frame(id string, data []byte) []byte {
+	b := []byte(id)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(data)))
+	b = append(b, size...)
+	b = append(b, 0, 0)
+	return append(b, data...)
+}
+
+// id3Tag builds an ID3v2 tag with the given version around the frames.
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	size := len(body)
+	b := []byte{'I', 'D', '3', version, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f),
+		byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(b, body...)
+}
+
+// vorbisComment builds a Vorbis comment.
+func vorbisComment(comments ...string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(6))
+	buf.WriteString("vendor")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(c)))
+		buf.WriteString(c)
+	}
+	return buf.Bytes()
+}
+
+// oggPage builds an Ogg page containing the packets.
+func oggPage(packets ...[]byte) []byte {
+	var segments, data []byte
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		data = append(data, p...)
+	}
+
+	b := append([]byte("OggS"), make([]byte, 22)...)
+	b = append(b, byte(len(segments)))
+	b = append(b, segments...)
+	return append(b, data...)
+}
+
+func check(t *testing.T, data []byte, want map[string]string) {
+	fields, err := ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range want {
+		if got := fields.Get(k); got != v {
+			t.Errorf("%s: Want: %q, Got: %q", k, v, got)
+		}
+	}
+}
+
+func TestID3v23(t *testing.T) {
+	// UTF-16 little endian with byte order mark
+	utf16 := []byte{1, 0xff, 0xfe}
+	for _, r := range "Ärzte, Die" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+
+	data := id3Tag(3,
+		id3Frame("TPE1", append([]byte{0}, "Die \xc4rzte"...)),
+		id3Frame("TSOP", utf16),
+		id3Frame("TXXX", append([]byte{3}, "MyField\x00value"...)),
+	)
+
+	check(t, data, map[string]string{
+		"ARTIST":     "Die Ärzte",
+		"ARTISTSORT": "Ärzte, Die",
+		"myfield":    "value",
+	})
+}
+
+func TestID3v24MultipleValues(t *testing.T) {
+	data := id3Tag(4, id3Frame("TCON", append([]byte{3}, "Rock\x00Pop"...)))
+
+	fields, err := ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g := fields["GENRE"]; len(g) != 2 || g[0] != "Rock" || g[1] != "Pop" {
+		t.Errorf("Want: [Rock Pop], Got: %v", g)
+	}
+}
+
+func TestOgg(t *testing.T) {
+	long := string(bytes.Repeat([]byte("x"), 600))
+	comment := append([]byte("\x03vorbis"),
+		vorbisComment("ARTIST=Björk", "artistsort=Bjork", "COMMENT="+long)...)
+
+	data := oggPage([]byte("\x01vorbis-identification"), comment)
+
+	check(t, data, map[string]string{
+		"ARTISTSORT": "Bjork",
+		"COMMENT":    long,
+	})
+}
+
+func TestFLAC(t *testing.T) {
+	comment := vorbisComment("ARTISTSORT=Beatles, The")
+
+	data := []byte("fLaC")
+	// STREAMINFO block
+	data = append(data, 0, 0, 0, 2, 0, 0)
+	data = append(data, 0x84, 0, byte(len(comment)>>8), byte(len(comment)))
+	data = append(data, comment...)
+
+	check(t, data, map[string]string{"ARTISTSORT": "Beatles, The"})
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := ReadFrom(bytes.NewReader([]byte("RIFF....")))
+	if err != ErrUnknownFormat {
+		t.Errorf("Want: %v, Got: %v", ErrUnknownFormat, err)
+	}
+}
@@ -0,0 +1,182 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package rawtag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrInvalidOgg    = errors.New("Invalid Ogg stream.")
+	ErrInvalidFLAC   = errors.New("Invalid FLAC stream.")
+	ErrInvalidVorbis = errors.New("Invalid Vorbis comment.")
+)
+
+// Comment headers are never expected to be larger than this.
+const maxCommentSize = 1 << 24
+
+// readOgg reads the Vorbis comment of an Ogg Vorbis or Ogg Opus stream. It is
+// stored in the second packet of the stream.
+func readOgg(r io.Reader) (Fields, error) {
+	var packet []byte
+	packets := 0
+
+	header := make([]byte, 27)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(header[:4], []byte("OggS")) {
+			return nil, ErrInvalidOgg
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, err
+		}
+
+		for _, size := range segments {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+
+			if packets == 1 {
+				packet = append(packet, data...)
+				if len(packet) > maxCommentSize {
+					return nil, ErrInvalidOgg
+				}
+			}
+
+			// a segment shorter than 255 bytes ends a packet
+			if size < 255 {
+				packets++
+
+				if packets == 2 {
+					return parseOggComment(packet)
+				}
+			}
+		}
+	}
+}
+
+// parseOggComment strips the codec specific header from a comment packet.
+func parseOggComment(packet []byte) (Fields, error) {
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x03vorbis")):
+		return parseVorbisComment(packet[7:])
+	case bytes.HasPrefix(packet, []byte("OpusTags")):
+		return parseVorbisComment(packet[8:])
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// readFLAC reads the Vorbis comment from the metadata blocks of a FLAC stream.
+func readFLAC(r io.Reader) (Fields, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if blockType == 4 {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return nil, err
+			}
+
+			return parseVorbisComment(block)
+		}
+
+		if last {
+			return make(Fields), nil
+		}
+
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseVorbisComment parses the fields of a Vorbis comment.
+func parseVorbisComment(b []byte) (Fields, error) {
+	// next returns the next length prefixed string
+	next := func() ([]byte, error) {
+		if len(b) < 4 {
+			return nil, ErrInvalidVorbis
+		}
+
+		size := binary.LittleEndian.Uint32(b)
+		b = b[4:]
+
+		if uint64(size) > uint64(len(b)) {
+			return nil, ErrInvalidVorbis
+		}
+
+		s := b[:size]
+		b = b[size:]
+
+		return s, nil
+	}
+
+	// vendor string
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	if len(b) < 4 {
+		return nil, ErrInvalidVorbis
+	}
+
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+
+	fields := make(Fields)
+
+	for i := uint32(0); i < count; i++ {
+		comment, err := next()
+		if err != nil {
+			return nil, err
+		}
+
+		kv := strings.SplitN(string(comment), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		fields.add(kv[0], kv[1])
+	}
+
+	return fields, nil
+}
@@ -16,30 +16,122 @@
 
 package source
 
-// Metadata for a track
+import (
+	"context"
+	"io/fs"
+	"strings"
+)
+
+// Chapter of a track. Start and End are given in milliseconds from the
+// beginning of the track. An End of 0 means the end of the track.
+type Chapter struct {
+	Title string
+	Start int
+	End   int
+}
+
+// Metadata for a track. Episodes of podcasts have a description and the Unix
+// time they were published at.
 type TrackTags struct {
-	Path    string
-	Title   string
-	Artist  string
-	Album   string
-	Comment string
-	Genre   string
-	Year    int
-	Track   int
-	Bitrate int
-	Length  int
-}
-
-// Basic information about a track.
+	Path        string
+	Title       string
+	Artist      string
+	ArtistSort  string
+	Album       string
+	Comment     string
+	Genre       string
+	Year        int
+	Track       int
+	Bitrate     int
+	Length      int
+	Chapters    []Chapter
+	Description string
+	Published   int64
+}
+
+// Basic information about a track. A track is identified by the ID of its
+// source and its path within the source. Fingerprint identifies the audio data
+// of the track independent of its path and tags, so moved files can be
+// recognized.
 type TrackInfo interface {
+	Source() string
 	Path() string
 	Mtime() int64
+	Size() int64
 	Tags() (*TrackTags, error)
+	Fingerprint() (string, error)
+}
+
+// CrawlError is sent by a source over the tracks channel instead of a track,
+// if the path couldn't be crawled. The tracks at or below the path are unknown
+// then. It has no tags and no fingerprint.
+type CrawlError struct {
+	source string
+	path   string
+	Err    error
+}
+
+// Constructor.
+func NewCrawlError(source, path string, err error) *CrawlError {
+	return &CrawlError{source: source, path: path, Err: err}
+}
+
+func (self *CrawlError) Source() string {
+	return self.source
+}
+
+func (self *CrawlError) Path() string {
+	return self.path
+}
+
+func (self *CrawlError) Mtime() int64 {
+	return 0
+}
+
+func (self *CrawlError) Size() int64 {
+	return 0
+}
+
+func (self *CrawlError) Tags() (*TrackTags, error) {
+	return nil, self.Err
+}
+
+func (self *CrawlError) Fingerprint() (string, error) {
+	return "", self.Err
+}
+
+func (self *CrawlError) Error() string {
+	return Location(self.source, self.path) + ": " + self.Err.Error()
+}
+
+func (self *CrawlError) Unwrap() error {
+	return self.Err
 }
 
 // Abstract interface for sources of tracks. To implement the interface a method
 // Crawl has to be defined, that sends the tracks of the source over the tracks
-// channel.
+// channel and returns, when all tracks are sent. Paths that can't be crawled
+// are sent as CrawlError. If ctx is cancelled, Crawl should stop as soon as
+// possible and return ctx.Err(). Root describes where the source finds its
+// tracks, e.g. the crawled directory. It is the ID of the source, too.
 type TrackSource interface {
-	Crawl(tracks chan<- TrackInfo, done chan<- bool)
+	Crawl(ctx context.Context, tracks chan<- TrackInfo) error
+	Root() string
+}
+
+// FileSource is a TrackSource whose tracks are the files of a file system. The
+// paths of its tracks are paths within FS.
+type FileSource interface {
+	TrackSource
+	FS() fs.FS
+}
+
+// Location returns a human readable location of the path within the source
+// with the ID source, e.g. the absolute path of a file.
+func Location(source, path string) string {
+	if path == "." || path == "" {
+		return source
+	}
+
+	return strings.TrimSuffix(source, "/") + "/" + path
 }
@@ -0,0 +1,467 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The webdav package provides read-only access to a directory served by WebDAV
+// as fs.FS. Directories are listed by PROPFIND requests and files are read by
+// range requests, so only the parts of a file needed are transferred.
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS is a directory served by WebDAV.
+type FS struct {
+	root   *url.URL
+	client *http.Client
+}
+
+// New returns the directory served by WebDAV at rawurl. Requests are sent by
+// client, or http.DefaultClient if it is nil.
+func New(rawurl string, client *http.Client) (*FS, error) {
+	root, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	root.Path = strings.TrimSuffix(root.Path, "/") + "/"
+
+	return &FS{root: root, client: client}, nil
+}
+
+// url returns the URL of the file name.
+func (self *FS) url(name string) string {
+	u := *self.root
+	if name != "." {
+		u.Path += name
+	}
+
+	return u.String()
+}
+
+// multistatus is the response to a PROPFIND request.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status       string    `xml:"DAV: status"`
+			Collection   *struct{} `xml:"DAV: prop>resourcetype>collection"`
+			Length       string    `xml:"DAV: prop>getcontentlength"`
+			LastModified string    `xml:"DAV: prop>getlastmodified"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop>
+<resourcetype/><getcontentlength/><getlastmodified/>
+</prop></propfind>`
+
+// propfind returns the file name and, if depth is "1", the files in it. The
+// file itself comes first.
+func (self *FS) propfind(op, name, depth string) ([]*fileInfo, error) {
+	req, err := http.NewRequest("PROPFIND", self.url(name),
+		strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case resp.StatusCode == http.StatusForbidden ||
+		resp.StatusCode == http.StatusUnauthorized:
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrPermission}
+	case resp.StatusCode != http.StatusMultiStatus:
+		return nil, &fs.PathError{Op: op, Path: name,
+			Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	// the path of the file itself, to tell it from the files in it
+	own := self.root.Path
+	if name != "." {
+		own += name
+	}
+	own = strings.TrimSuffix(own, "/")
+
+	var info *fileInfo
+	var infos []*fileInfo
+
+	for _, r := range ms.Responses {
+		p, err := url.PathUnescape(r.Href)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		// hrefs may be absolute URLs
+		if u, err := url.Parse(p); err == nil && u.IsAbs() {
+			p = u.Path
+		}
+
+		fi := &fileInfo{name: path.Base(p)}
+
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+
+			fi.dir = ps.Collection != nil
+			fi.size, _ = strconv.ParseInt(ps.Length, 10, 64)
+			fi.modTime, _ = http.ParseTime(ps.LastModified)
+		}
+
+		if strings.TrimSuffix(p, "/") == own {
+			info = fi
+			continue
+		}
+
+		infos = append(infos, fi)
+	}
+
+	if info == nil {
+		return nil, &fs.PathError{Op: op, Path: name,
+			Err: errors.New("missing in response")}
+	}
+
+	info.name = path.Base(name)
+
+	return append([]*fileInfo{info}, infos...), nil
+}
+
+// Stat returns information about the file name.
+func (self *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	infos, err := self.propfind("stat", name, "0")
+	if err != nil {
+		return nil, err
+	}
+
+	return infos[0], nil
+}
+
+// ReadDir reads the directory name and returns its entries sorted by name.
+func (self *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	infos, err := self.propfind("readdir", name, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	if !infos[0].dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name,
+			Err: errors.New("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos)-1)
+	for _, fi := range infos[1:] {
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+// Open opens the file name. Files support io.ReaderAt and io.Seeker,
+// directories fs.ReadDirFile.
+func (self *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	infos, err := self.propfind("open", name, "0")
+	if err != nil {
+		return nil, err
+	}
+
+	if infos[0].dir {
+		return &dir{fs: self, path: name, info: infos[0]}, nil
+	}
+
+	return &file{fs: self, path: name, info: infos[0]}, nil
+}
+
+// fileInfo describes a file of the WebDAV directory.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (self *fileInfo) Name() string       { return self.name }
+func (self *fileInfo) Size() int64        { return self.size }
+func (self *fileInfo) ModTime() time.Time { return self.modTime }
+func (self *fileInfo) IsDir() bool        { return self.dir }
+func (self *fileInfo) Sys() interface{}   { return nil }
+
+func (self *fileInfo) Mode() fs.FileMode {
+	if self.dir {
+		return fs.ModeDir | 0555
+	}
+
+	return 0444
+}
+
+// file is an opened regular file. Sequential reads are streamed from one
+// response, that is requested again only after seeking.
+type file struct {
+	fs     *FS
+	path   string
+	info   *fileInfo
+	offset int64
+
+	// response body streaming the file from bodyOffset on
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+func (self *file) Stat() (fs.FileInfo, error) {
+	return self.info, nil
+}
+
+func (self *file) Close() error {
+	self.closeBody()
+	return nil
+}
+
+// closeBody closes the streamed response, if there is one.
+func (self *file) closeBody() {
+	if self.body != nil {
+		self.body.Close()
+		self.body = nil
+	}
+}
+
+// get requests the file from offset off to its end, or to end if end > 0, and
+// returns the response body starting at off.
+func (self *file) get(off, end int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", self.fs.url(self.path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if end > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := self.fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the range
+		if _, err := io.CopyN(io.Discard, resp.Body, off); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func (self *file) Read(b []byte) (int, error) {
+	if self.offset >= self.info.size || len(b) == 0 {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	if self.body == nil || self.bodyOffset != self.offset {
+		self.closeBody()
+
+		body, err := self.get(self.offset, 0)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: self.path, Err: err}
+		}
+
+		self.body, self.bodyOffset = body, self.offset
+	}
+
+	n, err := self.body.Read(b)
+	self.offset += int64(n)
+	self.bodyOffset += int64(n)
+
+	if err == io.EOF {
+		self.closeBody()
+
+		// reading to the end isn't an error for Read
+		if n > 0 {
+			err = nil
+		}
+	} else if err != nil {
+		self.closeBody()
+		err = &fs.PathError{Op: "read", Path: self.path, Err: err}
+	}
+
+	return n, err
+}
+
+// ReadAt reads len(b) bytes at offset off by a range request.
+func (self *file) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: self.path,
+			Err: errors.New("negative offset")}
+	}
+
+	if off >= self.info.size || len(b) == 0 {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(b))
+	if end > self.info.size {
+		end = self.info.size
+	}
+
+	r, err := self.get(off, end)
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: self.path, Err: err}
+	}
+	defer r.Close()
+
+	n, err := io.ReadFull(r, b[:end-off])
+	if err != nil {
+		return n, &fs.PathError{Op: "read", Path: self.path, Err: err}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (self *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += self.offset
+	case io.SeekEnd:
+		offset += self.info.size
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: self.path,
+			Err: fs.ErrInvalid}
+	}
+
+	self.offset = offset
+
+	return offset, nil
+}
+
+// dir is an opened directory.
+type dir struct {
+	fs      *FS
+	path    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (self *dir) Stat() (fs.FileInfo, error) {
+	return self.info, nil
+}
+
+func (self *dir) Close() error {
+	return nil
+}
+
+func (self *dir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: self.path,
+		Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries of the directory, or all remaining
+// entries if n <= 0.
+func (self *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !self.read {
+		entries, err := self.fs.ReadDir(self.path)
+		if err != nil {
+			return nil, err
+		}
+
+		self.entries = entries
+		self.read = true
+	}
+
+	if n <= 0 {
+		entries := self.entries
+		self.entries = nil
+		return entries, nil
+	}
+
+	if len(self.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(self.entries) {
+		n = len(self.entries)
+	}
+
+	entries := self.entries[:n]
+	self.entries = self.entries[n:]
+
+	return entries, nil
+}
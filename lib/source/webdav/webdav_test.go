@@ -0,0 +1,165 @@
+package webdav
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var files = fstest.MapFS{
+	"a/1.mp3":       {Data: []byte("first track"), ModTime: time.Unix(1e9, 0)},
+	"a/2 b.ogg":     {Data: bytes.Repeat([]byte("x"), 5000)},
+	"c/d/.hidden":   {Data: []byte("hidden")},
+	"c/readme.txt":  {Data: []byte("readme")},
+	"top level.mp3": {Data: []byte("top")},
+}
+
+// davHandler serves fsys below /dav/ with PROPFIND and GET requests only.
+func davHandler(fsys fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dav"), "/")
+		if name == "" {
+			name = "."
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == "GET" {
+			f, _ := fsys.Open(name)
+			defer f.Close()
+			http.ServeContent(w, r, name, info.ModTime(), f.(io.ReadSeeker))
+			return
+		}
+
+		infos := []fs.FileInfo{info}
+		hrefs := []string{r.URL.Path}
+
+		if info.IsDir() && r.Header.Get("Depth") == "1" {
+			entries, _ := fs.ReadDir(fsys, name)
+			for _, e := range entries {
+				i, _ := e.Info()
+				infos = append(infos, i)
+				hrefs = append(hrefs, path.Join(r.URL.Path, e.Name()))
+			}
+		}
+
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`)
+
+		for i, info := range infos {
+			typ := ""
+			if info.IsDir() {
+				typ = "<D:collection/>"
+			}
+
+			// servers escape the hrefs
+			href := strings.Replace(hrefs[i], " ", "%20", -1)
+
+			fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat>
+				<D:prop><D:resourcetype>%s</D:resourcetype>
+				<D:getcontentlength>%d</D:getcontentlength>
+				<D:getlastmodified>%s</D:getlastmodified></D:prop>
+				<D:status>HTTP/1.1 200 OK</D:status></D:propstat>
+				</D:response>`, href, typ, info.Size(),
+				info.ModTime().UTC().Format(http.TimeFormat))
+		}
+
+		fmt.Fprint(w, `</D:multistatus>`)
+	})
+}
+
+func TestFS(t *testing.T) {
+	server := httptest.NewServer(davHandler(files))
+	defer server.Close()
+
+	fsys, err := New(server.URL+"/dav", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(fsys, "a/1.mp3", "a/2 b.ogg", "c/d/.hidden",
+		"top level.mp3"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("a/2 b.ogg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	b := make([]byte, 10)
+	if n, err := f.(io.ReaderAt).ReadAt(b, 4995); n != 5 || err != io.EOF {
+		t.Errorf("Want 5 bytes and EOF at the end, got %d and %v.", n, err)
+	}
+
+	if _, err := fsys.Open("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Want ErrNotExist, got %v.", err)
+	}
+}
+
+func TestSequentialRead(t *testing.T) {
+	for _, ranges := range []bool{true, false} {
+		gets := 0
+
+		dav := davHandler(files)
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					gets++
+					if !ranges {
+						r.Header.Del("Range")
+					}
+				}
+				dav.ServeHTTP(w, r)
+			}))
+
+		fsys, err := New(server.URL+"/dav", server.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fsys.Open("a/2 b.ogg")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// small reads are served by the same response
+		var got bytes.Buffer
+		if _, err := io.CopyBuffer(&got, struct{ io.Reader }{f},
+			make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got.Bytes(), files["a/2 b.ogg"].Data) {
+			t.Errorf("Ranges %v: read wrong data.", ranges)
+		}
+		if gets != 1 {
+			t.Errorf("Ranges %v: want 1 request, got %d.", ranges, gets)
+		}
+
+		// seeking requests the file again
+		f.(io.Seeker).Seek(4990, io.SeekStart)
+		b, err := io.ReadAll(f)
+		if err != nil || len(b) != 10 || gets != 2 {
+			t.Errorf("Ranges %v: after seek got %d bytes, %v and %d requests.",
+				ranges, len(b), err, gets)
+		}
+
+		f.Close()
+		server.Close()
+	}
+}
@@ -17,13 +17,24 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/mokasin/musicrawler/lib/model/helper"
 	"github.com/mokasin/musicrawler/lib/web/env"
 	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"net/http"
 )
 
 type Pairs map[string]interface{}
 
+// Listing is the JSON representation of a page of a listing. NextCursor points
+// to the next page and is empty on the last one.
+type Listing struct {
+	*helper.Pagination
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Items      interface{} `json:"items"`
+}
+
 // Base controller type. A controller needs access to the enviroment (database,
 // router, ...) and has to manage templates.
 type Controller struct {
@@ -69,3 +80,15 @@ func (self *Controller) URL(name string, pairs Pairs) (string, error) {
 
 	return url.String(), nil
 }
+
+// RenderJSON writes data encoded as JSON to w.
+func (self *Controller) RenderJSON(w http.ResponseWriter, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(b)
+}
@@ -19,12 +19,16 @@ package env
 import (
 	"code.google.com/p/gorilla/mux"
 	"github.com/mokasin/musicrawler/lib/database"
+	"io/fs"
 )
 
+// Environment shared by the controllers. Files are the file systems of the
+// sources of the tracks by the IDs of the sources.
 type Environment struct {
 	Db       *database.Database
 	Router   *mux.Router
 	TmplPath string
+	Files    map[string]fs.FS
 }
 
 func New(db *database.Database, directory string) *Environment {
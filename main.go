@@ -17,35 +17,54 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
 	"flag"
 	"fmt"
 	"github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/scanner"
 	"github.com/mokasin/musicrawler/lib/source/filecrawler"
+	"github.com/mokasin/musicrawler/lib/source/podcast"
+	"github.com/mokasin/musicrawler/lib/source/webdav"
 	"github.com/mokasin/musicrawler/model/album"
 	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/book"
+	"github.com/mokasin/musicrawler/model/genre"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/playlist"
+	"github.com/mokasin/musicrawler/model/queue"
+	"github.com/mokasin/musicrawler/model/scan"
+	"github.com/mokasin/musicrawler/model/stats"
 	"github.com/mokasin/musicrawler/model/track"
+	"github.com/mokasin/musicrawler/model/user"
 	"github.com/mokasin/musicrawler/web"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime/pprof"
+	"strings"
 	"syscall"
 	"time"
 )
 
-var supportedFileTypes []string = []string{"mp3", "ogg"}
+// Name of the library of podcast episodes.
+const podcastLibrary = "Podcasts"
+
+var supportedFileTypes []string = []string{"mp3", "ogg", "m4a", "m4b"}
 
 func updateTracks() {
 	var added, updated, errors int
 
-	actionMsg := []string{"-", "M", "A"}
+	actionMsg := []string{"-", "M", "A", "S"}
 
 	statusChannel := make(chan *UpdateStatus, 100)
 	resultChannel := make(chan *UpdateResult)
 
 	timeStart := time.Now()
 
-	go sourceList.Update(statusChannel, resultChannel)
+	go sourceList.Update(context.Background(), statusChannel, resultChannel)
 
 	counter := 0
 	for status := range statusChannel {
@@ -77,10 +96,301 @@ func updateTracks() {
 	}
 	deltaTime := time.Since(timeStart).Seconds()
 
-	fmt.Printf("   Added: %d\tUpdated: %d\tDeleted: %d\tErrors: %d\n",
-		added, updated, r.Deleted, errors)
+	fmt.Printf("   Added: %d\tUpdated: %d\tMoved: %d\tDeleted: %d\tErrors: %d\n",
+		added-int(r.Moved), updated, r.Moved, r.Deleted, errors)
 	fmt.Printf("   Total: %.4f min. %.2f ms per track.\n", deltaTime/60,
 		deltaTime/float64(added+updated)*1000)
+
+	if len(r.Skipped) > 0 {
+		fmt.Printf("   Skipped %d paths, their tracks are kept:\n",
+			len(r.Skipped))
+		for _, p := range r.Skipped {
+			fmt.Println("     ", p)
+		}
+	}
+
+	if errors > 0 && !*vverbosity {
+		fmt.Println("   The errors are listed at /scans.")
+	}
+}
+
+// newCrawler returns a crawler of the library at root. The root is either a
+// local directory, a zip archive or the URL of a directory served by WebDAV.
+func newCrawler(root string) (*filecrawler.FileCrawler, error) {
+	switch {
+	case strings.HasPrefix(root, "http://") ||
+		strings.HasPrefix(root, "https://"):
+		fsys, err := webdav.New(root, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return filecrawler.NewFS(root, fsys, supportedFileTypes), nil
+	case strings.EqualFold(filepath.Ext(root), ".zip"):
+		// the archive stays open as long as the program runs
+		z, err := zip.OpenReader(root)
+		if err != nil {
+			return nil, err
+		}
+
+		return filecrawler.NewFS(root, z, supportedFileTypes), nil
+	}
+
+	return filecrawler.New(root, supportedFileTypes), nil
+}
+
+// scanLibrary returns a function to scan the sources of sourceList in the
+// background. The scan uses its own connection to the database at filename, so
+// it doesn't interfere with the transactions of the webserver. As the update
+// commits its changes in chunks, the webserver can write in between.
+func scanLibrary(filename string) scanner.Func {
+	return func(ctx context.Context, events chan<- *scanner.Event) error {
+		db, err := database.NewDatabase(filename)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		statusChannel := make(chan *UpdateStatus, 100)
+		resultChannel := make(chan *UpdateResult)
+
+		go sourceList.On(db).Update(ctx, statusChannel, resultChannel)
+
+		for s := range statusChannel {
+			events <- &scanner.Event{
+				Path:   s.Path,
+				Action: int(s.Action),
+				Err:    s.Err,
+			}
+		}
+
+		return (<-resultChannel).Err
+	}
+}
+
+// printDuplicates prints all groups of duplicate tracks. The copy suggested to
+// keep is marked with a '*'.
+func printDuplicates(db *database.Database) {
+	groups, err := track.Duplicates(db)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+
+	reasons := map[string]string{
+		track.SameContent: "same audio content",
+		track.SameTags:    "same artist, title and length",
+	}
+
+	for _, g := range groups {
+		first := &g.Copies[0]
+		fmt.Printf("\n%s - %s (%s)\n", first.Artist, first.Title,
+			reasons[g.Reason])
+
+		for _, c := range g.Copies {
+			mark := " "
+			if c.Keep {
+				mark = "*"
+			}
+
+			fmt.Printf("  %s %-5s %4d kbit/s %6s  %s\n", mark, c.Format,
+				c.Bitrate, c.LengthString(), c.Path)
+		}
+	}
+
+	fmt.Printf("\n-> %d groups of duplicates found.\n", len(groups))
+}
+
+// printStats prints the statistics of the library.
+func printStats(db *database.Database) {
+	l, err := stats.Compute(db, stats.TopArtistsNumber, nil)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+
+	fmt.Printf("   Tracks: %d\tAlbums: %d\tArtists: %d\n", l.Tracks, l.Albums,
+		l.Artists)
+	fmt.Printf("   Length: %s\tSize: %s\n", l.LengthString(), l.SizeString())
+
+	if s := l.LastScan; s != nil {
+		fmt.Printf("   Last scan: %s (%v)\n", s.StartedString(), s.Duration())
+		fmt.Printf("   Added: %d\tUpdated: %d\tMoved: %d\tDeleted: %d\t"+
+			"Skipped: %d\tErrors: %d\n", s.Added, s.Updated, s.Moved,
+			s.Deleted, s.Skipped, s.Errors)
+	}
+
+	fmt.Println("\n-> Largest artists:")
+	for _, a := range l.TopArtists {
+		fmt.Printf("   %6d %10s  %s\n", a.Tracks, a.LengthString(), a.Artist)
+	}
+
+	fmt.Println("\n-> Formats:")
+	for _, f := range l.Formats {
+		fmt.Printf("   %6d %10s  %s\n", f.Tracks, f.SizeString(), f.Format)
+	}
+
+	fmt.Println("\n-> Bitrates:")
+	for _, b := range l.Bitrates {
+		fmt.Printf("   %6d %10s  %d kbit/s\n", b.Tracks, b.SizeString(),
+			b.Bitrate)
+	}
+
+	fmt.Println("\n-> Genres:")
+	for _, g := range l.Genres {
+		fmt.Printf("   %6d %10s  %s\n", g.Tracks, g.LengthString(), g.Genre)
+	}
+
+	fmt.Println("\n-> Years:")
+	for _, y := range l.Years {
+		fmt.Printf("   %6d %10s  %d\n", y.Tracks, y.LengthString(), y.Year)
+	}
+}
+
+// patterns are glob patterns given by a repeatable flag. A pattern of the form
+// 'dir=pattern' applies only to the crawled directory dir, others to all.
+type patterns []string
+
+func (self *patterns) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *patterns) Set(value string) error {
+	*self = append(*self, value)
+	return nil
+}
+
+// For returns the patterns that apply to the crawled directory dir.
+func (self patterns) For(dir string) []string {
+	var ps []string
+
+	for _, p := range self {
+		if i := strings.Index(p, "="); i >= 0 {
+			if p[:i] != dir {
+				continue
+			}
+			p = p[i+1:]
+		}
+
+		ps = append(ps, p)
+	}
+
+	return ps
+}
+
+// libraryRoots are the roots of named libraries given by a repeatable flag of
+// the form 'name=root'.
+type libraryRoots []string
+
+func (self *libraryRoots) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *libraryRoots) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("missing library name in '%s'", value)
+	}
+
+	*self = append(*self, value)
+	return nil
+}
+
+// feeds are URLs of podcast feeds given by a repeatable flag.
+type feeds []string
+
+func (self *feeds) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *feeds) Set(value string) error {
+	*self = append(*self, value)
+	return nil
+}
+
+// rebuildDatabase migrates a database created before schemas were versioned
+// by dropping all of its tables and creating them anew. The tracks are indexed
+// again by the next update.
+func rebuildDatabase(db *database.Database) error {
+	fmt.Println("-> Rebuild database of an outdated schema")
+
+	res, err := db.Query(
+		"SELECT name FROM sqlite_master WHERE type = 'table';")
+	if err != nil {
+		return err
+	}
+
+	for _, r := range res {
+		name, _ := r["name"].(string)
+		if strings.HasPrefix(name, "sqlite_") {
+			continue
+		}
+
+		if _, err := db.Execute("DROP TABLE '" + name + "';"); err != nil {
+			return err
+		}
+	}
+
+	return db.CreateTables()
+}
+
+// addArtistTagged migrates a database to the schema telling tagged sort names
+// of artists apart. The tags of all tracks are read again by the next update
+// to find the tagged ones.
+func addArtistTagged(db *database.Database) error {
+	if err := artist.AddTaggedColumn(db); err != nil {
+		return err
+	}
+
+	_, err := db.Execute("UPDATE Track SET filemtime = 0;")
+	return err
+}
+
+// grantAccess grants the user to the library given by grant of the form
+// 'library=user'.
+func grantAccess(db *database.Database, grant string) error {
+	i := strings.Index(grant, "=")
+	if i < 0 {
+		return fmt.Errorf("Invalid grant '%s', want library=user.", grant)
+	}
+
+	u, err := user.ByName(db, grant[i+1:])
+	if err != nil {
+		return fmt.Errorf("Unknown user '%s'.", grant[i+1:])
+	}
+
+	id, err := library.Ensure(db, grant[:i])
+	if err != nil {
+		return err
+	}
+
+	return library.Grant(db, id, u.Id)
+}
+
+// setKinds saves the kinds of the libraries crawled into. The libraries named
+// by audiobooks hold audiobooks, all others music.
+func setKinds(db *database.Database, names []string, audiobooks string) error {
+	books := make(map[string]bool)
+	for _, name := range strings.Split(audiobooks, ",") {
+		books[strings.TrimSpace(name)] = true
+	}
+
+	for _, name := range names {
+		id, err := library.Ensure(db, name)
+		if err != nil {
+			return err
+		}
+
+		kind := library.Music
+		if books[name] {
+			kind = library.Audiobooks
+		}
+
+		if err := library.SetKind(db, id, kind); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 var version string
@@ -93,8 +403,52 @@ func main() {
 	var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	flag.StringVar(&dbFileName, "database", "index.db", "path to database")
 	updateFlag := flag.Bool("u", true, "update database")
+	articles := flag.String("articles", strings.Join(artist.Articles, ","),
+		"comma separated articles ignored when sorting artists")
+
+	genreSeparators := flag.String("genre-separators", genre.Separators,
+		"characters that separate several genres in a genre tag, "+
+			"e.g. \";/\" to split at slashes, too")
+	addUser := flag.String("adduser", "",
+		"add a user with this name, print the token and exit")
+	adminFlag := flag.Bool("admin", false, "user added by -adduser is an admin")
+	grant := flag.String("grant", "",
+		"restrict a library to users, grant a user access by library=user and exit")
+	duplicatesFlag := flag.Bool("duplicates", false,
+		"print duplicate tracks and exit")
+	statsFlag := flag.Bool("stats", false,
+		"print statistics of the library and exit")
+	followSymlinks := flag.Bool("follow-symlinks", false,
+		"follow symlinks to directories while crawling")
+	hiddenFlag := flag.Bool("hidden", false,
+		"crawl hidden files and directories")
+	audiobooks := flag.String("audiobooks", "",
+		"comma separated libraries holding audiobooks grouped by books")
+	var libraries libraryRoots
+	flag.Var(&libraries, "library",
+		"crawl root into the named library, name=root (repeatable)")
+	var subscriptions feeds
+	flag.Var(&subscriptions, "podcast",
+		"subscribe to the podcast feed at this URL (repeatable)")
+	podcastDir := flag.String("podcast-dir", "podcasts",
+		"directory episodes of podcasts are downloaded to")
+	podcastLatest := flag.Int("podcast-latest", 5,
+		"number of latest episodes downloaded per podcast, 0 for all")
+	var include, exclude patterns
+	flag.Var(&include, "include",
+		"crawl only files matching this pattern, [dir=]pattern (repeatable)")
+	flag.Var(&exclude, "exclude",
+		"skip paths matching this pattern, [dir=]pattern (repeatable)")
 	flag.Parse()
 
+	artist.Articles = nil
+	for _, a := range strings.Split(*articles, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			artist.Articles = append(artist.Articles, a)
+		}
+	}
+	genre.Separators = *genreSeparators
+
 	//PROFILER START
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -121,23 +475,108 @@ func main() {
 	mydb.Register(artist.CreateArtistTable)
 	mydb.Register(album.CreateAlbumTable)
 	mydb.Register(track.CreateTrackTable)
+	mydb.Register(genre.CreateGenreTable)
+	mydb.Register(library.CreateLibraryTable)
+	mydb.Register(book.CreateBookTable)
+	mydb.Register(user.CreateUserTable)
+	mydb.Register(play.CreatePlayTable)
+	mydb.Register(queue.CreateQueueTable)
+	mydb.Register(scan.CreateScanTable)
+	mydb.Register(playlist.CreatePlaylistTable)
+
+	// the tables of unversioned databases changed too much to alter them
+	mydb.RegisterMigration(rebuildDatabase)
+	mydb.RegisterMigration(addArtistTagged)
 
 	err = mydb.CreateDatabase()
 	if err != nil && err != database.ErrDatabaseExists {
-		fmt.Println(err)
+		fmt.Println("DATABASE ERROR:", err)
+		return
+	}
+
+	if *addUser != "" {
+		u, err := user.Add(mydb, *addUser, *adminFlag)
+		if err != nil {
+			fmt.Println("ERROR: Could not add user:", err)
+			return
+		}
+
+		fmt.Printf("-> Added user '%s' with token: %s\n", u.Name, u.Token)
+		return
+	}
+
+	if *grant != "" {
+		if err := grantAccess(mydb, *grant); err != nil {
+			fmt.Println("ERROR: Could not grant access:", err)
+			return
+		}
+
+		fmt.Println("-> Granted access:", *grant)
+		return
+	}
+
+	if *duplicatesFlag {
+		printDuplicates(mydb)
+		return
+	}
+
+	if *statsFlag {
+		printStats(mydb)
+		return
 	}
 
 	sourceList = NewSourceList(mydb)
 
+	// roots given as arguments belong to the default library
+	var roots []string
+	for _, dir := range flag.Args() {
+		roots = append(roots, library.Default+"="+dir)
+	}
+	roots = append(roots, libraries...)
+
+	if len(roots) == 0 {
+		roots = []string{library.Default + "=."}
+	}
+
+	// sources are needed by rescans from the webserver, too
+	for _, root := range roots {
+		i := strings.Index(root, "=")
+		name, dir := root[:i], root[i+1:]
+
+		fc, err := newCrawler(dir)
+		if err != nil {
+			fmt.Println("ERROR: Could not open source:", err)
+			return
+		}
+
+		fc.FollowSymlinks = *followSymlinks
+		fc.Hidden = *hiddenFlag
+		fc.Include = include.For(dir)
+		fc.Exclude = exclude.For(dir)
+		sourceList.AddTo(name, fc)
+	}
+
+	// episodes are downloaded by updates
+	if len(subscriptions) > 0 {
+		p := podcast.New(*podcastDir, subscriptions, supportedFileTypes, nil)
+		p.Latest = *podcastLatest
+		sourceList.AddTo(podcastLibrary, p)
+	}
+
+	var names []string
+	for _, name := range sourceList.Libraries() {
+		names = append(names, name)
+	}
+
+	if err := setKinds(mydb, names, *audiobooks); err != nil {
+		fmt.Println("ERROR: Could not set kinds of libraries:", err)
+		return
+	}
+
 	if *updateFlag {
-		if flag.NArg() == 0 {
-			sourceList.Add(filecrawler.New(".", supportedFileTypes))
-			fmt.Println("-> Crawling directory: ./")
-		} else {
-			for i := 0; i < flag.NArg(); i++ {
-				sourceList.Add(filecrawler.New(flag.Arg(i), supportedFileTypes))
-				fmt.Println("-> Crawling directory:", flag.Arg(i))
-			}
+		for _, root := range sourceList.Roots() {
+			fmt.Printf("-> Crawling: %s (%s)\n", root,
+				sourceList.Libraries()[root])
 		}
 
 		fmt.Println("-> Update files.")
@@ -148,7 +587,8 @@ func main() {
 
 	status := make(chan *web.Status, 1000)
 
-	w := web.New(mydb, status, ":8080")
+	w := web.New(mydb, sourceList.Files(), scanner.New(scanLibrary(dbFileName)),
+		status, ":8080")
 	go w.Start()
 
 	fmt.Println("   ...Listening on :8080")
@@ -17,6 +17,7 @@
 package album
 
 import (
+	"fmt"
 	. "github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/database/query"
 )
@@ -25,7 +26,10 @@ func CreateAlbumTable(db *Database) error {
 	_, err := db.Execute(`CREATE TABLE Album
 	(  ID   INTEGER NOT NULL PRIMARY KEY,
 	   name TEXT,
-	   artist_id INTEGER REFERENCES Artist(ID) ON DELETE SET NULL
+	   artist_id INTEGER REFERENCES Artist(ID) ON DELETE SET NULL,
+	   year   INTEGER DEFAULT 0,
+	   added  INTEGER DEFAULT 0,
+	   length INTEGER DEFAULT 0
 	);`)
 
 	if err != nil {
@@ -38,12 +42,77 @@ func CreateAlbumTable(db *Database) error {
 	return err
 }
 
-// Define scheme of album entry.
+// Define scheme of album entry. Year, Added and Length are derived from the
+// album's tracks by UpdateFromTracks.
 type Album struct {
-	Id       int64  `column:"ID" set:"0"`
-	Name     string `column:"name"`
-	ArtistID int64  `column:"artist_id"`
-	Link     string
+	Id       int64  `column:"ID" set:"0" json:"id"`
+	Name     string `column:"name" json:"name"`
+	ArtistID int64  `column:"artist_id" json:"artist_id"`
+	Year     int    `column:"year" set:"0" json:"year"`
+	Added    int64  `column:"added" set:"0" json:"added"`
+	Length   int    `column:"length" set:"0" json:"length"`
+	Link     string `json:"link"`
+}
+
+// AlbumInfo is an album joined with the name of its artist.
+type AlbumInfo struct {
+	Id       int64  `column:"album:ID" set:"0" json:"id"`
+	Name     string `column:"album:name" json:"name"`
+	ArtistID int64  `column:"album:artist_id" json:"artist_id"`
+	Artist   string `column:"artist:name" json:"artist"`
+	Year     int    `column:"album:year" json:"year"`
+	Added    int64  `column:"album:added" json:"added"`
+	Length   int    `column:"album:length" json:"length"`
+	Link     string `json:"link"`
+}
+
+// UpdateFromTracks derives year, date of adding and length of all albums
+// from their tracks. The year of an album is the most common known year of its
+// tracks, on a tie the earliest one.
+func UpdateFromTracks(db *Database) error {
+	_, err := db.Execute(`UPDATE Album SET
+	year = IFNULL((SELECT year FROM Track
+		WHERE album_id = Album.ID AND year > 0
+		GROUP BY year ORDER BY COUNT(*) DESC, year ASC LIMIT 1), 0),
+	added = IFNULL((SELECT MIN(added) FROM Track
+		WHERE album_id = Album.ID), 0),
+	length = IFNULL((SELECT SUM(length) FROM Track
+		WHERE album_id = Album.ID), 0);`)
+
+	return err
+}
+
+// YearInfo is a year with the number of albums released in it.
+type YearInfo struct {
+	Year   int    `column:"album:year" json:"year"`
+	Albums int    `column:"COUNT(DISTINCT album:ID)" json:"albums"`
+	Link   string `json:"link"`
+}
+
+// DecadeInfo is a decade with the number of albums released in it. The decade
+// is given by its first year.
+type DecadeInfo struct {
+	Decade int    `column:"album:year/10*10" json:"decade"`
+	Albums int    `column:"COUNT(DISTINCT album:ID)" json:"albums"`
+	Link   string `json:"link"`
+}
+
+// YearsQuery returns a prepared Query to query all years with the number of
+// albums released in it. Albums of unknown year are left out.
+func YearsQuery(db *Database) *query.Query {
+	return query.New(db, "album").Where("album.year >", 0).GroupBy("album.year")
+}
+
+// DecadesQuery returns a prepared Query to query all decades with the number
+// of albums released in it. Albums of unknown year are left out.
+func DecadesQuery(db *Database) *query.Query {
+	return query.New(db, "album").Where("album.year >", 0).
+		GroupBy("album.year/10*10")
+}
+
+// LengthString returns a nicely formatted string of the album's length.
+func (self *AlbumInfo) LengthString() string {
+	return fmt.Sprintf("%d:%02d", self.Length/60, self.Length%60)
 }
 
 func (self *Album) ArtistQuery(db *Database) *query.Query {
@@ -17,25 +17,158 @@
 package artist
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	. "github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/model/library"
+	"strings"
 )
 
 func CreateArtistTable(db *Database) error {
 	_, err := db.Execute(`CREATE TABLE Artist
-	( ID   INTEGER  NOT NULL PRIMARY KEY,
-	  name TEXT     UNIQUE
+	( ID       INTEGER  NOT NULL PRIMARY KEY,
+	  name     TEXT     UNIQUE,
+	  sortname TEXT,
+	  sortkey  TEXT,
+	  letter   TEXT,
+	  tagged   INTEGER DEFAULT 0
 	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE INDEX 'artist_letter' ON Artist (letter, sortkey);")
+
+	return err
+}
 
+// AddTaggedColumn adds the column telling tagged sort names apart to the
+// artist table of an older schema. All sort names count as derived.
+func AddTaggedColumn(db *Database) error {
+	_, err := db.Execute(
+		"ALTER TABLE Artist ADD COLUMN tagged INTEGER DEFAULT 0;")
 	return err
 }
 
-// Define scheme of artist entry.
+// Define scheme of artist entry. Tagged is 1, if the sort name was tagged and
+// not derived from the name.
 type Artist struct {
-	Id   int64  `column:"ID" set:"0"`
-	Name string `column:"name"`
-	Link string
+	Id       int64  `column:"ID" set:"0" json:"id"`
+	Name     string `column:"name" json:"name"`
+	SortName string `column:"sortname" json:"sortname"`
+	SortKey  string `column:"sortkey" json:"-"`
+	Letter   string `column:"letter" json:"letter"`
+	Tagged   int    `column:"tagged" json:"-"`
+	Link     string `json:"link"`
+}
+
+// Articles are stripped from the beginning of artist names to get their sort
+// names, if no sort name is tagged. They are matched case insensitive.
+var Articles = []string{"The"}
+
+// New returns an artist named name. If sortname is empty, it is derived from
+// name by stripping a leading article. The index letter and the key to sort by
+// are derived from the sort name.
+func New(name, sortname string) *Artist {
+	tagged := 1
+	if strings.TrimSpace(sortname) == "" {
+		sortname = StripArticle(name)
+		tagged = 0
+	}
+
+	return &Artist{
+		Name:     name,
+		SortName: sortname,
+		SortKey:  strings.ToUpper(helper.Fold(strings.TrimSpace(sortname))),
+		Letter:   helper.IndexLetter(sortname),
+		Tagged:   tagged,
+	}
+}
+
+// Upsert adds the artist a, or updates the artist of the same name. A derived
+// sort name doesn't override a tagged one of another track, but replaces a
+// derived one, so it follows changes of Articles.
+//
+// Returns the ID of the inserted or updated artist.
+func Upsert(db *Database, a *Artist) (int64, error) {
+	res, err := db.Query(`INSERT INTO artist
+	  (name, sortname, sortkey, letter, tagged) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+	  sortname = CASE WHEN artist.tagged > excluded.tagged
+	    THEN artist.sortname ELSE excluded.sortname END,
+	  sortkey  = CASE WHEN artist.tagged > excluded.tagged
+	    THEN artist.sortkey ELSE excluded.sortkey END,
+	  letter   = CASE WHEN artist.tagged > excluded.tagged
+	    THEN artist.letter ELSE excluded.letter END,
+	  tagged   = max(artist.tagged, excluded.tagged)
+	RETURNING ID;`,
+		a.Name, a.SortName, a.SortKey, a.Letter, a.Tagged)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(res) == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	id, ok := res[0]["ID"].(int64)
+	if !ok {
+		return 0, fmt.Errorf("Returned ID is no int.")
+	}
+
+	return id, nil
+}
+
+// DeriveSortNames derives the sort names of all artists without tagged sort
+// name from their names again, so they follow changes of Articles.
+func DeriveSortNames(db *Database) error {
+	var artists []Artist
+
+	err := query.New(db, "artist").Where("tagged =", 0).Exec(&artists)
+	if err != nil {
+		return err
+	}
+
+	for i := range artists {
+		a := New(artists[i].Name, "")
+		if a.SortName == artists[i].SortName &&
+			a.SortKey == artists[i].SortKey && a.Letter == artists[i].Letter {
+			continue
+		}
+
+		_, err := db.Execute(
+			"UPDATE artist SET sortname = ?, sortkey = ?, letter = ? WHERE ID = ?;",
+			a.SortName, a.SortKey, a.Letter, artists[i].Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StripArticle removes the first matching of Articles from the beginning of
+// name, e.g.
+//
+// 		"The Beatles" → "Beatles"
+//
+// If nothing would remain, name is returned unchanged.
+func StripArticle(name string) string {
+	for _, a := range Articles {
+		prefix := a + " "
+		if len(name) > len(prefix) &&
+			strings.EqualFold(name[:len(prefix)], prefix) {
+			if s := strings.TrimSpace(name[len(prefix):]); s != "" {
+				return s
+			}
+		}
+	}
+
+	return name
 }
 
 // Albums returns a prepared Query to query the albums of the artist.
@@ -45,29 +178,43 @@ func (self *Artist) AlbumsQuery(db *Database) *query.Query {
 
 var ErrNoEntries = errors.New("No entries in database")
 
-func FirstLetters(db *Database) (alpha, nonalpha string, err error) {
-	// get first letter of artists
-	q := query.New(db, "artist").Order("name")
-	alpha, nonalpha, err = q.Letters("name")
+// letterEntry is an index letter of artists.
+type letterEntry struct {
+	Letter string `column:"artist:letter"`
+}
+
+// FirstLetters returns the index letters of the artists having tracks in the
+// libraries with the IDs ids in order. nil ids contain all libraries. Artists
+// not starting with a letter are indexed by helper.NonAlphaLetter, that comes
+// first.
+func FirstLetters(db *Database, ids []int64) ([]string, error) {
+	q := query.New(db, "artist")
+	if ids != nil {
+		q.Join("album", "artist_id", "", "ID").
+			Join("track", "album_id", "album", "ID")
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var entries []letterEntry
 
+	err := q.GroupBy("artist.letter").Order("artist.letter").Exec(&entries)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	if len(alpha) == 0 && len(nonalpha) == 0 {
-		err = ErrNoEntries
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
 	}
 
-	return
-}
+	letters := make([]string, len(entries))
+	for i := range entries {
+		letters[i] = entries[i].Letter
+	}
 
-var alphabet = []interface{}{
-	"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "K", "L", "M", "N", "O",
-	"P", "Q", "R", "S", "T", "U", "V", "W", "X", "Y", "Z",
+	return letters, nil
 }
 
-func NonAlphaArtists(db *Database) *query.Query {
-	return query.New(db, "artist").WhereIn(
-		"SUBSTR(UPPER(name),1,1) NOT", alphabet...,
-	)
+// LetterQuery returns a prepared Query to query the artists indexed by letter.
+func LetterQuery(db *Database, letter string) *query.Query {
+	return query.New(db, "artist").Where("letter =", letter)
 }
@@ -0,0 +1,337 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The book package groups the tracks of audiobook libraries by books and keeps
+// the positions users resume listening at.
+//
+// The tracks of a book share their album tag. Tracks without album tag are
+// grouped by their folder. Every user has one bookmark per book, that is the
+// position in a track of the book reported last.
+package book
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/track"
+	"path"
+	"time"
+)
+
+var ErrNoBook = errors.New("The track is not part of a book.")
+
+func CreateBookTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Book
+	( ID         INTEGER NOT NULL PRIMARY KEY,
+	  library_id INTEGER REFERENCES Library(ID) ON DELETE CASCADE,
+	  key        TEXT,
+	  title      TEXT,
+	  author     TEXT,
+	  length     INTEGER DEFAULT 0,
+	  added      INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'book_key' ON Book (library_id, key);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`CREATE TABLE Bookmark
+	( ID       INTEGER NOT NULL PRIMARY KEY,
+	  user_id  INTEGER REFERENCES User(ID) ON DELETE CASCADE,
+	  book_id  INTEGER REFERENCES Book(ID) ON DELETE CASCADE,
+	  track_id INTEGER REFERENCES Track(ID) ON DELETE CASCADE,
+	  position INTEGER DEFAULT 0,
+	  updated  INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'bookmark_user' ON Bookmark (user_id, book_id);")
+
+	return err
+}
+
+// Define scheme of book entry. The key identifies the book within its library.
+// Length in seconds and the date of adding are derived from the book's tracks
+// by LinkTracks.
+type Book struct {
+	Id        int64  `column:"ID" set:"0" json:"id"`
+	LibraryID int64  `column:"library_id" json:"library_id"`
+	Key       string `column:"key" json:"-"`
+	Title     string `column:"title" json:"title"`
+	Author    string `column:"author" json:"author"`
+	Length    int    `column:"length" set:"0" json:"length"`
+	Added     int64  `column:"added" set:"0" json:"added"`
+	Link      string `json:"link"`
+}
+
+// LengthString returns the length of the book nicely formatted.
+func (self *Book) LengthString() string {
+	return fmt.Sprintf("%d:%02d:%02d", self.Length/3600, self.Length/60%60,
+		self.Length%60)
+}
+
+// PartsQuery returns a prepared Query to query the tracks of the book in the
+// order they are listened to.
+func (self *Book) PartsQuery(db *Database) *query.Query {
+	return query.New(db, "track").
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		Where("track.book_id =", self.Id).
+		Order("track.tracknumber").
+		Order("track.path")
+}
+
+// Chapter of a track. Start and End are given in milliseconds from the
+// beginning of the track.
+type Chapter struct {
+	Title string `json:"title"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// EncodeChapters encodes chapters to be saved with their track. No chapters
+// are encoded as empty string.
+func EncodeChapters(chapters []Chapter) string {
+	if len(chapters) == 0 {
+		return ""
+	}
+
+	b, _ := json.Marshal(chapters)
+	return string(b)
+}
+
+// DecodeChapters decodes the chapters encoded by EncodeChapters. Chapters
+// without end end with the track, that is length seconds long.
+func DecodeChapters(s string, length int) []Chapter {
+	var chapters []Chapter
+
+	if s == "" || json.Unmarshal([]byte(s), &chapters) != nil {
+		return nil
+	}
+
+	for i := 0; i < len(chapters); i++ {
+		if chapters[i].End == 0 {
+			chapters[i].End = length * 1000
+		}
+	}
+
+	return chapters
+}
+
+// Part is a track of a book with its chapters.
+type Part struct {
+	track.Track
+	RawChapters string    `column:"track:chapters" json:"-"`
+	Chapters    []Chapter `json:"chapters"`
+}
+
+// Define scheme of bookmark entry. The user resumes the book at Position
+// milliseconds into the track. Updated is the Unix time of the last report.
+type Bookmark struct {
+	Id       int64 `column:"ID" set:"0" json:"-"`
+	UserID   int64 `column:"user_id" json:"-"`
+	BookID   int64 `column:"book_id" json:"book_id"`
+	TrackID  int64 `column:"track_id" json:"track_id"`
+	Position int   `column:"position" json:"position"`
+	Updated  int64 `column:"updated" json:"updated"`
+}
+
+// Progress is a book with the bookmark of a user.
+type Progress struct {
+	Id        int64  `column:"book:ID" json:"id"`
+	LibraryID int64  `column:"book:library_id" json:"library_id"`
+	Title     string `column:"book:title" json:"title"`
+	Author    string `column:"book:author" json:"author"`
+	Length    int    `column:"book:length" json:"length"`
+	TrackID   int64  `column:"bookmark:track_id" json:"track_id"`
+	Position  int    `column:"bookmark:position" json:"position"`
+	Updated   int64  `column:"bookmark:updated" json:"updated"`
+	Link      string `json:"link"`
+}
+
+// PositionString returns the position in the track nicely formatted.
+func (self *Progress) PositionString() string {
+	s := self.Position / 1000
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// UpdatedString returns the time of the last report nicely formatted.
+func (self *Progress) UpdatedString() string {
+	return time.Unix(self.Updated, 0).Format("2006-01-02 15:04")
+}
+
+// ProgressQuery returns a prepared Query to query the books the user with ID
+// userID is listening to.
+func ProgressQuery(db *Database, userID int64) *query.Query {
+	return query.New(db, "bookmark").
+		Join("book", "ID", "", "book_id").
+		Where("bookmark.user_id =", userID)
+}
+
+// BookmarkOf returns the bookmark of the user with ID userID in the book with
+// ID bookID. If the user didn't listen to the book, sql.ErrNoRows is returned.
+func BookmarkOf(db *Database, userID, bookID int64) (*Bookmark, error) {
+	var b Bookmark
+
+	err := query.New(db, "bookmark").
+		Where("user_id =", userID).
+		Where("book_id =", bookID).
+		Exec(&b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// SavePosition saves that the user with ID userID resumes the book of the track
+// with ID trackID at position milliseconds into the track. If the track isn't
+// part of a book, ErrNoBook is returned.
+func SavePosition(db *Database, trackID, userID int64, position int) error {
+	var t track.RawTrack
+
+	if err := query.New(db, "track").Find(int(trackID)).Exec(&t); err != nil {
+		return err
+	}
+
+	if t.BookID == 0 {
+		return ErrNoBook
+	}
+
+	_, err := mod.New(db, "bookmark").Upsert(&Bookmark{
+		UserID:   userID,
+		BookID:   t.BookID,
+		TrackID:  trackID,
+		Position: position,
+		Updated:  time.Now().Unix(),
+	}, "user_id", "book_id")
+
+	return err
+}
+
+// bookTrack is a track of an audiobook library not linked to its book yet.
+type bookTrack struct {
+	ID        int64  `column:"track:ID"`
+	LibraryID int64  `column:"track:library_id"`
+	Source    string `column:"track:source"`
+	Path      string `column:"track:path"`
+	AlbumID   int64  `column:"track:album_id"`
+	Album     string `column:"album:name"`
+	Artist    string `column:"artist:name"`
+}
+
+// book returns the book the track belongs to. The book isn't saved.
+func (self *bookTrack) book() *Book {
+	b := &Book{LibraryID: self.LibraryID, Title: self.Album, Author: self.Artist}
+
+	if self.Album != "" {
+		b.Key = fmt.Sprintf("album:%d", self.AlbumID)
+		return b
+	}
+
+	dir := path.Dir(self.Path)
+	b.Key = "dir:" + self.Source + "/" + dir
+
+	b.Title = path.Base(dir)
+	if dir == "." {
+		b.Title = path.Base(self.Source)
+	}
+
+	return b
+}
+
+// Unlink removes the link of the track with ID trackID to its book, so it is
+// linked again by the next LinkTracks.
+func Unlink(db *Database, trackID int64) error {
+	_, err := db.Execute("UPDATE Track SET book_id = 0 WHERE ID = ?;", trackID)
+	return err
+}
+
+// LinkTracks links all tracks of audiobook libraries, that aren't linked yet,
+// to their books. Missing books are added. Tracks of other libraries are
+// unlinked. Length and date of adding of the books are derived from their
+// tracks.
+func LinkTracks(db *Database) error {
+	_, err := db.Execute(`UPDATE Track SET book_id = 0 WHERE book_id <> 0
+	AND library_id NOT IN (SELECT ID FROM Library WHERE kind = ?);`,
+		library.Audiobooks)
+	if err != nil {
+		return err
+	}
+
+	var tracks []bookTrack
+
+	err = query.New(db, "track").
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		WhereInQuery("track.library_id",
+			query.New(db, "library").Where("kind =", library.Audiobooks),
+			"library.ID").
+		Where("track.book_id =", 0).
+		Exec(&tracks)
+	if err != nil {
+		return err
+	}
+
+	mbooks := mod.New(db, "book")
+
+	for i := 0; i < len(tracks); i++ {
+		id, err := mbooks.Upsert(tracks[i].book(), "library_id", "key")
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Execute("UPDATE Track SET book_id = ? WHERE ID = ?;", id,
+			tracks[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Execute(`UPDATE Book SET
+	added = IFNULL((SELECT MIN(added) FROM Track WHERE book_id = Book.ID), 0),
+	length = IFNULL((SELECT SUM(length) FROM Track WHERE book_id = Book.ID), 0);`)
+
+	return err
+}
+
+// DeleteDangling deletes books without tracks and bookmarks of books or tracks
+// that don't exist anymore.
+func DeleteDangling(db *Database) error {
+	_, err := db.Execute(
+		"DELETE FROM Book WHERE ID NOT IN (SELECT book_id FROM Track);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`DELETE FROM Bookmark
+	WHERE book_id NOT IN (SELECT ID FROM Book)
+	OR track_id NOT IN (SELECT ID FROM Track WHERE book_id = Bookmark.book_id);`)
+
+	return err
+}
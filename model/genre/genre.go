@@ -0,0 +1,184 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package genre
+
+import (
+	"database/sql"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"strings"
+)
+
+func CreateGenreTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Genre
+	( ID   INTEGER NOT NULL PRIMARY KEY,
+	  name TEXT    UNIQUE COLLATE NOCASE
+	);`)
+	if err != nil {
+		return err
+	}
+
+	// link table of the many-to-many relation between tracks and genres
+	_, err = db.Execute(`CREATE TABLE TrackGenre
+	( track_id INTEGER REFERENCES Track(ID) ON DELETE CASCADE,
+	  genre_id INTEGER REFERENCES Genre(ID) ON DELETE CASCADE,
+	  PRIMARY KEY (track_id, genre_id)
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE INDEX 'trackgenre_genre' ON TrackGenre (genre_id);")
+
+	return err
+}
+
+// Define scheme of genre entry.
+type Genre struct {
+	Id   int64  `column:"ID" set:"0" json:"id"`
+	Name string `column:"name" json:"name"`
+	Link string `json:"link"`
+}
+
+// GenreInfo is a genre with the number of its tracks.
+type GenreInfo struct {
+	Id     int64  `column:"genre:ID" json:"id"`
+	Name   string `column:"genre:name" json:"name"`
+	Tracks int    `column:"COUNT(trackgenre:track_id)" json:"tracks"`
+	Link   string `json:"link"`
+}
+
+// Define scheme of the link between a track and a genre.
+type TrackGenre struct {
+	TrackID int64 `column:"track_id"`
+	GenreID int64 `column:"genre_id"`
+}
+
+// InfoQuery returns a prepared Query to query all genres with the number of
+// their tracks.
+func InfoQuery(db *Database) *query.Query {
+	return query.New(db, "genre").
+		Join("trackgenre", "genre_id", "", "ID").
+		GroupBy("genre.ID")
+}
+
+// ArtistsQuery returns a prepared Query to query the artists having tracks of
+// the genre.
+func (self *Genre) ArtistsQuery(db *Database) *query.Query {
+	albums := query.New(db, "album").
+		Join("track", "album_id", "", "ID").
+		Join("trackgenre", "track_id", "track", "ID").
+		Where("trackgenre.genre_id =", self.Id)
+
+	return query.New(db, "artist").WhereInQuery("ID", albums, "album.artist_id")
+}
+
+// trackGenre is the raw genre of a track not linked to genres yet.
+type trackGenre struct {
+	ID    int64  `column:"track:ID"`
+	Genre string `column:"track:genre"`
+}
+
+// LinkTracks links all tracks, that aren't linked yet, to the genres parsed
+// from their genre tag. Missing genres are added.
+func LinkTracks(db *Database) error {
+	var tracks []trackGenre
+
+	err := query.New(db, "track").
+		LeftJoin("trackgenre", "track_id", "", "ID").
+		Where("trackgenre.track_id IS", nil).
+		Where("track.genre <>", "").
+		Exec(&tracks)
+	if err != nil {
+		return err
+	}
+
+	mgenres := mod.New(db, "genre")
+
+	// IDs of genres by lower case name
+	ids := make(map[string]int64)
+
+	var links []TrackGenre
+
+	for _, t := range tracks {
+		for _, name := range Parse(t.Genre) {
+			key := strings.ToLower(name)
+
+			id, ok := ids[key]
+			if !ok {
+				id, err = genreID(db, mgenres, name)
+				if err != nil {
+					return err
+				}
+				ids[key] = id
+			}
+
+			links = append(links, TrackGenre{TrackID: t.ID, GenreID: id})
+		}
+	}
+
+	_, err = mod.New(db, "trackgenre").InsertAll(links)
+
+	return err
+}
+
+// genreID returns the ID of the genre named name. It is added, if it doesn't
+// exist yet.
+func genreID(db *Database, mgenres *mod.Mod, name string) (int64, error) {
+	var g Genre
+
+	err := query.New(db, "genre").Where("name =", name).Exec(&g)
+	switch {
+	case err == nil:
+		return g.Id, nil
+	case err != sql.ErrNoRows:
+		return 0, err
+	}
+
+	res, err := mgenres.Insert(&Genre{Name: name})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// Unlink removes the links of the track with ID trackID to its genres, so they
+// are linked again by the next LinkTracks.
+func Unlink(db *Database, trackID int64) error {
+	_, err := db.Execute("DELETE FROM TrackGenre WHERE track_id = ?;", trackID)
+	return err
+}
+
+// DeleteDangling deletes links to tracks that don't exist anymore and genres
+// without tracks.
+func DeleteDangling(db *Database) error {
+	_, err := db.Execute(
+		"DELETE FROM TrackGenre WHERE track_id NOT IN (SELECT ID FROM Track);")
+	if err != nil {
+		return err
+	}
+
+	_, err = mod.New(db, "genre").DeleteWhere(
+		query.New(db, "genre").
+			LeftJoin("trackgenre", "genre_id", "", "ID").
+			Where("trackgenre.genre_id IS", nil))
+
+	return err
+}
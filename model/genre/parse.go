@@ -0,0 +1,148 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package genre
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Separators are the characters genre tags are split at into several genres,
+// like "Rock; Indie". A slash isn't one by default, as it is part of names like
+// "Pop/Funk". Tags are always split at NUL characters, that separate multiple
+// values in ID3v2.4.
+var Separators = ";"
+
+// ID3v1 genres including the Winamp extensions, indexed by their number.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebop", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A Cappella", "Euro-House",
+	"Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore", "Terror",
+	"Indie", "BritPop", "Afro-Punk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover",
+	"Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock",
+	"Baroque", "Bhangra", "Big Beat", "Breakbeat", "Chillout", "Downtempo",
+	"Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo",
+	"Experimental", "Garage", "Global", "IDM", "Illbient", "Industro-Goth",
+	"Jam Band", "Krautrock", "Leftfield", "Lounge", "Math Rock",
+	"New Romantic", "Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance",
+	"Shoegaze", "Space Rock", "Trop Rock", "World Music", "Neoclassical",
+	"Audiobook", "Audio Theatre", "Neue Deutsche Welle", "Podcast",
+	"Indie Rock", "G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// Special references of ID3v2.3 genre tags.
+var id3v2Genres = map[string]string{
+	"RX": "Remix",
+	"CR": "Cover",
+}
+
+// id3v1Genre returns the genre with the number s. If s is no valid number, ok
+// is false.
+func id3v1Genre(s string) (name string, ok bool) {
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || i >= len(id3v1Genres) {
+		return "", false
+	}
+
+	return id3v1Genres[i], true
+}
+
+// Parse splits the genre tag s into genres. Besides splitting at Separators,
+// it resolves references to ID3v1 genres by number in the forms
+//
+// 		"17", "(17)", "(17)Rock", "(17)(79)"
+//
+// Genres are returned only once, compared case insensitive.
+func Parse(s string) []string {
+	var genres []string
+	seen := make(map[string]bool)
+
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+
+		if name == "" || seen[key] {
+			return
+		}
+
+		seen[key] = true
+		genres = append(genres, name)
+	}
+
+	split := func(r rune) bool {
+		return r == 0 || strings.ContainsRune(Separators, r)
+	}
+
+	for _, part := range strings.FieldsFunc(s, split) {
+		part = strings.TrimSpace(part)
+
+		// resolve leading references
+		for strings.HasPrefix(part, "(") && !strings.HasPrefix(part, "((") {
+			end := strings.Index(part, ")")
+			if end < 0 {
+				break
+			}
+
+			ref := part[1:end]
+
+			if name, ok := id3v1Genre(ref); ok {
+				add(name)
+			} else if name, ok := id3v2Genres[ref]; ok {
+				add(name)
+			} else {
+				// no reference but part of the name
+				break
+			}
+
+			part = part[end+1:]
+		}
+
+		// "((" escapes a literal bracket
+		if strings.HasPrefix(part, "((") {
+			part = part[1:]
+		}
+
+		if name, ok := id3v1Genre(strings.TrimSpace(part)); ok {
+			add(name)
+		} else {
+			add(part)
+		}
+	}
+
+	return genres
+}
@@ -0,0 +1,44 @@
+package genre
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseTests = []struct {
+	in   string
+	want []string
+}{
+	{"Rock", []string{"Rock"}},
+	{"Rock; Indie", []string{"Rock", "Indie"}},
+	{"Rock\x00rock;ROCK", []string{"Rock"}},
+	{"Pop/Funk", []string{"Pop/Funk"}},
+	{"(62)", []string{"Pop/Funk"}},
+	{"17", []string{"Rock"}},
+	{"(17)", []string{"Rock"}},
+	{"(17)Rock", []string{"Rock"}},
+	{"(17)(79)", []string{"Rock", "Hard Rock"}},
+	{"(32)Klassik", []string{"Classical", "Klassik"}},
+	{"(RX)", []string{"Remix"}},
+	{"((Pseudo) Jazz", []string{"(Pseudo) Jazz"}},
+	{"(999)", []string{"(999)"}},
+	{" ; ", nil},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range parseTests {
+		if got := Parse(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q). Want: %v, Got: %v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseSeparators(t *testing.T) {
+	defer func(s string) { Separators = s }(Separators)
+	Separators = ";/"
+
+	want := []string{"Rock", "Indie"}
+	if got := Parse("Rock/Indie"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse(%q). Want: %v, Got: %v", "Rock/Indie", want, got)
+	}
+}
@@ -0,0 +1,180 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The library package manages named libraries like "Music" or "Audiobooks".
+// Every track belongs to the library of the source it was crawled from.
+//
+// A library without access list is open to everybody. If users are granted
+// access to a library, only those users and admins can see it.
+package library
+
+import (
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/model/user"
+)
+
+// Name of the library of sources not assigned to a library.
+const Default = "Music"
+
+// Kinds of libraries. The tracks of audiobook libraries are grouped by books.
+const (
+	Music      = "music"
+	Audiobooks = "audiobooks"
+)
+
+func CreateLibraryTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Library
+	( ID   INTEGER NOT NULL PRIMARY KEY,
+	  name TEXT    UNIQUE,
+	  kind TEXT    DEFAULT 'music'
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`CREATE TABLE LibraryUser
+	( ID         INTEGER NOT NULL PRIMARY KEY,
+	  library_id INTEGER REFERENCES Library(ID) ON DELETE CASCADE,
+	  user_id    INTEGER REFERENCES User(ID) ON DELETE CASCADE
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'libraryuser_user' ON LibraryUser (library_id, user_id);")
+
+	return err
+}
+
+// Define scheme of library entry. The kind is set by SetKind.
+type Library struct {
+	Id   int64  `column:"ID" set:"0" json:"id"`
+	Name string `column:"name" json:"name"`
+	Kind string `column:"kind" set:"0" json:"kind"`
+	Link string `json:"link"`
+}
+
+// IsAudiobooks reports whether the library holds audiobooks.
+func (self *Library) IsAudiobooks() bool {
+	return self.Kind == Audiobooks
+}
+
+// Define scheme of access list entry. The user may see the library.
+type LibraryUser struct {
+	Id        int64 `column:"ID" set:"0"`
+	LibraryID int64 `column:"library_id"`
+	UserID    int64 `column:"user_id"`
+}
+
+// Ensure returns the ID of the library named name. The library is added, if
+// it doesn't exist yet.
+func Ensure(db *Database, name string) (int64, error) {
+	return mod.New(db, "library").Upsert(&Library{Name: name}, "name")
+}
+
+// SetKind sets the kind of the library with the ID id.
+func SetKind(db *Database, id int64, kind string) error {
+	_, err := db.Execute("UPDATE Library SET kind = ? WHERE ID = ?;", kind, id)
+	return err
+}
+
+// ByName returns the library named name. If there is no such library,
+// sql.ErrNoRows is returned.
+func ByName(db *Database, name string) (*Library, error) {
+	var l Library
+
+	err := query.New(db, "library").Where("name =", name).Exec(&l)
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// All returns all libraries ordered by name.
+func All(db *Database) ([]Library, error) {
+	var libs []Library
+
+	err := query.New(db, "library").Order("name").Exec(&libs)
+
+	return libs, err
+}
+
+// Grant allows the user with the ID userID to see the library with the ID
+// libraryID. Granting access twice has no effect.
+func Grant(db *Database, libraryID, userID int64) error {
+	_, err := mod.New(db, "libraryuser").InsertIgnore(
+		&LibraryUser{LibraryID: libraryID, UserID: userID})
+
+	return err
+}
+
+// Visible returns the libraries the user u can see ordered by name. A nil user
+// is anonymous and sees only the libraries without access list.
+func Visible(db *Database, u *user.User) ([]Library, error) {
+	libs, err := All(db)
+	if err != nil || (u != nil && u.IsAdmin()) {
+		return libs, err
+	}
+
+	var access []LibraryUser
+
+	err = query.New(db, "libraryuser").Exec(&access)
+	if err != nil {
+		return nil, err
+	}
+
+	restricted := make(map[int64]bool)
+	granted := make(map[int64]bool)
+
+	for _, a := range access {
+		restricted[a.LibraryID] = true
+		if u != nil && a.UserID == u.Id {
+			granted[a.LibraryID] = true
+		}
+	}
+
+	var visible []Library
+
+	for _, l := range libs {
+		if !restricted[l.Id] || granted[l.Id] {
+			visible = append(visible, l)
+		}
+	}
+
+	return visible, nil
+}
+
+// Restrict restricts the tracks queried by q to the libraries with the given
+// IDs. column is the column holding the library of the tracks, like
+// "track.library_id".
+func Restrict(q *query.Query, column string, ids []int64) *query.Query {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+
+	return q.WhereIn(column, values...)
+}
+
+// TracksQuery returns a prepared Query to query the tracks of the libraries
+// with the given IDs.
+func TracksQuery(db *Database, ids []int64) *query.Query {
+	return Restrict(query.New(db, "track"), "track.library_id", ids)
+}
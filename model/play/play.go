@@ -0,0 +1,172 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The play package records which tracks users played and how they rated them.
+//
+// Every play is saved as an event in the Play table. Play count, time of the
+// last play and rating are kept per user and track in the TrackStat table, so
+// listings don't have to aggregate the events.
+package play
+
+import (
+	"fmt"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/model/track"
+	"strings"
+	"time"
+)
+
+// Threshold is the fraction of a track, that has to be streamed to count as a
+// play.
+var Threshold = 0.5
+
+// Ratings range from one to MaxRating stars. A rating of zero means unrated.
+const MaxRating = 5
+
+func CreatePlayTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Play
+	( ID       INTEGER NOT NULL PRIMARY KEY,
+	  track_id INTEGER REFERENCES Track(ID) ON DELETE CASCADE,
+	  user_id  INTEGER DEFAULT 0,
+	  played   INTEGER
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE INDEX 'play_track' ON Play (track_id);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`CREATE TABLE TrackStat
+	( ID          INTEGER NOT NULL PRIMARY KEY,
+	  user_id     INTEGER DEFAULT 0,
+	  track_id    INTEGER REFERENCES Track(ID) ON DELETE CASCADE,
+	  plays       INTEGER DEFAULT 0,
+	  last_played INTEGER DEFAULT 0,
+	  rating      INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'trackstat_user' ON TrackStat (user_id, track_id);")
+
+	return err
+}
+
+// Define scheme of play event. Plays of anonymous users have the UserID 0.
+type Play struct {
+	Id      int64 `column:"ID" set:"0" json:"id"`
+	TrackID int64 `column:"track_id" json:"track_id"`
+	UserID  int64 `column:"user_id" json:"user_id"`
+	Played  int64 `column:"played" json:"played"`
+}
+
+// rating is used to set the rating of a track without touching the play count.
+type rating struct {
+	UserID  int64 `column:"user_id"`
+	TrackID int64 `column:"track_id"`
+	Rating  int   `column:"rating"`
+}
+
+// TrackStats is a track with the statistics of a user.
+type TrackStats struct {
+	track.Track
+	Plays      int   `column:"trackstat:plays" json:"plays"`
+	LastPlayed int64 `column:"trackstat:last_played" json:"last_played"`
+	Rating     int   `column:"trackstat:rating" json:"rating"`
+}
+
+// LastPlayedString returns the time of the last play nicely formatted.
+func (self *TrackStats) LastPlayedString() string {
+	if self.LastPlayed == 0 {
+		return ""
+	}
+
+	return time.Unix(self.LastPlayed, 0).Format("2006-01-02 15:04")
+}
+
+// Stars returns the rating as a row of stars.
+func (self *TrackStats) Stars() string {
+	return strings.Repeat("★", self.Rating) +
+		strings.Repeat("☆", MaxRating-self.Rating)
+}
+
+// Record saves that the user with ID userID played the track with ID trackID
+// at the time played, given as Unix time.
+func Record(db *Database, trackID, userID, played int64) error {
+	_, err := mod.New(db, "play").Insert(&Play{
+		TrackID: trackID,
+		UserID:  userID,
+		Played:  played,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`INSERT INTO TrackStat
+	(user_id, track_id, plays, last_played) VALUES (?, ?, 1, ?)
+	ON CONFLICT (user_id, track_id) DO UPDATE SET
+	plays = plays + 1,
+	last_played = MAX(last_played, excluded.last_played);`,
+		userID, trackID, played)
+
+	return err
+}
+
+// Rate sets the rating of the track with ID trackID by the user with ID userID.
+// A rating of zero removes the rating.
+func Rate(db *Database, trackID, userID int64, stars int) error {
+	if stars < 0 || stars > MaxRating {
+		return fmt.Errorf("Rating must be between 0 and %d.", MaxRating)
+	}
+
+	_, err := mod.New(db, "trackstat").Upsert(
+		&rating{UserID: userID, TrackID: trackID, Rating: stars},
+		"user_id", "track_id",
+	)
+
+	return err
+}
+
+// StatsQuery returns a prepared Query to query the tracks the user with ID
+// userID has statistics of.
+func StatsQuery(db *Database, userID int64) *query.Query {
+	return query.New(db, "track").
+		Join("trackstat", "track_id", "", "ID").
+		Where("trackstat.user_id =", userID)
+}
+
+// DeleteDangling deletes plays and statistics of tracks that don't exist
+// anymore.
+func DeleteDangling(db *Database) error {
+	_, err := db.Execute(
+		"DELETE FROM Play WHERE track_id NOT IN (SELECT ID FROM Track);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"DELETE FROM TrackStat WHERE track_id NOT IN (SELECT ID FROM Track);")
+
+	return err
+}
@@ -0,0 +1,218 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The playlist package keeps the playlists of the users. A playlist is a named
+// list of tracks in the order they were added to it.
+package playlist
+
+import (
+	"database/sql"
+	"errors"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"strings"
+	"time"
+)
+
+var ErrName = errors.New("A playlist needs a name.")
+
+func CreatePlaylistTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Playlist
+	( ID      INTEGER NOT NULL PRIMARY KEY,
+	  user_id INTEGER REFERENCES User(ID) ON DELETE CASCADE,
+	  name    TEXT,
+	  updated INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE INDEX 'playlist_user' ON Playlist (user_id);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`CREATE TABLE PlaylistTrack
+	( ID          INTEGER NOT NULL PRIMARY KEY,
+	  playlist_id INTEGER REFERENCES Playlist(ID) ON DELETE CASCADE,
+	  track_id    INTEGER REFERENCES Track(ID) ON DELETE CASCADE,
+	  position    INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute("CREATE INDEX 'playlisttrack_playlist' " +
+		"ON PlaylistTrack (playlist_id, position);")
+
+	return err
+}
+
+// Define scheme of playlist entry.
+type Playlist struct {
+	Id      int64  `column:"ID" set:"0" json:"id"`
+	UserID  int64  `column:"user_id" json:"-"`
+	Name    string `column:"name" json:"name"`
+	Updated int64  `column:"updated" json:"updated"`
+	Link    string `json:"link"`
+}
+
+// playlistTrack is a track at position in a playlist.
+type playlistTrack struct {
+	Id         int64 `column:"ID" set:"0"`
+	PlaylistID int64 `column:"playlist_id"`
+	TrackID    int64 `column:"track_id"`
+	Position   int   `column:"position"`
+}
+
+// Create adds a new empty playlist named name of the user with ID userID.
+func Create(db *Database, userID int64, name string) (*Playlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrName
+	}
+
+	p := &Playlist{UserID: userID, Name: name, Updated: time.Now().Unix()}
+
+	res, err := mod.New(db, "playlist").Insert(p)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Id, err = res.LastInsertId()
+
+	return p, err
+}
+
+// Load returns the playlist with ID id of the user with ID userID. Playlists
+// of other users result in sql.ErrNoRows, so they aren't disclosed.
+func Load(db *Database, id, userID int64) (*Playlist, error) {
+	var p Playlist
+
+	err := query.New(db, "playlist").
+		Where("ID =", id).
+		Where("user_id =", userID).
+		Exec(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// UserQuery returns a prepared Query to query the playlists of the user with
+// ID userID ordered by their names.
+func UserQuery(db *Database, userID int64) *query.Query {
+	return query.New(db, "playlist").
+		Where("user_id =", userID).
+		Order("name").
+		Order("ID")
+}
+
+// TracksQuery returns a prepared Query to query the tracks of the playlist in
+// their order. A track added several times is queried that often.
+func (self *Playlist) TracksQuery(db *Database) *query.Query {
+	return query.New(db, "track").
+		Join("playlisttrack", "track_id", "", "ID").
+		Where("playlisttrack.playlist_id =", self.Id).
+		Order("playlisttrack.position").
+		Order("playlisttrack.ID")
+}
+
+// Add appends the tracks with the IDs ids to the playlist.
+func (self *Playlist) Add(db *Database, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res, err := db.Query("SELECT MAX(position) AS last FROM playlisttrack "+
+		"WHERE playlist_id = ?;", self.Id)
+	if err != nil {
+		return err
+	}
+
+	position := 0
+	if len(res) > 0 {
+		if last, ok := res[0]["last"].(int64); ok {
+			position = int(last) + 1
+		}
+	}
+
+	tracks := make([]playlistTrack, len(ids))
+	for i, id := range ids {
+		tracks[i] = playlistTrack{PlaylistID: self.Id, TrackID: id,
+			Position: position + i}
+	}
+
+	if _, err := mod.New(db, "playlisttrack").InsertAll(tracks); err != nil {
+		return err
+	}
+
+	return self.touch(db)
+}
+
+// Remove removes the track at position from the playlist. Positions count
+// the tracks in their order from 0.
+func (self *Playlist) Remove(db *Database, position int) error {
+	if position < 0 {
+		return sql.ErrNoRows
+	}
+
+	var tracks []playlistTrack
+
+	err := query.New(db, "playlisttrack").
+		Where("playlist_id =", self.Id).
+		Order("position").
+		Order("ID").
+		Offset(uint(position)).
+		Limit(1).
+		Exec(&tracks)
+	if err != nil {
+		return err
+	}
+
+	if len(tracks) == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := mod.New(db, "playlisttrack").Delete(int(tracks[0].Id)); err != nil {
+		return err
+	}
+
+	return self.touch(db)
+}
+
+// Delete deletes the playlist with its tracks.
+func (self *Playlist) Delete(db *Database) error {
+	_, err := db.Execute("DELETE FROM playlisttrack WHERE playlist_id = ?;",
+		self.Id)
+	if err != nil {
+		return err
+	}
+
+	return mod.New(db, "playlist").Delete(int(self.Id))
+}
+
+// touch sets the time the playlist was updated to now.
+func (self *Playlist) touch(db *Database) error {
+	self.Updated = time.Now().Unix()
+
+	_, err := db.Execute("UPDATE playlist SET updated = ? WHERE ID = ?;",
+		self.Updated, self.Id)
+	return err
+}
@@ -0,0 +1,343 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The queue package keeps the tracks every user plays in the browser.
+//
+// A queue holds tracks in the order they were added. The order they are
+// played in is its sequence, that is shuffled if the queue is shuffled. The
+// position points into the sequence at the track playing.
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"math/rand"
+	"time"
+)
+
+// Modes of repeating the queue. RepeatOne repeats the track playing, RepeatAll
+// starts over at the end of the queue.
+const (
+	RepeatOff = "off"
+	RepeatAll = "all"
+	RepeatOne = "one"
+)
+
+var (
+	ErrRepeat   = errors.New("Unknown repeat mode.")
+	ErrPosition = errors.New("Position out of queue.")
+)
+
+func CreateQueueTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Queue
+	( ID       INTEGER NOT NULL PRIMARY KEY,
+	  user_id  INTEGER REFERENCES User(ID) ON DELETE CASCADE,
+	  tracks   TEXT,
+	  sequence TEXT,
+	  position INTEGER DEFAULT 0,
+	  shuffle  INTEGER DEFAULT 0,
+	  repeat   TEXT DEFAULT 'off',
+	  updated  INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'queue_user' ON Queue (user_id);")
+	return err
+}
+
+// Define scheme of queue entry. Tracks holds the IDs of the tracks, Sequence
+// the indexes of Tracks in the order they are played. Both are saved encoded.
+type Queue struct {
+	Id          int64  `column:"ID" set:"0"`
+	UserID      int64  `column:"user_id"`
+	RawTracks   string `column:"tracks"`
+	RawSequence string `column:"sequence"`
+	Position    int    `column:"position"`
+	Shuffle     int    `column:"shuffle"`
+	Repeat      string `column:"repeat"`
+	Updated     int64  `column:"updated"`
+
+	Tracks   []int64
+	Sequence []int
+}
+
+// Load returns the queue of the user with ID userID. Users without queue get
+// an empty one.
+func Load(db *Database, userID int64) (*Queue, error) {
+	q := &Queue{UserID: userID, Repeat: RepeatOff}
+
+	err := query.New(db, "queue").Where("user_id =", userID).Exec(q)
+	switch {
+	case err == sql.ErrNoRows:
+		return q, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if q.RawTracks != "" {
+		if err := json.Unmarshal([]byte(q.RawTracks), &q.Tracks); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.RawSequence != "" {
+		if err := json.Unmarshal([]byte(q.RawSequence), &q.Sequence); err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// Save saves the queue.
+func (self *Queue) Save(db *Database) error {
+	tracks, _ := json.Marshal(self.Tracks)
+	sequence, _ := json.Marshal(self.Sequence)
+
+	self.RawTracks = string(tracks)
+	self.RawSequence = string(sequence)
+	self.Updated = time.Now().Unix()
+
+	_, err := mod.New(db, "queue").Upsert(self, "user_id")
+	return err
+}
+
+// Shuffled reports whether the queue is played shuffled.
+func (self *Queue) Shuffled() bool {
+	return self.Shuffle != 0
+}
+
+// Current returns the ID of the track playing. If the queue is empty, false is
+// returned.
+func (self *Queue) Current() (int64, bool) {
+	if self.Position >= len(self.Sequence) {
+		return 0, false
+	}
+
+	return self.Tracks[self.Sequence[self.Position]], true
+}
+
+// Ordered returns the IDs of the tracks in the order they are played.
+func (self *Queue) Ordered() []int64 {
+	ids := make([]int64, len(self.Sequence))
+	for i, j := range self.Sequence {
+		ids[i] = self.Tracks[j]
+	}
+
+	return ids
+}
+
+// Add adds the tracks with the IDs ids to the queue. If play is true, the
+// tracks are played next and the first of them right now. Otherwise they are
+// appended, or spread over the tracks not played yet if the queue is
+// shuffled.
+func (self *Queue) Add(play bool, ids ...int64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	added := make([]int, len(ids))
+	for i := range ids {
+		added[i] = len(self.Tracks) + i
+	}
+	self.Tracks = append(self.Tracks, ids...)
+
+	if self.Shuffled() {
+		rand.Shuffle(len(added), func(i, j int) {
+			added[i], added[j] = added[j], added[i]
+		})
+	}
+
+	if len(self.Sequence) == 0 {
+		self.Sequence = added
+		self.Position = 0
+		return
+	}
+
+	if play {
+		next := self.Position + 1
+		self.Sequence = append(self.Sequence[:next],
+			append(added, self.Sequence[next:]...)...)
+		self.Position = next
+		return
+	}
+
+	if !self.Shuffled() {
+		self.Sequence = append(self.Sequence, added...)
+		return
+	}
+
+	for _, a := range added {
+		i := self.Position + 1 + rand.Intn(len(self.Sequence)-self.Position)
+		self.Sequence = append(self.Sequence, 0)
+		copy(self.Sequence[i+1:], self.Sequence[i:])
+		self.Sequence[i] = a
+	}
+}
+
+// Keep removes the tracks from the queue, for whose IDs keep returns false. If
+// the track playing is removed, the queue continues with the next one.
+func (self *Queue) Keep(keep func(id int64) bool) {
+	var (
+		tracks   []int64
+		sequence []int
+	)
+
+	// new indexes of the tracks, -1 for removed ones
+	index := make([]int, len(self.Tracks))
+
+	for i, id := range self.Tracks {
+		index[i] = -1
+		if keep(id) {
+			index[i] = len(tracks)
+			tracks = append(tracks, id)
+		}
+	}
+
+	position := 0
+
+	for i, j := range self.Sequence {
+		if i == self.Position {
+			position = len(sequence)
+		}
+		if index[j] >= 0 {
+			sequence = append(sequence, index[j])
+		}
+	}
+
+	if position >= len(sequence) {
+		position = 0
+	}
+
+	self.Tracks = tracks
+	self.Sequence = sequence
+	self.Position = position
+}
+
+// Clear removes all tracks from the queue.
+func (self *Queue) Clear() {
+	self.Tracks = nil
+	self.Sequence = nil
+	self.Position = 0
+}
+
+// Next moves on to the next track and reports whether there is one. If ended
+// is true, the track playing ended by itself, so it's repeated if only this
+// track is repeated. At the end of the queue, the queue starts over if it is
+// repeated.
+func (self *Queue) Next(ended bool) bool {
+	switch {
+	case len(self.Sequence) == 0:
+		return false
+	case ended && self.Repeat == RepeatOne:
+		return true
+	case self.Position+1 < len(self.Sequence):
+		self.Position++
+		return true
+	case self.Repeat != RepeatOff:
+		self.Position = 0
+		return true
+	}
+
+	return false
+}
+
+// Previous moves back to the previous track and reports whether there is one.
+// At the start of the queue, it continues at the end if the queue is repeated.
+func (self *Queue) Previous() bool {
+	switch {
+	case len(self.Sequence) == 0:
+		return false
+	case self.Position > 0:
+		self.Position--
+		return true
+	case self.Repeat != RepeatOff:
+		self.Position = len(self.Sequence) - 1
+		return true
+	}
+
+	return false
+}
+
+// Jump moves to the track at position in the sequence.
+func (self *Queue) Jump(position int) error {
+	if position < 0 || position >= len(self.Sequence) {
+		return ErrPosition
+	}
+
+	self.Position = position
+	return nil
+}
+
+// SetShuffle shuffles or unshuffles the queue. A shuffled queue continues with
+// the track playing followed by all other tracks in random order, an
+// unshuffled queue in the order they were added.
+func (self *Queue) SetShuffle(shuffle bool) {
+	if shuffle == self.Shuffled() {
+		return
+	}
+
+	current := -1
+	if self.Position < len(self.Sequence) {
+		current = self.Sequence[self.Position]
+	}
+
+	self.Sequence = make([]int, len(self.Tracks))
+	for i := range self.Sequence {
+		self.Sequence[i] = i
+	}
+	self.Position = 0
+
+	if !shuffle {
+		self.Shuffle = 0
+		if current >= 0 {
+			self.Position = current
+		}
+		return
+	}
+
+	self.Shuffle = 1
+
+	rand.Shuffle(len(self.Sequence), func(i, j int) {
+		self.Sequence[i], self.Sequence[j] = self.Sequence[j], self.Sequence[i]
+	})
+
+	for i, j := range self.Sequence {
+		if j == current {
+			self.Sequence[0], self.Sequence[i] = self.Sequence[i], self.Sequence[0]
+			break
+		}
+	}
+}
+
+// SetRepeat sets the repeat mode of the queue. Unknown modes result in
+// ErrRepeat.
+func (self *Queue) SetRepeat(mode string) error {
+	switch mode {
+	case RepeatOff, RepeatAll, RepeatOne:
+		self.Repeat = mode
+		return nil
+	}
+
+	return ErrRepeat
+}
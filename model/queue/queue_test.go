@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	q := &Queue{Repeat: RepeatOff}
+
+	if _, ok := q.Current(); ok || q.Next(false) || q.Previous() {
+		t.Fatal("Empty queue has tracks.")
+	}
+
+	q.Add(false, 1, 2, 3)
+	q.Add(true, 4)
+
+	if got := q.Ordered(); !reflect.DeepEqual(got, []int64{1, 4, 2, 3}) {
+		t.Errorf("Order: got %v.", got)
+	}
+	if id, _ := q.Current(); id != 4 {
+		t.Errorf("Current: want 4, got %d.", id)
+	}
+
+	q.Next(false)
+	q.Next(false)
+	if q.Next(false) {
+		t.Error("Next at the end of the queue.")
+	}
+
+	q.SetRepeat(RepeatOne)
+	if !q.Next(true) {
+		t.Error("No repeated track.")
+	}
+	if id, _ := q.Current(); id != 3 {
+		t.Errorf("Repeated: want 3, got %d.", id)
+	}
+
+	q.SetRepeat(RepeatAll)
+	if q.Next(false); q.Position != 0 {
+		t.Errorf("Repeat all: want position 0, got %d.", q.Position)
+	}
+	if q.Previous(); q.Position != 3 {
+		t.Errorf("Previous: want position 3, got %d.", q.Position)
+	}
+
+	if err := q.SetRepeat("sometimes"); err != ErrRepeat {
+		t.Errorf("Unknown repeat mode: got %v.", err)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	q := &Queue{Repeat: RepeatOff}
+
+	q.Add(false, 1, 2, 3, 4, 5, 6, 7, 8)
+	q.Jump(4)
+
+	q.SetShuffle(true)
+	q.Add(false, 9, 10)
+
+	if id, _ := q.Current(); id != 5 || q.Position != 0 {
+		t.Errorf("Shuffled: want 5 at 0, got %d at %d.", id, q.Position)
+	}
+
+	ids := q.Ordered()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if !reflect.DeepEqual(ids, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Errorf("Shuffled tracks: got %v.", ids)
+	}
+
+	q.Next(false)
+	current, _ := q.Current()
+
+	q.SetShuffle(false)
+
+	if id, _ := q.Current(); id != current {
+		t.Errorf("Unshuffled: want %d, got %d.", current, id)
+	}
+	if got := q.Ordered(); !reflect.DeepEqual(got,
+		[]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}) {
+		t.Errorf("Unshuffled order: got %v.", got)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	q := &Queue{Repeat: RepeatOff}
+
+	q.Add(false, 1, 2, 3, 4)
+	q.Jump(1)
+
+	q.Keep(func(id int64) bool { return id%2 == 1 })
+
+	if got := q.Ordered(); !reflect.DeepEqual(got, []int64{1, 3}) {
+		t.Errorf("Kept: got %v.", got)
+	}
+	if id, _ := q.Current(); id != 3 {
+		t.Errorf("Current: want 3, got %d.", id)
+	}
+}
@@ -0,0 +1,166 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package scan
+
+import (
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"strings"
+	"time"
+)
+
+// Maximal number of errors saved per scan. Further errors are just counted.
+const MaxErrors = 1000
+
+func CreateScanTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE Scan
+	( ID        INTEGER NOT NULL PRIMARY KEY,
+	  started   INTEGER,
+	  finished  INTEGER DEFAULT 0,
+	  roots     TEXT,
+	  added     INTEGER DEFAULT 0,
+	  updated   INTEGER DEFAULT 0,
+	  moved     INTEGER DEFAULT 0,
+	  deleted   INTEGER DEFAULT 0,
+	  skipped   INTEGER DEFAULT 0,
+	  errors    INTEGER DEFAULT 0,
+	  cancelled INTEGER DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(`CREATE TABLE ScanError
+	( ID      INTEGER NOT NULL PRIMARY KEY,
+	  scan_id INTEGER REFERENCES Scan(ID) ON DELETE CASCADE,
+	  path    TEXT,
+	  message TEXT
+	);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute(
+		"CREATE INDEX 'scanerror_scan' ON ScanError (scan_id);")
+
+	return err
+}
+
+// Define scheme of scan entry. It holds the result of an update of the
+// database. Start and end of the scan are given as Unix time. Roots are the
+// roots of the scanned sources, separated by newlines. Skipped paths couldn't
+// be crawled, they are counted as errors, too. Cancelled is 1, if the scan was
+// cancelled.
+type Scan struct {
+	Id        int64  `column:"ID" set:"0" json:"id"`
+	Started   int64  `column:"started" json:"started"`
+	Finished  int64  `column:"finished" json:"finished"`
+	Roots     string `column:"roots" json:"roots"`
+	Added     int64  `column:"added" json:"added"`
+	Updated   int64  `column:"updated" json:"updated"`
+	Moved     int64  `column:"moved" json:"moved"`
+	Deleted   int64  `column:"deleted" json:"deleted"`
+	Skipped   int64  `column:"skipped" json:"skipped"`
+	Errors    int64  `column:"errors" json:"errors"`
+	Cancelled int    `column:"cancelled" json:"cancelled"`
+	Link      string `json:"link"`
+}
+
+// Define scheme of scan error entry. An empty path means the error affected
+// the whole scan.
+type ScanError struct {
+	Id      int64  `column:"ID" set:"0" json:"id"`
+	ScanID  int64  `column:"scan_id" json:"scan_id"`
+	Path    string `column:"path" json:"path"`
+	Message string `column:"message" json:"message"`
+}
+
+// Start saves a new scan of the sources with the given roots, that starts now.
+func Start(db *Database, roots []string) (*Scan, error) {
+	s := &Scan{Started: db.Mtime(), Roots: strings.Join(roots, "\n")}
+
+	res, err := mod.New(db, "scan").Insert(s)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Id, err = res.LastInsertId()
+
+	return s, err
+}
+
+// AddError counts the error cause of the scan at path and saves it, unless
+// there are MaxErrors saved already.
+func (self *Scan) AddError(db *Database, path string, cause error) error {
+	self.Errors++
+
+	if self.Errors > MaxErrors {
+		return nil
+	}
+
+	_, err := mod.New(db, "scanerror").Insert(&ScanError{
+		ScanID:  self.Id,
+		Path:    path,
+		Message: cause.Error(),
+	})
+
+	return err
+}
+
+// Finish saves the result of the scan, that ends now.
+func (self *Scan) Finish(db *Database) error {
+	self.Finished = time.Now().Unix()
+	return mod.New(db, "scan").Update(int(self.Id), self)
+}
+
+// RootList returns the roots of the scanned sources.
+func (self *Scan) RootList() []string {
+	if self.Roots == "" {
+		return nil
+	}
+
+	return strings.Split(self.Roots, "\n")
+}
+
+// ErrorsQuery returns a prepared Query to query the errors of the scan.
+func (self *Scan) ErrorsQuery(db *Database) *query.Query {
+	return query.New(db, "scanerror").Where("scan_id =", self.Id)
+}
+
+// StartedString returns the start time of the scan nicely formatted.
+func (self *Scan) StartedString() string {
+	return time.Unix(self.Started, 0).Format("2006-01-02 15:04")
+}
+
+// Duration returns how long the scan took.
+func (self *Scan) Duration() time.Duration {
+	return time.Duration(self.Finished-self.Started) * time.Second
+}
+
+// Last returns the latest scan. If there was no scan yet, sql.ErrNoRows is
+// returned.
+func Last(db *Database) (*Scan, error) {
+	var s Scan
+
+	err := query.New(db, "scan").Order("-ID").Limit(1).Exec(&s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
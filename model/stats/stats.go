@@ -0,0 +1,194 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// The stats package computes statistics of the whole library or some of its
+// libraries by aggregate queries on the Track table and the tables it
+// references.
+package stats
+
+import (
+	"database/sql"
+	"fmt"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/scan"
+)
+
+// Number of artists with the most tracks listed by default.
+const TopArtistsNumber = 10
+
+// Totals are the number of tracks, their total length in seconds and their
+// total file size in bytes.
+type Totals struct {
+	Tracks int64 `column:"COUNT(track:ID)" json:"tracks"`
+	Length int64 `column:"IFNULL(SUM(track:length), 0)" json:"length"`
+	Size   int64 `column:"IFNULL(SUM(track:size), 0)" json:"size"`
+}
+
+// LengthString returns the total length nicely formatted.
+func (self *Totals) LengthString() string {
+	return fmt.Sprintf("%d:%02d:%02d", self.Length/3600, self.Length/60%60,
+		self.Length%60)
+}
+
+// SizeString returns the total size in MiB or GiB.
+func (self *Totals) SizeString() string {
+	if self.Size >= 1<<30 {
+		return fmt.Sprintf("%.1f GiB", float64(self.Size)/(1<<30))
+	}
+
+	return fmt.Sprintf("%.1f MiB", float64(self.Size)/(1<<20))
+}
+
+// Totals of the tracks of a format.
+type FormatTotals struct {
+	Format string `column:"track:format" json:"format"`
+	Totals
+}
+
+// Totals of the tracks with a bitrate in kbit/s.
+type BitrateTotals struct {
+	Bitrate int `column:"track:bitrate" json:"bitrate"`
+	Totals
+}
+
+// Totals of the tracks of a genre.
+type GenreTotals struct {
+	Genre string `column:"genre:name" json:"genre"`
+	Totals
+}
+
+// Totals of the tracks of a year.
+type YearTotals struct {
+	Year int `column:"track:year" json:"year"`
+	Totals
+}
+
+// Totals of the tracks of an artist.
+type ArtistTotals struct {
+	ArtistID int64  `column:"artist:ID" json:"artist_id"`
+	Artist   string `column:"artist:name" json:"artist"`
+	Link     string `json:"link"`
+	Totals
+}
+
+// Library holds the statistics of the library. LastScan is nil, if the
+// library was never scanned.
+type Library struct {
+	Totals
+	Albums     int             `json:"albums"`
+	Artists    int             `json:"artists"`
+	Formats    []FormatTotals  `json:"formats"`
+	Bitrates   []BitrateTotals `json:"bitrates"`
+	Genres     []GenreTotals   `json:"genres"`
+	Years      []YearTotals    `json:"years"`
+	TopArtists []ArtistTotals  `json:"top_artists"`
+	LastScan   *scan.Scan      `json:"last_scan"`
+}
+
+// Compute computes the statistics of the library. The topArtists artists with
+// the most tracks are listed. The statistics are restricted to the tracks of
+// the libraries with the IDs libraries, unless they are nil.
+func Compute(db *Database, topArtists uint, libraries []int64) (*Library, error) {
+	l := &Library{}
+
+	// tracks returns a query of the tracks the statistics are computed of
+	tracks := func() *query.Query {
+		q := query.New(db, "track")
+		if libraries != nil {
+			library.Restrict(q, "track.library_id", libraries)
+		}
+		return q
+	}
+
+	err := tracks().Exec(&l.Totals)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := query.New(db, "album")
+	artists := query.New(db, "artist")
+	if libraries != nil {
+		albums.WhereInQuery("album.ID", tracks(), "track.album_id")
+		artists.WhereInQuery("artist.ID",
+			tracks().Join("album", "ID", "", "album_id"), "album.artist_id")
+	}
+
+	l.Albums, err = albums.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	l.Artists, err = artists.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tracks().
+		GroupBy("track.format").
+		Order("-COUNT(track.ID)").
+		Exec(&l.Formats)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tracks().
+		GroupBy("track.bitrate").
+		Order("-track.bitrate").
+		Exec(&l.Bitrates)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tracks().
+		Join("trackgenre", "track_id", "", "ID").
+		Join("genre", "ID", "trackgenre", "genre_id").
+		GroupBy("genre.ID").
+		Order("-COUNT(track.ID)").
+		Order("genre.name").
+		Exec(&l.Genres)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tracks().
+		GroupBy("track.year").
+		Order("track.year").
+		Exec(&l.Years)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tracks().
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		GroupBy("artist.ID").
+		Order("-COUNT(track.ID)").
+		Order("artist.sortkey").
+		Limit(topArtists).
+		Exec(&l.TopArtists)
+	if err != nil {
+		return nil, err
+	}
+
+	l.LastScan, err = scan.Last(db)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+
+	return l, err
+}
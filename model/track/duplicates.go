@@ -0,0 +1,228 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package track
+
+import (
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/source"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Reasons why tracks are considered duplicates.
+const (
+	SameContent = "content"
+	SameTags    = "tags"
+)
+
+// Tracks are considered to have the same length, if their lengths differ by at
+// most this many seconds from the next shorter one.
+const LengthTolerance = 2
+
+// Formats that are kept in favour of lossy formats.
+var LosslessFormats = map[string]bool{
+	"flac": true, "wav": true, "aiff": true, "ape": true, "wv": true,
+}
+
+// Copy is a track of a group of duplicates. Unlike in other listings, the
+// location of the track given by source.Location is exposed as path.
+type Copy struct {
+	Track
+	Path string `json:"path"`
+	Keep bool   `json:"keep"`
+}
+
+// DuplicateGroup is a group of tracks, that are copies of each other. The first
+// copy is the one suggested to keep.
+type DuplicateGroup struct {
+	Reason string `json:"reason"`
+	Copies []Copy `json:"copies"`
+}
+
+// duplicateTrack is a track with its fingerprint.
+type duplicateTrack struct {
+	Track
+	Fingerprint string `column:"track:fingerprint"`
+}
+
+// normalize folds s to lower case letters and digits, so differences in case,
+// diacritics, punctuation and spacing are ignored.
+func normalize(s string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(helper.Fold(s)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// tagKey returns the key tracks with the same normalized artist and title
+// share. Tracks without title have no key.
+func tagKey(t *Track) string {
+	title := normalize(t.Title)
+	if title == "" {
+		return ""
+	}
+
+	return normalize(t.Artist) + "\x00" + title
+}
+
+// sameLength splits tracks into groups of the same length. Sorted by length,
+// a track belongs to the group of the previous one, if their lengths don't
+// differ by more than LengthTolerance.
+func sameLength(tracks []*duplicateTrack) [][]*duplicateTrack {
+	sorted := append([]*duplicateTrack{}, tracks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Length < sorted[j].Length
+	})
+
+	var groups [][]*duplicateTrack
+
+	start := 0
+	for i := 1; i <= len(sorted); i++ {
+		if i < len(sorted) &&
+			sorted[i].Length-sorted[i-1].Length <= LengthTolerance {
+			continue
+		}
+
+		groups = append(groups, sorted[start:i])
+		start = i
+	}
+
+	return groups
+}
+
+// better reports whether a should be kept rather than b. Lossless formats are
+// preferred, then higher bitrates, bigger files and finally older entries.
+func better(a, b *Track) bool {
+	if LosslessFormats[a.Format] != LosslessFormats[b.Format] {
+		return LosslessFormats[a.Format]
+	}
+
+	if a.Bitrate != b.Bitrate {
+		return a.Bitrate > b.Bitrate
+	}
+
+	if a.Size != b.Size {
+		return a.Size > b.Size
+	}
+
+	return a.Id < b.Id
+}
+
+// newGroup returns a group of the tracks, ordered by which copy is suggested
+// to keep.
+func newGroup(reason string, tracks []*duplicateTrack) DuplicateGroup {
+	sort.Slice(tracks, func(i, j int) bool {
+		return better(&tracks[i].Track, &tracks[j].Track)
+	})
+
+	g := DuplicateGroup{Reason: reason, Copies: make([]Copy, len(tracks))}
+
+	for i, t := range tracks {
+		g.Copies[i] = Copy{
+			Track: t.Track,
+			Path:  source.Location(t.Source, t.Path),
+			Keep:  i == 0,
+		}
+	}
+
+	return g
+}
+
+// sameFingerprint reports whether all tracks have the same fingerprint.
+func sameFingerprint(tracks []*duplicateTrack) bool {
+	for _, t := range tracks[1:] {
+		if t.Fingerprint == "" || t.Fingerprint != tracks[0].Fingerprint {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Duplicates returns all groups of duplicate tracks. Tracks are grouped by
+// their audio content and by normalized artist, title and similar length.
+// Groups by tags, that just repeat a group by content, are left out.
+func Duplicates(db *Database) ([]DuplicateGroup, error) {
+	var tracks []duplicateTrack
+
+	err := query.New(db, "track").
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		Order("track.ID").
+		Exec(&tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	byContent := make(map[string][]*duplicateTrack)
+	byTags := make(map[string][]*duplicateTrack)
+
+	// keys in order of appearance, so the result is stable
+	var contentKeys, tagKeys []string
+
+	for i := 0; i < len(tracks); i++ {
+		t := &tracks[i]
+
+		if fp := t.Fingerprint; fp != "" {
+			if byContent[fp] == nil {
+				contentKeys = append(contentKeys, fp)
+			}
+			byContent[fp] = append(byContent[fp], t)
+		}
+
+		if key := tagKey(&t.Track); key != "" {
+			if byTags[key] == nil {
+				tagKeys = append(tagKeys, key)
+			}
+			byTags[key] = append(byTags[key], t)
+		}
+	}
+
+	var groups []DuplicateGroup
+
+	for _, key := range contentKeys {
+		if len(byContent[key]) > 1 {
+			groups = append(groups, newGroup(SameContent, byContent[key]))
+		}
+	}
+
+	for _, key := range tagKeys {
+		for _, g := range sameLength(byTags[key]) {
+			if len(g) > 1 && !sameFingerprint(g) {
+				groups = append(groups, newGroup(SameTags, g))
+			}
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := &groups[i].Copies[0], &groups[j].Copies[0]
+		if a.Artist != b.Artist {
+			return a.Artist < b.Artist
+		}
+		return a.Title < b.Title
+	})
+
+	return groups, nil
+}
@@ -0,0 +1,57 @@
+package track
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagKey(t *testing.T) {
+	a := &Track{Artist: "Björk", Title: "Jóga (Remix)"}
+	b := &Track{Artist: "bjork", Title: "joga remix"}
+	c := &Track{Artist: "Björk", Title: "Jóga"}
+
+	if tagKey(a) != tagKey(b) {
+		t.Errorf("%q != %q", tagKey(a), tagKey(b))
+	}
+
+	if tagKey(a) == tagKey(c) {
+		t.Errorf("Tracks of different titles have the same key.")
+	}
+
+	if tagKey(&Track{Artist: "Björk"}) != "" {
+		t.Errorf("Track without title has a key.")
+	}
+}
+
+func TestBetter(t *testing.T) {
+	flac := &Track{Id: 3, Format: "flac", Bitrate: 900}
+	mp3 := &Track{Id: 1, Format: "mp3", Bitrate: 320}
+	mp3Low := &Track{Id: 2, Format: "mp3", Bitrate: 128}
+
+	if !better(flac, mp3) || !better(mp3, mp3Low) || better(mp3Low, mp3) {
+		t.Errorf("Wrong order of copies.")
+	}
+}
+
+func TestSameLength(t *testing.T) {
+	var tracks []*duplicateTrack
+	for _, l := range []int{320, 300, 299, 303, 305} {
+		tracks = append(tracks, &duplicateTrack{Track: Track{Length: l}})
+	}
+
+	groups := sameLength(tracks)
+
+	var got [][]int
+	for _, g := range groups {
+		var lengths []int
+		for _, t := range g {
+			lengths = append(lengths, t.Length)
+		}
+		got = append(got, lengths)
+	}
+
+	want := [][]int{{299, 300}, {303, 305}, {320}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want %v, got %v.", want, got)
+	}
+}
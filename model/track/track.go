@@ -20,57 +20,257 @@ import (
 	"fmt"
 	. "github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/database/query"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
 )
 
 func CreateTrackTable(db *Database) error {
 	_, err := db.Execute(`CREATE TABLE Track
 	( ID          INTEGER NOT NULL PRIMARY KEY,
+	  source      TEXT NOT NULL DEFAULT '',
 	  path        TEXT NOT NULL,
 	  title       TEXT,
 	  tracknumber INTEGER,
 	  year        INTEGER,
 	  length      INTEGER,
 	  genre       TEXT,
+	  format      TEXT,
+	  bitrate     INTEGER,
+	  size        INTEGER,
+	  fingerprint TEXT,
 	  album_id    INTEGER REFERENCES Album(ID) ON DELETE SET NULL,
+	  library_id  INTEGER REFERENCES Library(ID) ON DELETE CASCADE,
+	  book_id     INTEGER DEFAULT 0,
+	  chapters    TEXT,
+	  description TEXT,
+	  published   INTEGER DEFAULT 0,
+	  added       INTEGER,
 	  filemtime	  INTEGER,
 	  dbmtime     INTEGER
     );`)
 
+	if err != nil {
+		return err
+	}
+
+	// tracks are looked up by source and path on every update
+	_, err = db.Execute(
+		"CREATE UNIQUE INDEX 'track_path' ON Track (source, path);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute("CREATE INDEX 'track_album' ON Track (album_id);")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Execute("CREATE INDEX 'track_library' ON Track (library_id);")
+	return err
+}
+
+// Touch marks the tracks of the source at path or below it as seen by the
+// running update, so they are kept although they weren't crawled. Paths are
+// separated by slashes, the root of the source is ".".
+func Touch(db *Database, source, path string) error {
+	if path == "." {
+		_, err := db.Execute("UPDATE Track SET dbmtime = ? WHERE source = ?;",
+			db.Mtime(), source)
+		return err
+	}
+
+	// tracks below path sort between dir and its successor
+	dir := strings.TrimSuffix(path, "/")
+
+	_, err := db.Execute(`UPDATE Track SET dbmtime = ?
+		WHERE source = ? AND (path = ? OR (path > ? AND path < ?));`,
+		db.Mtime(), source, path, dir+"/", dir+string('/'+1))
+
 	return err
 }
 
-// Define scheme of track entry.
+// folderQuery returns a prepared Query to query the tracks of the source at
+// path dir or below it. The root of the source is ".".
+func folderQuery(db *Database, source, dir string) *query.Query {
+	q := query.New(db, "track").Where("track.source =", source)
+
+	if dir != "." {
+		// tracks below dir sort between dir and its successor
+		q.Where("track.path >", dir+"/").Where("track.path <", dir+string('/'+1))
+	}
+
+	return q
+}
+
+// FolderQuery returns a prepared Query to query the tracks of the source at
+// path dir or below it, ordered by their paths. The root of the source is ".".
+func FolderQuery(db *Database, source, dir string) *query.Query {
+	return folderQuery(db, source, dir).Order("track.path")
+}
+
+// folderStart returns the position of the first character following the
+// folder dir in the paths below it, as counted by SQLite.
+func folderStart(dir string) int {
+	if dir == "." {
+		return 1
+	}
+
+	return utf8.RuneCountInString(dir) + 2
+}
+
+// FilesQuery returns a prepared Query to query the tracks of the source
+// directly at path dir, but not below it. The query isn't ordered, so it can
+// be paginated.
+func FilesQuery(db *Database, source, dir string) *query.Query {
+	return folderQuery(db, source, dir).Where(
+		fmt.Sprintf("instr(substr(track.path, %d), '/') =", folderStart(dir)), 0)
+}
+
+// FolderInfo is a folder with the number of tracks in it and below it.
+type FolderInfo struct {
+	Name   string
+	Tracks int
+}
+
+// Subfolders returns the folders directly in the folder dir having tracks
+// queried by q, ordered by their names. q must query tracks of FolderQuery for
+// dir, that can be restricted further.
+func Subfolders(db *Database, q *query.Query, dir string) ([]FolderInfo, error) {
+	sub, args := q.SQL("track.path")
+
+	// the path below dir up to the next slash names the subfolder
+	rest := fmt.Sprintf(`substr("track:path", %d)`, folderStart(dir))
+
+	res, err := db.Query("SELECT substr("+rest+", 1, instr("+rest+", '/') - 1) "+
+		"AS name, COUNT(*) AS tracks FROM ("+sub+") "+
+		"WHERE instr("+rest+", '/') > 0 GROUP BY name ORDER BY name;", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make([]FolderInfo, 0, len(res))
+
+	for _, r := range res {
+		name, _ := r["name"].(string)
+		n, _ := r["tracks"].(int64)
+
+		folders = append(folders, FolderInfo{Name: name, Tracks: int(n)})
+	}
+
+	return folders, nil
+}
+
+// SourceInfo is a source with the number of its tracks.
+type SourceInfo struct {
+	Source string `column:"track:source"`
+	Tracks int    `column:"COUNT(track:ID)"`
+}
+
+// SourcesQuery returns a prepared Query to query all sources with the number
+// of their tracks.
+func SourcesQuery(db *Database) *query.Query {
+	return query.New(db, "track").GroupBy("track.source").Order("track.source")
+}
+
+// Define scheme of track entry. Every track belongs to the library of its
+// source. Tracks of audiobook libraries are linked to their book by
+// book.LinkTracks, a BookID of 0 means no book. Chapters holds the encoded
+// chapter markers of the track. Episodes of podcasts have a description and
+// the Unix time they were published at.
 type RawTrack struct {
 	Id          int64  `column:"ID" set:"0"`
+	Source      string `column:"source"`
 	Path        string `column:"path"`
 	Title       string `column:"title"`
 	Tracknumber int    `column:"tracknumber"`
 	Year        int    `column:"year"`
 	Length      int    `column:"length"`
 	Genre       string `column:"genre"`
+	Format      string `column:"format"`
+	Bitrate     int    `column:"bitrate"`
+	Size        int64  `column:"size"`
+	Fingerprint string `column:"fingerprint"`
 	AlbumID     int64  `column:"album_id"`
+	LibraryID   int64  `column:"library_id"`
+	BookID      int64  `column:"book_id" set:"0"`
+	Chapters    string `column:"chapters"`
+	Description string `column:"description"`
+	Published   int64  `column:"published"`
+	Added       int64  `column:"added"`
 	Filemtime   int64  `column:"filemtime"`
 	DBMtime     int64  `column:"dbmtime"`
 }
 
 type Track struct {
-	Id          int64  `column:"track:ID" set:"0"`
-	Path        string `column:"track:path"`
-	Title       string `column:"track:title"`
-	Tracknumber int    `column:"track:tracknumber"`
-	Year        int    `column:"track:year"`
-	Length      int    `column:"track:length"`
-	Genre       string `column:"track:genre"`
-	Artist      string `column:"artist:name"`
-	Album       string `column:"album:name"`
-	Link        string
+	Id          int64  `column:"track:ID" set:"0" json:"id"`
+	Source      string `column:"track:source" json:"-"`
+	Path        string `column:"track:path" json:"-"`
+	Title       string `column:"track:title" json:"title"`
+	Tracknumber int    `column:"track:tracknumber" json:"tracknumber"`
+	Year        int    `column:"track:year" json:"year"`
+	Length      int    `column:"track:length" json:"length"`
+	Genre       string `column:"track:genre" json:"genre"`
+	Format      string `column:"track:format" json:"format"`
+	Bitrate     int    `column:"track:bitrate" json:"bitrate"`
+	Size        int64  `column:"track:size" json:"size"`
+	Added       int64  `column:"track:added" json:"added"`
+	AlbumID     int64  `column:"track:album_id" json:"album_id"`
+	LibraryID   int64  `column:"track:library_id" json:"library_id"`
+	BookID      int64  `column:"track:book_id" json:"book_id"`
+	Description string `column:"track:description" json:"description,omitempty"`
+	Published   int64  `column:"track:published" json:"published,omitempty"`
+	Artist      string `column:"artist:name" json:"artist"`
+	Album       string `column:"album:name" json:"album"`
+	Link        string `json:"link"`
 }
 
 func (self *RawTrack) AlbumQuery(db *Database) *query.Query {
 	return query.New(db, "album").Where("ID =", self.AlbumID)
 }
 
+// Format returns the format of the file at path, which is its lower case file
+// extension.
+func Format(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// MIME types of formats by the formats.
+var mimeTypes = map[string]string{
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"m4a":  "audio/mp4",
+	"m4b":  "audio/mp4",
+	"mp3":  "audio/mpeg",
+	"oga":  "audio/ogg",
+	"ogg":  "audio/ogg",
+	"opus": "audio/ogg",
+	"wav":  "audio/wav",
+	"wma":  "audio/x-ms-wma",
+}
+
+// MimeType returns the MIME type of the format. Unknown formats are
+// application/octet-stream.
+func MimeType(format string) string {
+	if t, ok := mimeTypes[format]; ok {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
 // LengthString returns a nicely formatted string of the track's length.
 func (self *Track) LengthString() string {
 	return fmt.Sprintf("%d:%02d", self.Length/60, self.Length%60)
 }
+
+// FileName returns the name of the track's file.
+func (self *Track) FileName() string {
+	return path.Base(self.Path)
+}
+
+// SizeString returns the file size of the track in MiB.
+func (self *Track) SizeString() string {
+	return fmt.Sprintf("%.1f MiB", float64(self.Size)/(1<<20))
+}
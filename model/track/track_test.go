@@ -0,0 +1,20 @@
+package track
+
+import (
+	"testing"
+)
+
+func TestMimeType(t *testing.T) {
+	for format, want := range map[string]string{
+		"ogg":  "audio/ogg",
+		"opus": "audio/ogg",
+		"flac": "audio/flac",
+		"m4a":  "audio/mp4",
+		"mp3":  "audio/mpeg",
+		"xyz":  "application/octet-stream",
+	} {
+		if got := MimeType(format); got != want {
+			t.Errorf("%s: want %s, got %s.", format, want, got)
+		}
+	}
+}
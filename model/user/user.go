@@ -0,0 +1,130 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package user
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	. "github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/database/mod"
+	"github.com/mokasin/musicrawler/lib/database/query"
+)
+
+func CreateUserTable(db *Database) error {
+	_, err := db.Execute(`CREATE TABLE User
+	( ID        INTEGER NOT NULL PRIMARY KEY,
+	  name      TEXT    UNIQUE,
+	  token     TEXT    UNIQUE,
+	  admin     INTEGER DEFAULT 0,
+	  feedtoken TEXT    UNIQUE
+	);`)
+
+	return err
+}
+
+// Define scheme of user entry. Users authenticate by their secret token. The
+// feed token grants reading the feeds and streaming every track of the
+// libraries visible to the user, but nothing else, so podcast apps don't get
+// the secret token.
+type User struct {
+	Id        int64  `column:"ID" set:"0" json:"id"`
+	Name      string `column:"name" json:"name"`
+	Token     string `column:"token" json:"-"`
+	Admin     int    `column:"admin" json:"admin"`
+	FeedToken string `column:"feedtoken" json:"-"`
+}
+
+// IsAdmin reports whether the user has administrative rights.
+func (self *User) IsAdmin() bool {
+	return self.Admin != 0
+}
+
+// newToken returns a random token.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Add adds a new user named name with a random token to the database.
+func Add(db *Database, name string, admin bool) (*User, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	feedToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{Name: name, Token: token, FeedToken: feedToken}
+	if admin {
+		u.Admin = 1
+	}
+
+	res, err := mod.New(db, "user").Insert(u)
+	if err != nil {
+		return nil, err
+	}
+
+	u.Id, err = res.LastInsertId()
+
+	return u, err
+}
+
+// ByToken returns the user authenticated by token. If there is no such user,
+// sql.ErrNoRows is returned.
+func ByToken(db *Database, token string) (*User, error) {
+	var u User
+
+	err := query.New(db, "user").Where("token =", token).Exec(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// ByFeedToken returns the user whose feed token is token. If there is no such
+// user, sql.ErrNoRows is returned.
+func ByFeedToken(db *Database, token string) (*User, error) {
+	var u User
+
+	err := query.New(db, "user").Where("feedtoken =", token).Exec(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// ByName returns the user named name. If there is no such user, sql.ErrNoRows
+// is returned.
+func ByName(db *Database, name string) (*User, error) {
+	var u User
+
+	err := query.New(db, "user").Where("name =", name).Exec(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
@@ -18,27 +18,40 @@ package main
 
 import (
 	"container/list"
+	"context"
 	"github.com/mokasin/musicrawler/lib/database"
 	"github.com/mokasin/musicrawler/lib/source"
+	"github.com/mokasin/musicrawler/model/library"
+	"io/fs"
+	"sync"
 )
 
-// Struct to manage different track sources
+// Struct to manage different track sources. Every source belongs to a named
+// library.
 type SourceList struct {
-	sources *list.List
-	db      *database.Database
+	sources   *list.List
+	libraries map[string]string
+	db        *database.Database
 }
 
 // Constructor of Sources.
 func NewSourceList(db *database.Database) *SourceList {
 	return &SourceList{
-		sources: list.New(),
-		db:      db,
+		sources:   list.New(),
+		libraries: make(map[string]string),
+		db:        db,
 	}
 }
 
-// Add a source to source list.
+// Add a source of the default library to source list.
 func (self *SourceList) Add(source source.TrackSource) {
+	self.AddTo(library.Default, source)
+}
+
+// AddTo adds a source of the library named name to source list.
+func (self *SourceList) AddTo(name string, source source.TrackSource) {
 	self.sources.PushBack(source)
+	self.libraries[source.Root()] = name
 }
 
 // Remove element from source list.
@@ -46,32 +59,75 @@ func (self *SourceList) Remove(e *list.Element) {
 	self.sources.Remove(e)
 }
 
-func (self *SourceList) Update(statusChannel chan *UpdateStatus,
-	result chan *UpdateResult) {
+// Roots returns the roots of all sources.
+func (self *SourceList) Roots() []string {
+	var roots []string
+
+	for e := self.sources.Front(); e != nil; e = e.Next() {
+		if ts, ok := e.Value.(source.TrackSource); ok {
+			roots = append(roots, ts.Root())
+		}
+	}
+
+	return roots
+}
+
+// Libraries returns the names of the libraries of the sources by their roots.
+func (self *SourceList) Libraries() map[string]string {
+	return self.libraries
+}
+
+// Files returns the file systems of the sources, that are file sources, by
+// their IDs.
+func (self *SourceList) Files() map[string]fs.FS {
+	files := make(map[string]fs.FS)
+
+	for e := self.sources.Front(); e != nil; e = e.Next() {
+		if fsrc, ok := e.Value.(source.FileSource); ok {
+			files[fsrc.Root()] = fsrc.FS()
+		}
+	}
+
+	return files
+}
+
+// On returns a source list with the same sources, that updates the database
+// db.
+func (self *SourceList) On(db *database.Database) *SourceList {
+	return &SourceList{sources: self.sources, libraries: self.libraries, db: db}
+}
+
+// Update crawls all sources and updates the database. If ctx is cancelled or
+// a source fails, the crawling stops, the tracks crawled so far are committed
+// and the tracks that weren't crawled are kept. The error of a failed source is
+// returned by the result.
+func (self *SourceList) Update(ctx context.Context,
+	statusChannel chan *UpdateStatus, result chan *UpdateResult) {
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	g := &group{cancel: cancel}
 
 	trackInfoChannel := make(chan source.TrackInfo, 100)
 	updateResultChannel := make(chan *UpdateResult)
-	doneChannel := make(chan bool)
 
 	// Output of crawler(self) connects to the input of database.Update() over
 	// trackInfoChannel channel
-	go UpdateDatabase(self.db, trackInfoChannel, statusChannel, updateResultChannel)
-
-	running := 0
+	go UpdateDatabase(ctx, self.db, self.Roots(), self.libraries,
+		trackInfoChannel, statusChannel, updateResultChannel)
 
 	for e := self.sources.Front(); e != nil; e = e.Next() {
 		if ts, ok := e.Value.(source.TrackSource); ok {
-			running++
-			go ts.Crawl(trackInfoChannel, doneChannel)
+			g.Go(func() error {
+				return ts.Crawl(ctx, trackInfoChannel)
+			})
 		}
 	}
 
 	// wait until every source crawling has finished
 	go func() {
-		for running > 0 {
-			running--
-			<-doneChannel
-		}
+		g.Wait()
 		close(trackInfoChannel)
 	}()
 
@@ -79,3 +135,37 @@ func (self *SourceList) Update(statusChannel chan *UpdateStatus,
 	r := <-updateResultChannel
 	result <- r
 }
+
+// group runs functions in goroutines like errgroup.Group. The first function
+// returning an error calls cancel with the error as cause. Unlike
+// errgroup.Group, Wait doesn't cancel, as the tracks still buffered have to be
+// handled.
+type group struct {
+	wg     sync.WaitGroup
+	cancel context.CancelCauseFunc
+
+	once sync.Once
+	err  error
+}
+
+// Go runs f in a new goroutine.
+func (self *group) Go(f func() error) {
+	self.wg.Add(1)
+
+	go func() {
+		defer self.wg.Done()
+
+		if err := f(); err != nil {
+			self.once.Do(func() {
+				self.err = err
+				self.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait waits for all functions to return and returns the first error.
+func (self *group) Wait() error {
+	self.wg.Wait()
+	return self.err
+}
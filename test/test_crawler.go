@@ -1,11 +1,21 @@
 package test
 
 import (
-	"github.com/mokasin/musicrawler/source"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/source"
 	"math/rand"
 )
 
 type testCrawler struct {
+	number int64
+}
+
+// NewCrawler returns a source.TrackSource that emits number tracks with random
+// tags.
+func NewCrawler(number int64) source.TrackSource {
+	return &testCrawler{number: number}
 }
 
 func randomString(length int) string {
@@ -19,13 +29,23 @@ func randomString(length int) string {
 
 const ARTISTNUMBER = 40
 const ALBUMNUMBER = 80
-const TRACKNUMBER = 1000
+const TRACKNUMBER = 100000
 
 var artists = make([]string, ARTISTNUMBER)
 var albums = make([]string, ALBUMNUMBER)
 
+// Artists with names that need special care when sorting and indexing.
+var specialArtists = []string{
+	"The Beatles", "Ásgeir", "Ärzte", "Øystein", "Björk", "Мумий Тролль",
+	"2Pac", "!!!",
+}
+
 func init() {
 	for i := 0; i < len(artists); i++ {
+		if i < len(specialArtists) {
+			artists[i] = specialArtists[i]
+			continue
+		}
 		artists[i] = randomString(5 + rand.Int()%26)
 	}
 
@@ -42,11 +62,29 @@ func getAlbum() string {
 	return albums[rand.Int()%len(albums)]
 }
 
+var genres = []string{"Rock", "Pop", "Jazz", "Classical", "Electronic",
+	"Rock; Indie", "(17)", "(32)Classical", "Pop/Electronic"}
+
+func getGenre() string {
+	return genres[rand.Int()%len(genres)]
+}
+
+var extensions = []string{".mp3", ".ogg"}
+
+func getPath() string {
+	return randomString(50+rand.Int()%70) + extensions[rand.Int()%len(extensions)]
+}
+
 type TestInfo struct {
 	path  string
 	mtime int64
 }
 
+// Source of the test tracks.
+func (ti *TestInfo) Source() string {
+	return "test"
+}
+
 // Getter of TestInfo.filename
 func (ti *TestInfo) Path() string {
 	return ti.path
@@ -57,6 +95,16 @@ func (ti *TestInfo) Mtime() int64 {
 	return ti.mtime
 }
 
+// Size of the track, the same for all test tracks.
+func (ti *TestInfo) Size() int64 {
+	return 4 << 20
+}
+
+// Fingerprint is derived from the path, so every test track is unique.
+func (ti *TestInfo) Fingerprint() (string, error) {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(ti.path))), nil
+}
+
 // Reads tags (id3, vorbis,…) from file
 func (ti *TestInfo) Tags() (*source.TrackTags, error) {
 
@@ -66,17 +114,28 @@ func (ti *TestInfo) Tags() (*source.TrackTags, error) {
 		Artist:  getArtist(),
 		Album:   getAlbum(),
 		Comment: "",
-		Genre:   "",
-		Year:    2012,
+		Genre:   getGenre(),
+		Year:    1970 + rand.Int()%43,
 		Track:   1,
 		Bitrate: 128,
 		Length:  400,
 	}, nil
 }
 
-func (t *testCrawler) Crawl(tracks chan<- source.TrackInfo, done chan<- bool) {
-	for i := int64(0); i < TRACKNUMBER; i++ {
-		tracks <- &TestInfo{path: randomString(50 + rand.Int()%70), mtime: i}
+// Root of the test crawler.
+func (t *testCrawler) Root() string {
+	return "test"
+}
+
+func (t *testCrawler) Crawl(ctx context.Context,
+	tracks chan<- source.TrackInfo) error {
+	for i := int64(0); i < t.number; i++ {
+		select {
+		case tracks <- &TestInfo{path: getPath(), mtime: i}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	done <- true
+
+	return nil
 }
@@ -18,14 +18,16 @@ package controller
 
 import (
 	"code.google.com/p/gorilla/mux"
+	"database/sql"
 	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
 	"github.com/mokasin/musicrawler/lib/web/controller"
 	"github.com/mokasin/musicrawler/lib/web/env"
 	"github.com/mokasin/musicrawler/lib/web/tmpl"
 	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/library"
 	"github.com/mokasin/musicrawler/model/track"
 	"net/http"
-	"path/filepath"
 	"strconv"
 )
 
@@ -40,36 +42,40 @@ func NewAlbum(env *env.Environment) *ControllerAlbum {
 		controller.Controller: *controller.NewController(env),
 	}
 
-	c.Tmpl.AddTemplate("album_index", "index", "albums")
-	c.Tmpl.AddTemplate("album_show", "index", "album")
+	c.Tmpl.AddTemplate("album_index", "index", "pager", "filter", "albums")
+	c.Tmpl.AddTemplate("album_show", "index", "pager", "album")
 
 	return c
 }
 
 // Implementation of SelectHandler.
 func (self *ControllerAlbum) Index(w http.ResponseWriter, r *http.Request) {
-	var albums []album.Album
+	lp, err := newListingParams(&self.Controller, r,
+		albumSorting, "name", "album.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
 
-	// retreive all albums
-	err := query.New(self.Env.Db, "album").Exec(&albums)
+	// retreive a page of albums
+	albums, _, err := albumListing(&self.Controller, lp, "album")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// prepare data for template
-	for i := 0; i < len(albums); i++ {
-		url, err := self.URL("album", controller.Pairs{"id": albums[i].Id})
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		albums[i].Link = url
+	url, err := self.URL("album_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	self.Tmpl.AddDataToTemplate("album_index", "Albums", &albums)
+	self.Tmpl.AddDataToTemplate("album_index", "Filter", lp.Filter)
+	self.Tmpl.AddDataToTemplate("album_index", "SortLinks",
+		albumSorting.Links(url, r.URL.Query(), lp.Sort))
+	self.Tmpl.AddDataToTemplate("album_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), lp.Pagination))
 
 	// render the website
 	self.Tmpl.RenderPage(
@@ -86,6 +92,13 @@ func (self *ControllerAlbum) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	lp, err := newListingParams(&self.Controller, r,
+		trackSorting, "tracknumber", "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
 	if err := self.Env.Db.BeginTransaction(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -102,35 +115,53 @@ func (self *ControllerAlbum) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// retreive tracks of album
-	var tracks []track.Track
-
-	q := album.TracksQuery(self.Env.Db)
-	q.Join("album", "id", "", "album_id")
-	q.Join("artist", "id", "album", "artist_id")
-
-	err = q.Order("tracknumber").Exec(&tracks)
-
+	// albums of other libraries are hidden
+	visible, err := albumVisible(&self.Controller, id, lp.Filter.Libraries)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
 
-	// prepare data for template
-	for i := 0; i < len(tracks); i++ {
-		url, err := self.URL("content", controller.Pairs{"id": tracks[i].Id, "filename": filepath.Base(tracks[i].Path)})
+	// retreive tracks of album
+	tracks, _, err := trackListing(&self.Controller,
+		album.TracksQuery(self.Env.Db), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		tracks[i].Link = url
+	url, err := self.URL("album", controller.Pairs{"id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	self.Tmpl.AddDataToTemplate("album_show", "Album", &album)
 	self.Tmpl.AddDataToTemplate("album_show", "Tracks", &tracks)
+	self.Tmpl.AddDataToTemplate("album_show", "SortLinks",
+		trackSorting.Links(url, r.URL.Query(), lp.Sort))
+	self.Tmpl.AddDataToTemplate("album_show", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), lp.Pagination))
 
 	backlink, _ := self.URL("artist", controller.Pairs{"id": album.ArtistID})
+	downloadlink, _ := self.URL("album_download", controller.Pairs{"id": id})
+
+	// the feed is subscribed to with the feed token of the user
+	u, err := currentUser(&self.Controller, nil, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	feedlink, _ := feedLink(&self.Controller, u, "feed_album",
+		controller.Pairs{"id": id})
+
+	self.Tmpl.AddDataToTemplate("album_show", "FeedLink", feedlink)
+	self.Tmpl.AddDataToTemplate("album_show", "DownloadLink", downloadlink)
 
 	// render the website
 	self.Tmpl.RenderPage(
@@ -139,3 +170,165 @@ func (self *ControllerAlbum) Show(w http.ResponseWriter, r *http.Request) {
 		&tmpl.Page{Title: album.Name, BackLink: backlink},
 	)
 }
+
+// APIIndex serves a page of albums as JSON.
+func (self *ControllerAlbum) APIIndex(w http.ResponseWriter, r *http.Request) {
+	lp, err := newListingParams(&self.Controller, r,
+		albumSorting, "name", "album.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	albums, cursor, err := albumListing(&self.Controller, lp, "api_album")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: lp.Pagination,
+		NextCursor: cursor,
+		Items:      albums,
+	})
+}
+
+// APIShow serves an album and a page of its tracks as JSON.
+func (self *ControllerAlbum) APIShow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lp, err := newListingParams(&self.Controller, r,
+		trackSorting, "tracknumber", "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	var a album.Album
+
+	err = query.New(self.Env.Db, "album").Find(id).Exec(&a)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// albums of other libraries are hidden
+	visible, err := albumVisible(&self.Controller, id, lp.Filter.Libraries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	tracks, cursor, err := trackListing(&self.Controller,
+		a.TracksQuery(self.Env.Db), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	listing := &controller.Listing{
+		Pagination: lp.Pagination,
+		NextCursor: cursor,
+		Items:      tracks,
+	}
+
+	self.RenderJSON(w, struct {
+		*album.Album
+		Tracks *controller.Listing `json:"tracks"`
+	}{&a, listing})
+}
+
+// downloadTracks returns the album with the ID id and its tracks in the
+// libraries ids. Albums hidden from the user result in sql.ErrNoRows.
+func (self *ControllerAlbum) downloadTracks(id int, ids []int64) (*album.Album,
+	[]track.Track, error) {
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		return nil, nil, err
+	}
+	defer self.Env.Db.EndTransaction()
+
+	var a album.Album
+
+	if err := query.New(self.Env.Db, "album").Find(id).Exec(&a); err != nil {
+		return nil, nil, err
+	}
+
+	visible, err := albumVisible(&self.Controller, id, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !visible {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	q := a.TracksQuery(self.Env.Db).
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		Order("track.tracknumber").
+		Order("track.path")
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var tracks []track.Track
+
+	if err := q.Exec(&tracks); err != nil {
+		return nil, nil, err
+	}
+
+	return &a, tracks, nil
+}
+
+// Download serves the tracks of an album as ZIP archive, in a folder of the
+// artist and album together with a playlist of them.
+func (self *ControllerAlbum) Download(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	// the database isn't locked while the archive is streamed
+	a, tracks, err := self.downloadTracks(id, ids)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	artist := "Unknown"
+	if len(tracks) > 0 {
+		artist = archiveName(tracks[0].Artist)
+	}
+
+	serveArchive(&self.Controller, w, artist+" - "+a.Name,
+		artist+"/"+archiveName(a.Name), tracks)
+}
@@ -0,0 +1,281 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/model/track"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveEntry is a file of a ZIP archive. Its content is read from the file
+// at path of fsys, or taken from data if fsys is nil.
+type archiveEntry struct {
+	name  string
+	fsys  fs.FS
+	path  string
+	data  []byte
+	size  int64
+	mtime time.Time
+}
+
+func (self *archiveEntry) header() *zip.FileHeader {
+	return &zip.FileHeader{
+		Name:     self.name,
+		Method:   zip.Store,
+		Modified: self.mtime,
+	}
+}
+
+// copy writes the content of the entry to w.
+func (self *archiveEntry) copy(w io.Writer) error {
+	var r io.Reader = bytes.NewReader(self.data)
+
+	if self.fsys != nil {
+		f, err := self.fsys.Open(self.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	// files changed since they were measured would break the length of the
+	// response
+	n, err := io.Copy(w, io.LimitReader(r, self.size))
+	if err != nil {
+		return err
+	}
+	if n != self.size {
+		return fmt.Errorf("Size of %s changed.", self.name)
+	}
+
+	return nil
+}
+
+// Lengths of the records of a ZIP archive written by archive/zip.
+const (
+	zipLocalHeaderLen   = 30 // + name + extra
+	zipCentralHeaderLen = 46 // + name + extra
+	zipDescriptorLen    = 16
+	zipDescriptor64Len  = 24
+	zipEndLen           = 22
+	zipEnd64Len         = 56 + 20 // zip64 end record and its locator
+	zipTimeExtraLen     = 9       // extended timestamp of Modified
+	zip64ExtraLen       = 4       // + 8 per field exceeding 32 bit
+	zipMax16            = 1<<16 - 1
+	zipMax32            = 1<<32 - 1
+)
+
+// archiveSize returns the size of the ZIP archive of the entries as written by
+// writeArchive. As the files are stored uncompressed with a data descriptor,
+// the layout of the archive only depends on names and sizes.
+func archiveSize(entries []archiveEntry) (int64, error) {
+	var offset, central int64
+
+	zip64 := false
+
+	for i := range entries {
+		name := int64(len(entries[i].name))
+		if name > zipMax16 {
+			return 0, fmt.Errorf("Name of %s is too long.", entries[i].name)
+		}
+
+		size := entries[i].size
+
+		// the central directory marks sizes and offsets reaching 32 bit, the
+		// data descriptor only sizes exceeding them
+		var extra int64
+		if size >= zipMax32 {
+			extra += 2 * 8
+		}
+		if offset >= zipMax32 {
+			extra += 8
+		}
+		if extra > 0 {
+			extra += zip64ExtraLen
+			zip64 = true
+		}
+
+		central += zipCentralHeaderLen + name + zipTimeExtraLen + extra
+
+		offset += zipLocalHeaderLen + name + zipTimeExtraLen + size
+		if size > zipMax32 {
+			offset += zipDescriptor64Len
+		} else {
+			offset += zipDescriptorLen
+		}
+	}
+
+	if zip64 || len(entries) >= zipMax16 || central >= zipMax32 ||
+		offset >= zipMax32 {
+		central += zipEnd64Len
+	}
+
+	return offset + central + zipEndLen, nil
+}
+
+// writeArchive writes the ZIP archive of the entries to w.
+func writeArchive(w io.Writer, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+
+	for i := range entries {
+		fw, err := zw.CreateHeader(entries[i].header())
+		if err != nil {
+			return err
+		}
+
+		if err := entries[i].copy(fw); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// archiveName returns s usable as file name on common file systems.
+func archiveName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+
+	s = strings.Trim(s, " .")
+	if s == "" {
+		return "Unknown"
+	}
+
+	return s
+}
+
+// trackArchive returns the entries of a ZIP archive of the tracks in the
+// folder dir, followed by a M3U playlist named name.m3u listing them in order.
+// Tracks whose file isn't available are left out.
+func trackArchive(c *controller.Controller, dir, name string,
+	tracks []track.Track) ([]archiveEntry, error) {
+
+	var (
+		entries []archiveEntry
+		m3u     bytes.Buffer
+		latest  time.Time
+	)
+
+	used := make(map[string]bool)
+
+	m3u.WriteString("#EXTM3U\n")
+
+	for _, t := range tracks {
+		fsys, ok := c.Env.Files[t.Source]
+		if !ok {
+			continue
+		}
+
+		info, err := fs.Stat(fsys, t.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		title := t.Title
+		if title == "" {
+			title = strings.TrimSuffix(path.Base(t.Path), path.Ext(t.Path))
+		}
+
+		base := archiveName(title)
+		if t.Tracknumber > 0 {
+			base = fmt.Sprintf("%02d %s", t.Tracknumber, base)
+		}
+
+		// tracks of the same name are numbered
+		file := base + path.Ext(t.Path)
+		for i := 2; used[file]; i++ {
+			file = fmt.Sprintf("%s (%d)%s", base, i, path.Ext(t.Path))
+		}
+		used[file] = true
+
+		entries = append(entries, archiveEntry{
+			name:  dir + "/" + file,
+			fsys:  fsys,
+			path:  t.Path,
+			size:  info.Size(),
+			mtime: info.ModTime(),
+		})
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+
+		fmt.Fprintf(&m3u, "#EXTINF:%d,%s - %s\n%s\n",
+			t.Length, t.Artist, title, file)
+	}
+
+	if latest.IsZero() {
+		latest = time.Now()
+	}
+
+	entries = append(entries, archiveEntry{
+		name:  dir + "/" + archiveName(name) + ".m3u",
+		data:  m3u.Bytes(),
+		size:  int64(m3u.Len()),
+		mtime: latest,
+	})
+
+	return entries, nil
+}
+
+// serveArchive serves the tracks as ZIP archive named name.zip. The archive is
+// written directly to the response, its length is known in advance.
+func serveArchive(c *controller.Controller, w http.ResponseWriter,
+	name, dir string, tracks []track.Track) {
+
+	entries, err := trackArchive(c, dir, name, tracks)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	size, err := archiveSize(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/zip")
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": archiveName(name) + ".zip"}))
+
+	// once the archive is streamed, failures can only abort the response
+	writeArchive(w, entries)
+}
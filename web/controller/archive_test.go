@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestArchiveSize(t *testing.T) {
+	mtime := time.Date(2012, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	entry := func(name, data string) archiveEntry {
+		return archiveEntry{name: name, data: []byte(data),
+			size: int64(len(data)), mtime: mtime}
+	}
+
+	// ZIP archives of 65535 entries and more need the zip64 end record
+	var many []archiveEntry
+	for i := 0; i < 1<<16; i++ {
+		many = append(many, entry(fmt.Sprintf("a/%d", i), "x"))
+	}
+
+	tests := [][]archiveEntry{
+		nil,
+		{entry("a/empty.mp3", "")},
+		{entry("a/01 Song.mp3", "0123456789"), entry("a/ü:2.ogg", "oggdata"),
+			entry("a/a.m3u", "#EXTM3U\n")},
+		many,
+	}
+
+	for i, entries := range tests {
+		var buf bytes.Buffer
+
+		if err := writeArchive(&buf, entries); err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := archiveSize(entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if size != int64(buf.Len()) {
+			t.Errorf("%d: Want size %d, got %d.", i, buf.Len(), size)
+		}
+	}
+}
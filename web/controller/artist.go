@@ -18,6 +18,7 @@ package controller
 
 import (
 	"code.google.com/p/gorilla/mux"
+	"database/sql"
 	"github.com/mokasin/musicrawler/lib/database/query"
 	"github.com/mokasin/musicrawler/lib/model/helper"
 	"github.com/mokasin/musicrawler/lib/web/controller"
@@ -25,9 +26,10 @@ import (
 	"github.com/mokasin/musicrawler/lib/web/tmpl"
 	"github.com/mokasin/musicrawler/model/album"
 	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/library"
 	"net/http"
 	"strconv"
-	"strings"
+	"unicode/utf8"
 )
 
 // Controller to serve artists
@@ -41,70 +43,137 @@ func NewArtist(env *env.Environment) *ControllerArtist {
 		controller.Controller: *controller.NewController(env),
 	}
 
-	c.Tmpl.AddTemplate("artist_index", "index", "artists")
-	c.Tmpl.AddTemplate("artist_show", "index", "artist")
+	c.Tmpl.AddTemplate("artist_index", "index", "pager", "artists")
+	c.Tmpl.AddTemplate("artist_show", "index", "pager", "artist")
 
 	return c
 }
 
-// Implementation of SelectHandler.
-func (self *ControllerArtist) Index(w http.ResponseWriter, r *http.Request) {
-	al, nal, err := artist.FirstLetters(self.Env.Db)
+// artists returns a page of the artists indexed by letter, ordered by their
+// sort names. An empty letter matches all artists. The artists are restricted
+// to the libraries ids, unless they are nil. The links of the artists point to
+// the route linkRoute.
+func (self *ControllerArtist) artists(letter string, ids []int64,
+	p *helper.Pagination, linkRoute string) ([]artist.Artist, error) {
+
+	q := query.New(self.Env.Db, "artist")
+	if letter != "" {
+		q = artist.LetterQuery(self.Env.Db, letter)
+	}
+
+	artistQuery(&self.Controller, q, ids)
+
+	var err error
+
+	p.Total, err = q.Count()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	letters := al
+	var artists []artist.Artist
 
-	// use zero to represent non alphabetic letters
-	if len(nal) != 0 {
-		letters = "0" + al
+	err = p.Apply(q, "sortkey", "ID").Exec(&artists)
+	if err != nil {
+		return nil, err
 	}
 
-	page := r.URL.Query().Get("page")
+	for i := 0; i < len(artists); i++ {
+		artists[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": artists[i].Id})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	switch {
-	case page == "":
-		// just go to the first page by default
-		page = string(letters[0])
-	case len(page) != 1:
-		// No request should contain more than 1 letter.
-		http.NotFound(w, r)
-		return
+	return artists, nil
+}
+
+// albums returns a page of the albums of artist a, that have tracks in the
+// libraries ids, unless they are nil. The links of the albums point to the
+// route linkRoute.
+func (self *ControllerArtist) albums(a *artist.Artist, ids []int64,
+	p *helper.Pagination, linkRoute string) ([]album.Album, error) {
+
+	q := a.AlbumsQuery(self.Env.Db)
+	if ids != nil {
+		q.WhereInQuery("ID", library.TracksQuery(self.Env.Db, ids),
+			"track.album_id")
 	}
 
-	// url validation
-	if !strings.ContainsAny(letters, page) {
-		http.NotFound(w, r)
-		return
+	var err error
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, err
 	}
 
-	// populating data
-	var artists []artist.Artist
+	var albums []album.Album
+
+	err = p.Apply(q, "name", "ID").Exec(&albums)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(albums); i++ {
+		albums[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": albums[i].Id})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return albums, nil
+}
+
+// containsLetter reports whether letter is one of letters.
+func containsLetter(letters []string, letter string) bool {
+	for _, l := range letters {
+		if l == letter {
+			return true
+		}
+	}
+
+	return false
+}
 
-	if string(page) == "0" {
-		err = artist.NonAlphaArtists(self.Env.Db).Exec(&artists)
-	} else {
-		err = query.New(self.Env.Db, "artist").
-			Like("name", page+"%").Exec(&artists)
+// Implementation of SelectHandler.
+func (self *ControllerArtist) Index(w http.ResponseWriter, r *http.Request) {
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
 	}
 
+	// only letters of artists in the libraries are indexed
+	letters, err := artist.FirstLetters(self.Env.Db, ids)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// prepare data for template
-	for i := 0; i < len(artists); i++ {
-		url, err := self.URL("artist", controller.Pairs{"id": artists[i].Id})
+	letter := r.URL.Query().Get("letter")
+	if letter == "" {
+		// just go to the first letter by default
+		letter = letters[0]
+	}
 
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// url validation
+	if !containsLetter(letters, letter) {
+		http.NotFound(w, r)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		artists[i].Link = url
+	// populating data
+	artists, err := self.artists(letter, ids, p, "artist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	url, err := self.URL("artist_base", nil)
@@ -113,16 +182,18 @@ func (self *ControllerArtist) Index(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pager := helper.NewPager(url, strings.Split(letters, ""), page)
+	pager := helper.NewPager(url, "letter", letters, letter)
 
 	self.Tmpl.AddDataToTemplate("artist_index", "Artists", artists)
 	self.Tmpl.AddDataToTemplate("artist_index", "Pager", pager)
+	self.Tmpl.AddDataToTemplate("artist_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
 
 	// render the website
 	self.Tmpl.RenderPage(
 		w,
 		"artist_index",
-		&tmpl.Page{Title: "Artists starting with " + string(page)},
+		&tmpl.Page{Title: "Artists starting with " + letter},
 	)
 }
 
@@ -133,6 +204,18 @@ func (self *ControllerArtist) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
 	if err := self.Env.Db.BeginTransaction(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -150,29 +233,28 @@ func (self *ControllerArtist) Show(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// retreive albums of artist
-	var albums []album.Album
-
-	err = artist.AlbumsQuery(self.Env.Db).Order("name").Exec(&albums)
-
+	albums, err := self.albums(&artist, ids, p, "album")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// prepare data for template
-	for i := 0; i < len(albums); i++ {
-		url, err := self.URL("album", controller.Pairs{"id": albums[i].Id})
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// artists without albums in the libraries are hidden
+	if ids != nil && p.Total == 0 {
+		http.NotFound(w, r)
+		return
+	}
 
-		albums[i].Link = url
+	url, err := self.URL("artist", controller.Pairs{"id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	self.Tmpl.AddDataToTemplate("artist_show", "Artist", &artist)
 	self.Tmpl.AddDataToTemplate("artist_show", "Albums", &albums)
+	self.Tmpl.AddDataToTemplate("artist_show", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
 
 	backlink, _ := self.URL("artist_base", nil)
 
@@ -183,3 +265,108 @@ func (self *ControllerArtist) Show(w http.ResponseWriter, r *http.Request) {
 		&tmpl.Page{Title: artist.Name, BackLink: backlink},
 	)
 }
+
+// APIIndex serves a page of artists as JSON. The artists can be restricted to
+// those indexed by the letter given by the URL parameter letter.
+func (self *ControllerArtist) APIIndex(w http.ResponseWriter, r *http.Request) {
+	letter := r.URL.Query().Get("letter")
+
+	switch {
+	case utf8.RuneCountInString(letter) > 1:
+		http.NotFound(w, r)
+		return
+	case letter != "":
+		// accept any letter of a bucket, like "é" for "E"
+		letter = helper.IndexLetter(letter)
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	artists, err := self.artists(letter, ids, p, "api_artist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	listing := &controller.Listing{Pagination: p, Items: artists}
+
+	if len(artists) == int(p.PerPage) {
+		last := artists[len(artists)-1]
+		listing.NextCursor = helper.EncodeCursor(last.SortKey, last.Id)
+	}
+
+	self.RenderJSON(w, listing)
+}
+
+// APIShow serves an artist and a page of its albums as JSON.
+func (self *ControllerArtist) APIShow(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	var a artist.Artist
+
+	err = query.New(self.Env.Db, "artist").Find(id).Exec(&a)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	albums, err := self.albums(&a, ids, p, "api_album")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// artists without albums in the libraries are hidden
+	if ids != nil && p.Total == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	listing := &controller.Listing{Pagination: p, Items: albums}
+
+	if len(albums) == int(p.PerPage) {
+		last := albums[len(albums)-1]
+		listing.NextCursor = helper.EncodeCursor(last.Name, last.Id)
+	}
+
+	self.RenderJSON(w, struct {
+		*artist.Artist
+		Albums *controller.Listing `json:"albums"`
+	}{&a, listing})
+}
@@ -0,0 +1,148 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/model/user"
+	"net/http"
+)
+
+// Name of the cookie and the URL parameter carrying the token of a user.
+const tokenName = "token"
+
+// Header carrying the token of a user.
+const tokenHeader = "X-Auth-Token"
+
+// Name of the URL parameter carrying the feed token of a user.
+const feedTokenName = "feed"
+
+var (
+	errUnauthorized = errors.New("Authentication required.")
+	errForbidden    = errors.New("Administrative rights required.")
+)
+
+// currentUser returns the user authenticated by the request r. The token is
+// read from the header X-Auth-Token, the URL parameter token or the cookie
+// token, in this order. A token given by the URL parameter is stored in the
+// cookie, so links don't have to carry it.
+//
+// If no token is given, nil is returned. An unknown token results in
+// errUnauthorized.
+func currentUser(c *controller.Controller, w http.ResponseWriter,
+	r *http.Request) (*user.User, error) {
+
+	token := r.Header.Get(tokenHeader)
+	fromParam := false
+
+	if token == "" {
+		token = r.URL.Query().Get(tokenName)
+		fromParam = token != ""
+	}
+
+	if token == "" {
+		if cookie, err := r.Cookie(tokenName); err == nil {
+			token = cookie.Value
+		}
+	}
+
+	if token == "" {
+		return nil, nil
+	}
+
+	u, err := user.ByToken(c.Env.Db, token)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, errUnauthorized
+	case err != nil:
+		return nil, err
+	}
+
+	if fromParam && w != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenName,
+			Value:    token,
+			Path:     "/",
+			HttpOnly: true,
+		})
+	}
+
+	return u, nil
+}
+
+// feedUser is like currentUser, but also accepts the feed token of a user by
+// the URL parameter feed. Only feeds and the content of the tracks of the
+// libraries visible to the user are served to users authenticated that way.
+func feedUser(c *controller.Controller, r *http.Request) (*user.User, error) {
+	token := r.URL.Query().Get(feedTokenName)
+	if token == "" {
+		return currentUser(c, nil, r)
+	}
+
+	u, err := user.ByFeedToken(c.Env.Db, token)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, errUnauthorized
+	case err != nil:
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// requireUser is like currentUser, but results in errUnauthorized if no user
+// is authenticated.
+func requireUser(c *controller.Controller, w http.ResponseWriter,
+	r *http.Request) (*user.User, error) {
+
+	u, err := currentUser(c, w, r)
+	if err == nil && u == nil {
+		err = errUnauthorized
+	}
+
+	return u, err
+}
+
+// requireAdmin is like requireUser, but results in errForbidden if the user
+// is no admin.
+func requireAdmin(c *controller.Controller, w http.ResponseWriter,
+	r *http.Request) (*user.User, error) {
+
+	u, err := requireUser(c, w, r)
+	if err == nil && !u.IsAdmin() {
+		err = errForbidden
+	}
+
+	return u, err
+}
+
+// authError writes err as response. errUnauthorized results in the status
+// 401, errForbidden in 403, other errors in 500.
+func authError(w http.ResponseWriter, err error) {
+	switch err {
+	case errUnauthorized:
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	case errForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
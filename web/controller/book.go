@@ -0,0 +1,460 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/book"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/user"
+	"net/http"
+	"strconv"
+)
+
+// Controller to serve the books of audiobook libraries and the books users are
+// listening to.
+type ControllerBook struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewBook(env *env.Environment) *ControllerBook {
+	c := &ControllerBook{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("book_index", "index", "pager", "books")
+	c.Tmpl.AddTemplate("book_show", "index", "book")
+	c.Tmpl.AddTemplate("book_continue", "index", "pager", "continue")
+
+	return c
+}
+
+// books returns a page of the books of the libraries ids ordered by title.
+// nil ids contain all libraries. The links of the books point to the route
+// linkRoute.
+//
+// Returns the books and the cursor to the next page.
+func (self *ControllerBook) books(ids []int64, p *helper.Pagination,
+	linkRoute string) ([]book.Book, string, error) {
+
+	q := query.New(self.Env.Db, "book")
+	if ids != nil {
+		library.Restrict(q, "book.library_id", ids)
+	}
+
+	var err error
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var books []book.Book
+
+	err = p.Apply(q, "book.title", "book.ID").Exec(&books)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(books); i++ {
+		books[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": books[i].Id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(books) == int(p.PerPage) {
+		last := books[len(books)-1]
+		cursor = helper.EncodeCursor(last.Title, last.Id)
+	}
+
+	return books, cursor, nil
+}
+
+// show retrieves the book with the id given by the URL, its parts and the
+// bookmark of the user u. A nil user and a user, that didn't listen to the
+// book yet, have no bookmark. Books of libraries the user authenticated by r
+// can't see result in sql.ErrNoRows.
+func (self *ControllerBook) show(r *http.Request, u *user.User) (*book.Book,
+	[]book.Part, *book.Bookmark, error) {
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var b book.Book
+
+	err = query.New(self.Env.Db, "book").Find(id).Exec(&b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !containsLibrary(ids, b.LibraryID) {
+		return nil, nil, nil, sql.ErrNoRows
+	}
+
+	var parts []book.Part
+
+	err = b.PartsQuery(self.Env.Db).Exec(&parts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for i := 0; i < len(parts); i++ {
+		parts[i].Chapters = book.DecodeChapters(parts[i].RawChapters,
+			parts[i].Length)
+
+		parts[i].Link, err = trackLink(&self.Controller, &parts[i].Track)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if u == nil {
+		return &b, parts, nil, nil
+	}
+
+	bookmark, err := book.BookmarkOf(self.Env.Db, u.Id, b.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		return &b, parts, nil, nil
+	case err != nil:
+		return nil, nil, nil, err
+	}
+
+	return &b, parts, bookmark, nil
+}
+
+// progress returns a page of the books of the libraries ids the user u is
+// listening to, latest first. nil ids contain all libraries. The links of the
+// books point to the route linkRoute.
+//
+// Returns the books and the cursor to the next page.
+func (self *ControllerBook) progress(u *user.User, ids []int64,
+	p *helper.Pagination, linkRoute string) ([]book.Progress, string, error) {
+
+	q := book.ProgressQuery(self.Env.Db, u.Id)
+	if ids != nil {
+		library.Restrict(q, "book.library_id", ids)
+	}
+
+	var err error
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var books []book.Progress
+
+	err = p.Apply(q, "-bookmark.updated", "-book.ID").Exec(&books)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(books); i++ {
+		books[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": books[i].Id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(books) == int(p.PerPage) {
+		last := books[len(books)-1]
+		cursor = helper.EncodeCursor(last.Updated, last.Id)
+	}
+
+	return books, cursor, nil
+}
+
+// audiobookLibraries returns the audiobook libraries of libs.
+func audiobookLibraries(libs []library.Library) []library.Library {
+	var books []library.Library
+
+	for _, l := range libs {
+		if l.IsAudiobooks() {
+			books = append(books, l)
+		}
+	}
+
+	return books
+}
+
+// Index shows a page of books.
+func (self *ControllerBook) Index(w http.ResponseWriter, r *http.Request) {
+	choices, selected, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	books, _, err := self.books(ids, p, "book")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("book_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("book_index", "Books", &books)
+	self.Tmpl.AddDataToTemplate("book_index", "Libraries",
+		audiobookLibraries(choices))
+	self.Tmpl.AddDataToTemplate("book_index", "Library", selected)
+	self.Tmpl.AddDataToTemplate("book_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"book_index",
+		&tmpl.Page{Title: "Audiobooks"},
+	)
+}
+
+// Show shows a book with its parts and chapters. Authenticated users resume
+// the book at their bookmark.
+func (self *ControllerBook) Show(w http.ResponseWriter, r *http.Request) {
+	u, err := currentUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	b, parts, bookmark, err := self.show(r, u)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backlink, _ := self.URL("book_base", nil)
+
+	self.Tmpl.AddDataToTemplate("book_show", "Book", b)
+	self.Tmpl.AddDataToTemplate("book_show", "Parts", &parts)
+	self.Tmpl.AddDataToTemplate("book_show", "Bookmark", bookmark)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"book_show",
+		&tmpl.Page{Title: b.Title, BackLink: backlink},
+	)
+}
+
+// Continue shows a page of the books the authenticated user is listening to,
+// latest first.
+func (self *ControllerBook) Continue(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	books, _, err := self.progress(u, ids, p, "book")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("book_continue", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("book_continue", "Books", &books)
+	self.Tmpl.AddDataToTemplate("book_continue", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"book_continue",
+		&tmpl.Page{Title: "Continue listening"},
+	)
+}
+
+// APIIndex serves a page of books as JSON.
+func (self *ControllerBook) APIIndex(w http.ResponseWriter, r *http.Request) {
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	books, cursor, err := self.books(ids, p, "api_book")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: p,
+		NextCursor: cursor,
+		Items:      books,
+	})
+}
+
+// APIShow serves a book with its parts, their chapters and the bookmark of the
+// authenticated user as JSON.
+func (self *ControllerBook) APIShow(w http.ResponseWriter, r *http.Request) {
+	u, err := currentUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	b, parts, bookmark, err := self.show(r, u)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if parts == nil {
+		parts = []book.Part{}
+	}
+
+	self.RenderJSON(w, struct {
+		*book.Book
+		Parts    []book.Part    `json:"parts"`
+		Bookmark *book.Bookmark `json:"bookmark"`
+	}{b, parts, bookmark})
+}
+
+// APIContinue serves a page of the books the authenticated user is listening
+// to as JSON, latest first.
+func (self *ControllerBook) APIContinue(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	books, cursor, err := self.progress(u, ids, p, "api_book")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: p,
+		NextCursor: cursor,
+		Items:      books,
+	})
+}
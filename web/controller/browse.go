@@ -0,0 +1,432 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Controller to browse the tracks by the folders of the crawl roots, so
+// tracks without tags can be found, too.
+//
+// The first folder of a browsed path is a crawl root, named by its base name.
+// Roots of the same base name are numbered in the order of their paths.
+type ControllerBrowse struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewBrowse(env *env.Environment) *ControllerBrowse {
+	c := &ControllerBrowse{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("browse_show", "index", "pager", "browse")
+
+	return c
+}
+
+// folder is a subfolder of a browsed folder with the number of tracks in it.
+type folder struct {
+	Name   string `json:"name"`
+	Tracks int    `json:"tracks"`
+	Link   string `json:"link"`
+}
+
+// folderListing is a browsed folder with its subfolders and a page of the
+// tracks directly in it. Parents are the folders above it, starting at the
+// top.
+type folderListing struct {
+	*helper.Pagination
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Name       string        `json:"name"`
+	Path       string        `json:"path"`
+	Parents    []folder      `json:"parents"`
+	Folders    []folder      `json:"folders"`
+	Tracks     []track.Track `json:"tracks"`
+}
+
+// browseLink returns the link to the folder at the browsed path p.
+func browseLink(c *controller.Controller, p string) (string, error) {
+	if p == "" {
+		return c.URL("browse_base", nil)
+	}
+
+	return c.URL("browse", controller.Pairs{"path": p})
+}
+
+// browseRoots returns the crawl roots having tracks in the libraries ids by
+// their names.
+func browseRoots(c *controller.Controller,
+	ids []int64) ([]track.SourceInfo, map[string]string, error) {
+
+	q := track.SourcesQuery(c.Env.Db)
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var sources []track.SourceInfo
+
+	if err := q.Exec(&sources); err != nil {
+		return nil, nil, err
+	}
+
+	names := make(map[string]string)
+
+	for i := 0; i < len(sources); i++ {
+		base := path.Base(strings.TrimRight(sources[i].Source, "/"))
+		if base == "." || base == "/" {
+			base = "root"
+		}
+
+		name := base
+		for n := 2; names[name] != ""; n++ {
+			name = fmt.Sprintf("%s (%d)", base, n)
+		}
+
+		names[name] = sources[i].Source
+		sources[i].Source = name
+	}
+
+	return sources, names, nil
+}
+
+// browseFolder returns the source and the folder within it of the browsed path
+// p. Unknown roots result in sql.ErrNoRows.
+func browseFolder(c *controller.Controller, ids []int64,
+	p string) (string, string, error) {
+
+	_, names, err := browseRoots(c, ids)
+	if err != nil {
+		return "", "", err
+	}
+
+	root, dir := p, "."
+	if i := strings.Index(p, "/"); i >= 0 {
+		root, dir = p[:i], p[i+1:]
+	}
+
+	source, ok := names[root]
+	if !ok {
+		return "", "", sql.ErrNoRows
+	}
+
+	return source, dir, nil
+}
+
+// browseTracks returns the tracks in the folder dir of the source and below
+// it in the libraries ids, ordered by their paths. Empty folders result in
+// sql.ErrNoRows.
+func browseTracks(c *controller.Controller, ids []int64,
+	source, dir string) ([]track.Track, error) {
+
+	q := track.FolderQuery(c.Env.Db, source, dir).
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id")
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var tracks []track.Track
+
+	if err := q.Exec(&tracks); err != nil {
+		return nil, err
+	}
+
+	if len(tracks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return tracks, nil
+}
+
+// browseListing returns the listing of the folder at the browsed path p with
+// the page pg of its tracks. The empty path lists the crawl roots. Folders
+// without tracks in or below them result in sql.ErrNoRows.
+func browseListing(c *controller.Controller, ids []int64, p string,
+	pg *helper.Pagination) (*folderListing, error) {
+
+	fl := &folderListing{Pagination: pg, Name: path.Base(p), Path: p,
+		Parents: []folder{}, Folders: []folder{}, Tracks: []track.Track{}}
+
+	if p == "" {
+		fl.Name = "Folders"
+
+		roots, _, err := browseRoots(c, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range roots {
+			f := folder{Name: r.Source, Tracks: r.Tracks}
+			if f.Link, err = browseLink(c, r.Source); err != nil {
+				return nil, err
+			}
+			fl.Folders = append(fl.Folders, f)
+		}
+
+		return fl, nil
+	}
+
+	source, dir, err := browseFolder(c, ids, p)
+	if err != nil {
+		return nil, err
+	}
+
+	// tracks below subfolders are counted for them
+	q := track.FolderQuery(c.Env.Db, source, dir)
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	folders, err := track.Subfolders(c.Env.Db, q, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range folders {
+		f := folder{Name: sub.Name, Tracks: sub.Tracks}
+		if f.Link, err = browseLink(c, p+"/"+sub.Name); err != nil {
+			return nil, err
+		}
+		fl.Folders = append(fl.Folders, f)
+	}
+
+	tq := track.FilesQuery(c.Env.Db, source, dir).
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id")
+	if ids != nil {
+		library.Restrict(tq, "track.library_id", ids)
+	}
+
+	pg.Total, err = tq.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(folders) == 0 && pg.Total == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	err = pg.Apply(tq, "track.path", "track.ID").Exec(&fl.Tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(fl.Tracks); i++ {
+		fl.Tracks[i].Link, err = trackLink(c, &fl.Tracks[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(fl.Tracks) == int(pg.PerPage) {
+		last := fl.Tracks[len(fl.Tracks)-1]
+		fl.NextCursor = helper.EncodeCursor(last.Path, last.Id)
+	}
+
+	parent := ""
+	for _, name := range append([]string{""}, strings.Split(p, "/")...) {
+		parent = strings.TrimPrefix(parent+"/"+name, "/")
+
+		f := folder{Name: name}
+		if name == "" {
+			f.Name = "Folders"
+		}
+		if f.Link, err = browseLink(c, parent); err != nil {
+			return nil, err
+		}
+		fl.Parents = append(fl.Parents, f)
+	}
+
+	// the folder itself isn't its parent
+	fl.Parents = fl.Parents[:len(fl.Parents)-1]
+
+	return fl, nil
+}
+
+// browsePath returns the browsed path of the request r. See cleanBrowsePath.
+func browsePath(r *http.Request) string {
+	return cleanBrowsePath(mux.Vars(r)["path"])
+}
+
+// cleanBrowsePath returns the browsed path p without empty and dot elements
+// and surrounding slashes. Elements of two dots remove the folder before
+// them, but don't lead above the crawl roots.
+func cleanBrowsePath(p string) string {
+	return strings.Trim(path.Clean("/"+p), "/")
+}
+
+// Show lists the subfolders and tracks of a folder. If the URL parameter
+// download is given, the tracks in and below the folder are served as ZIP
+// archive.
+func (self *ControllerBrowse) Show(w http.ResponseWriter, r *http.Request) {
+	p := browsePath(r)
+
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if _, ok := r.URL.Query()["download"]; ok && p != "" {
+		self.download(w, r, ids, p)
+		return
+	}
+
+	pg, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	fl, err := browseListing(&self.Controller, ids, p, pg)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var backlink string
+	if len(fl.Parents) > 0 {
+		backlink = fl.Parents[len(fl.Parents)-1].Link
+	}
+
+	// folders are played and downloaded as a whole, but not all roots at once
+	var queuelink, downloadlink string
+
+	if p != "" {
+		queuelink, err = self.URL("api_queue_browse", controller.Pairs{"path": p})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		downloadlink, err = browseLink(&self.Controller, p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		downloadlink += "?download"
+	}
+
+	self.Tmpl.AddDataToTemplate("browse_show", "QueueLink", queuelink)
+	self.Tmpl.AddDataToTemplate("browse_show", "DownloadLink", downloadlink)
+	url, err := browseLink(&self.Controller, p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("browse_show", "Folder", fl)
+	self.Tmpl.AddDataToTemplate("browse_show", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), pg))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"browse_show",
+		&tmpl.Page{Title: fl.Name, BackLink: backlink},
+	)
+}
+
+// download serves the tracks in and below the folder at the browsed path p as
+// ZIP archive.
+func (self *ControllerBrowse) download(w http.ResponseWriter, r *http.Request,
+	ids []int64, p string) {
+
+	// the database isn't locked while the archive is streamed
+	tracks, err := func() ([]track.Track, error) {
+		if err := self.Env.Db.BeginTransaction(); err != nil {
+			return nil, err
+		}
+		defer self.Env.Db.EndTransaction()
+
+		source, dir, err := browseFolder(&self.Controller, ids, p)
+		if err != nil {
+			return nil, err
+		}
+
+		return browseTracks(&self.Controller, ids, source, dir)
+	}()
+
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := archiveName(path.Base(p))
+
+	serveArchive(&self.Controller, w, name, name, tracks)
+}
+
+// APIShow serves the subfolders and tracks of a folder as JSON.
+func (self *ControllerBrowse) APIShow(w http.ResponseWriter, r *http.Request) {
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	pg, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	fl, err := browseListing(&self.Controller, ids, browsePath(r), pg)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, fl)
+}
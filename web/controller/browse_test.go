@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCleanBrowsePath(t *testing.T) {
+	for p, want := range map[string]string{
+		"":                "",
+		"/":               "",
+		"Music/":          "Music",
+		"/Music//Rock/":   "Music/Rock",
+		"Music/./Rock":    "Music/Rock",
+		"Music/Rock/..":   "Music",
+		"Music/../../etc": "etc",
+		"..":              "",
+	} {
+		if got := cleanBrowsePath(p); got != want {
+			t.Errorf("%q: want %q, got %q.", p, want, got)
+		}
+	}
+}
+
+func TestBrowseListing(t *testing.T) {
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Register(artist.CreateArtistTable)
+	db.Register(album.CreateAlbumTable)
+	db.Register(track.CreateTrackTable)
+
+	if err := db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Execute("INSERT INTO Artist (name, sortname, sortkey, letter) " +
+		"VALUES ('Artist', 'Artist', 'artist', 'A');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Execute("INSERT INTO Album (name, artist_id) VALUES ('Album', 1);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"Rock/a.mp3", "Rock/b.mp3", "Rock/c.mp3",
+		"Rock/Live/d.mp3", "Rock/Live/Encore/e.mp3", "Rock/Über/f.mp3",
+		"Rock.mp3", "Rockabilly/g.mp3"} {
+
+		_, err := db.Execute("INSERT INTO Track (source, path, title, "+
+			"tracknumber, year, length, genre, format, bitrate, size, "+
+			"fingerprint, album_id, library_id, chapters, description, added, "+
+			"filemtime, dbmtime) VALUES ('/music', ?, ?, 0, 0, 0, '', 'mp3', "+
+			"0, 0, '', 1, 1, '', '', 0, 0, 0);", p, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := env.New(db, "")
+	for _, route := range [][2]string{
+		{"browse_base", "/browse"},
+		{"browse", "/browse/{path:.+}"},
+		{"content", "/content/{id:[0-9]+}/{filename}"},
+	} {
+		e.Router.HandleFunc(route[1],
+			func(w http.ResponseWriter, r *http.Request) {}).Name(route[0])
+	}
+	c := controller.NewController(e)
+
+	pg, err := helper.NewPagination(url.Values{"per_page": {"2"}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fl, err := browseListing(c, nil, "music/Rock", pg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []folder{
+		{Name: "Live", Tracks: 2, Link: "/browse/music/Rock/Live"},
+		{Name: "Über", Tracks: 1, Link: "/browse/music/Rock/%C3%9Cber"},
+	}
+	if !reflect.DeepEqual(fl.Folders, want) {
+		t.Errorf("Want folders %v, got %v.", want, fl.Folders)
+	}
+
+	var paths []string
+	for _, tr := range fl.Tracks {
+		paths = append(paths, tr.Path)
+	}
+
+	if !reflect.DeepEqual(paths, []string{"Rock/a.mp3", "Rock/b.mp3"}) ||
+		fl.Total != 3 || fl.NextCursor == "" {
+		t.Errorf("Wrong first page of %d tracks %v.", fl.Total, paths)
+	}
+
+	fl, err = browseListing(c, nil, "music/Rock/Live/Encore", pg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fl.Folders) != 0 || len(fl.Tracks) != 1 || len(fl.Parents) != 4 {
+		t.Errorf("Wrong listing of a folder without subfolders: %+v", fl)
+	}
+
+	if _, err := browseListing(c, nil, "music/Pop", pg); err == nil {
+		t.Errorf("Listed a folder without tracks.")
+	}
+}
@@ -18,11 +18,23 @@ package controller
 
 import (
 	"code.google.com/p/gorilla/mux"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/mokasin/musicrawler/lib/database/query"
 	"github.com/mokasin/musicrawler/lib/web/controller"
 	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/track"
+	"io"
+	"io/fs"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
+	"time"
 )
 
 type ControllerContent struct {
@@ -30,8 +42,11 @@ type ControllerContent struct {
 }
 
 type trackPathId struct {
-	Id   int    `column:"ID"`
-	Path string `column:"path"`
+	Id        int    `column:"ID"`
+	Source    string `column:"source"`
+	Path      string `column:"path"`
+	Format    string `column:"format"`
+	LibraryID int64  `column:"library_id"`
 }
 
 func NewContent(env *env.Environment) *ControllerContent {
@@ -40,7 +55,13 @@ func NewContent(env *env.Environment) *ControllerContent {
 	}
 }
 
-// Serving a audio file that has an entry in the database.
+// Serving a audio file that has an entry in the database from the file system
+// of its source. Only tracks of libraries visible to the user are served.
+//
+// The content type is given by the format of the track. Unknown tracks result
+// in the status 404, tracks whose file was removed since the last update in
+// 410. The file is served inline, or as download if the URL parameter download
+// is given.
 func (self *ControllerContent) Show(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(mux.Vars(r)["id"])
 
@@ -49,13 +70,159 @@ func (self *ControllerContent) Show(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var track trackPathId
+	var t trackPathId
 
-	err = query.New(self.Env.Db, "track").Find(id).Exec(&track)
+	err = query.New(self.Env.Db, "track").Find(id).Exec(&t)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// feeds link to the tracks with the feed token of the user
+	u, err := feedUser(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	// tracks of libraries hidden from the user are reported as missing
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !containsLibrary(ids, t.LibraryID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	fsys, ok := self.Env.Files[t.Source]
+	if !ok {
+		http.Error(w, "The source of the track is not available.",
+			http.StatusNotFound)
+		return
+	}
+
+	f, err := fsys.Open(t.Path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "The file of the track was removed.", http.StatusGone)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.ServeFile(w, r, track.Path)
+	disposition := "inline"
+	if _, ok := r.URL.Query()["download"]; ok {
+		disposition = "attachment"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", track.MimeType(t.Format))
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition,
+		map[string]string{"filename": path.Base(t.Path)}))
+	h.Set("ETag", etag(t.Source, t.Path, info.ModTime()))
+	h.Set("Cache-Control", "private, max-age=86400")
+
+	cw := &countingWriter{ResponseWriter: w}
+
+	// files of file systems without random access are streamed as a whole
+	if content, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(cw, r, path.Base(t.Path), info.ModTime(), content)
+	} else {
+		serveStream(cw, r, info, f)
+	}
+
+	if cw.crossed(play.Threshold) {
+		// plays of unknown users are recorded anonymously
+		var userID int64
+		if u != nil {
+			userID = u.Id
+		}
+
+		play.Record(self.Env.Db, int64(t.Id), userID, time.Now().Unix())
+	}
+}
+
+// serveStream serves the whole content of the file described by info without
+// ranges. The entity tag has to be set in the header already.
+func serveStream(w http.ResponseWriter, r *http.Request, info fs.FileInfo,
+	content io.Reader) {
+
+	h := w.Header()
+
+	if match := r.Header.Get("If-None-Match"); match != "" &&
+		(match == "*" || match == h.Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != "HEAD" {
+		io.Copy(w, content)
+	}
+}
+
+// etag returns a strong entity tag of the file at path within the source with
+// the ID source, that was modified at mtime.
+func etag(source, path string, mtime time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%d", source, path,
+		mtime.UnixNano())))
+
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// countingWriter counts the bytes of the body written to the embedded
+// ResponseWriter.
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (self *countingWriter) Write(b []byte) (int, error) {
+	n, err := self.ResponseWriter.Write(b)
+	self.written += int64(n)
+	return n, err
+}
+
+// crossed reports whether the written body contained the byte at the fraction
+// threshold of the whole file. Clients requesting the file in several ranges
+// cross it exactly once.
+func (self *countingWriter) crossed(threshold float64) bool {
+	var start, size int64
+
+	h := self.Header()
+
+	if cr := h.Get("Content-Range"); cr != "" {
+		var end int64
+		_, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size)
+		if err != nil {
+			return false
+		}
+	} else {
+		var err error
+		size, err = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return false
+		}
+	}
+
+	mark := int64(float64(size) * threshold)
+
+	return self.written > 0 && start <= mark && mark < start+self.written
 }
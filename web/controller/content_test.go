@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestServeStream(t *testing.T) {
+	const data = "0123456789"
+
+	fsys := fstest.MapFS{"a.mp3": &fstest.MapFile{Data: []byte(data)}}
+	info, err := fsys.Stat("a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/content/1", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+
+		w := httptest.NewRecorder()
+		w.Header().Set("ETag", `"tag"`)
+
+		serveStream(w, r, info, strings.NewReader(data))
+
+		return w
+	}
+
+	// ranges of streamed files are answered with the whole file
+	for _, header := range []string{"", "Range"} {
+		w := serve(header, "bytes=2-5")
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: want status 200, got %d.", header, w.Code)
+		}
+		if w.Body.String() != data {
+			t.Errorf("%q: want body %q, got %q.", header, data, w.Body.String())
+		}
+		if ar := w.Header().Get("Accept-Ranges"); ar != "" {
+			t.Errorf("%q: want no Accept-Ranges, got %q.", header, ar)
+		}
+		if cl := w.Header().Get("Content-Length"); cl != "10" {
+			t.Errorf("%q: want Content-Length 10, got %q.", header, cl)
+		}
+	}
+
+	if w := serve("If-None-Match", `"tag"`); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: want status 304, got %d.", w.Code)
+	}
+}
@@ -0,0 +1,103 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+)
+
+// Controller to serve the report of duplicate tracks. As it exposes the paths
+// of the tracks, it is restricted to admins.
+type ControllerDuplicate struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewDuplicate(env *env.Environment) *ControllerDuplicate {
+	c := &ControllerDuplicate{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("duplicate_index", "index", "duplicates")
+
+	return c
+}
+
+// duplicates returns all groups of duplicate tracks with links to their
+// content.
+func (self *ControllerDuplicate) duplicates() ([]track.DuplicateGroup, error) {
+	groups, err := track.Duplicates(self.Env.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(groups); i++ {
+		for j := 0; j < len(groups[i].Copies); j++ {
+			c := &groups[i].Copies[j]
+
+			c.Link, err = trackLink(&self.Controller, &c.Track)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// Index shows all groups of duplicate tracks side by side.
+func (self *ControllerDuplicate) Index(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	groups, err := self.duplicates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("duplicate_index", "Groups", &groups)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"duplicate_index",
+		&tmpl.Page{Title: "Duplicates"},
+	)
+}
+
+// APIIndex serves all groups of duplicate tracks as JSON.
+func (self *ControllerDuplicate) APIIndex(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	groups, err := self.duplicates()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{Items: groups})
+}
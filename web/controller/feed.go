@@ -0,0 +1,320 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/playlist"
+	"github.com/mokasin/musicrawler/model/track"
+	"github.com/mokasin/musicrawler/model/user"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Controller to serve tracks as RSS 2.0 podcast feeds with iTunes extensions,
+// so they can be listened to in podcast apps. As podcast apps don't keep
+// cookies, feeds are requested with the feed token of a user, which is passed
+// on to the tracks of the feed. It grants nothing but reading feeds and the
+// tracks of the libraries visible to the user, so the secret token of the user
+// isn't handed out.
+type ControllerFeed struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewFeed(env *env.Environment) *ControllerFeed {
+	return &ControllerFeed{
+		controller.Controller: *controller.NewController(env),
+	}
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Generator   string    `xml:"generator"`
+	Author      string    `xml:"itunes:author"`
+	Summary     string    `xml:"itunes:summary"`
+	Explicit    string    `xml:"itunes:explicit"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+	Author    string       `xml:"itunes:author"`
+	Duration  string       `xml:"itunes:duration"`
+	Episode   int          `xml:"itunes:episode,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// absoluteURL returns the absolute URL of the path link on the server
+// requested by r. A non-empty feed token is added.
+func absoluteURL(r *http.Request, link, feedToken string) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: link}
+
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		u.Scheme = "https"
+	}
+
+	if feedToken != "" {
+		u.RawQuery = url.Values{feedTokenName: {feedToken}}.Encode()
+	}
+
+	return u.String()
+}
+
+// feedLink returns the link to the feed of the route name with the route
+// variables pairs. The feed token of the user u is added, so the feed can be
+// subscribed to. Anonymous users are nil.
+func feedLink(c *controller.Controller, u *user.User, name string,
+	pairs controller.Pairs) (string, error) {
+
+	link, err := c.URL(name, pairs)
+	if err != nil || u == nil || u.FeedToken == "" {
+		return link, err
+	}
+
+	return link + "?" + url.Values{feedTokenName: {u.FeedToken}}.Encode(), nil
+}
+
+// renderFeed writes the tracks as feed titled title for the user u. The feed
+// links to the page link. Podcast apps order episodes by date, so the tracks
+// are dated one minute apart in their order starting at the earliest date of
+// adding.
+func (self *ControllerFeed) renderFeed(w http.ResponseWriter, r *http.Request,
+	u *user.User, title, author, link string, tracks []track.Track) {
+
+	var feedToken string
+	if u != nil {
+		feedToken = u.FeedToken
+	}
+
+	feed := rss{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        absoluteURL(r, link, ""),
+			Description: title,
+			Generator:   "musicrawler",
+			Author:      author,
+			Summary:     title,
+			Explicit:    "false",
+		},
+	}
+
+	var start int64
+	for i, t := range tracks {
+		if i == 0 || t.Added < start {
+			start = t.Added
+		}
+	}
+
+	for i, t := range tracks {
+		link, err := trackLink(&self.Controller, &t)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:   t.Title,
+			GUID:    rssGUID{IsPermaLink: "false", Value: fmt.Sprintf("track:%d", t.Id)},
+			PubDate: time.Unix(start+int64(i)*60, 0).UTC().Format(time.RFC1123Z),
+			Enclosure: rssEnclosure{
+				URL:    absoluteURL(r, link, feedToken),
+				Length: t.Size,
+				Type:   track.MimeType(t.Format),
+			},
+			Author:   t.Artist,
+			Duration: strconv.Itoa(t.Length),
+			Episode:  t.Tracknumber,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	enc.Encode(&feed)
+}
+
+// Album serves the tracks of an album as feed. Albums of libraries hidden from
+// the user result in the status 404.
+func (self *ControllerFeed) Album(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u, err := feedUser(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	var a album.Album
+
+	err = query.New(self.Env.Db, "album").Find(id).Exec(&a)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// albums of other libraries are hidden
+	visible, err := albumVisible(&self.Controller, id, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := a.TracksQuery(self.Env.Db).
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id").
+		Order("track.tracknumber").
+		Order("track.path")
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var tracks []track.Track
+
+	if err := q.Exec(&tracks); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var artist string
+	if len(tracks) > 0 {
+		artist = tracks[0].Artist
+	}
+
+	link, err := self.URL("album", controller.Pairs{"id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.renderFeed(w, r, u, a.Name, artist, link, tracks)
+}
+
+// Playlist serves the tracks of a playlist of the user as feed. Playlists of
+// other users result in the status 404.
+func (self *ControllerFeed) Playlist(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u, err := feedUser(&self.Controller, r)
+	if err == nil && u == nil {
+		err = errUnauthorized
+	}
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := playlist.Load(self.Env.Db, id, u.Id)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tracks, err := playlistTracks(&self.Controller, p, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	link, err := self.URL("playlist", controller.Pairs{"id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.renderFeed(w, r, u, p.Name, u.Name, link, tracks)
+}
@@ -0,0 +1,295 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/artist"
+	"github.com/mokasin/musicrawler/model/genre"
+	"github.com/mokasin/musicrawler/model/library"
+	"net/http"
+	"strconv"
+)
+
+// Controller to serve genres
+type ControllerGenre struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewGenre(env *env.Environment) *ControllerGenre {
+	c := &ControllerGenre{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("genre_index", "index", "pager", "genres")
+	c.Tmpl.AddTemplate("genre_show", "index", "pager", "genre")
+
+	return c
+}
+
+// genres returns a page of all genres with the number of their tracks. The
+// tracks are restricted to the libraries ids, unless they are nil. The links of
+// the genres point to the route linkRoute.
+//
+// Returns the genres and the cursor to the next page.
+func (self *ControllerGenre) genres(ids []int64, p *helper.Pagination,
+	linkRoute string) ([]genre.GenreInfo, string, error) {
+
+	q := genre.InfoQuery(self.Env.Db)
+	if ids != nil {
+		q.WhereInQuery("trackgenre.track_id",
+			library.TracksQuery(self.Env.Db, ids), "track.ID")
+	}
+
+	var err error
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var genres []genre.GenreInfo
+
+	err = p.Apply(q, "genre.name", "genre.ID").Exec(&genres)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(genres); i++ {
+		genres[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": genres[i].Id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(genres) == int(p.PerPage) {
+		last := &genres[len(genres)-1]
+		cursor = helper.EncodeCursor(last.Name, last.Id)
+	}
+
+	return genres, cursor, nil
+}
+
+// show retrieves the genre with the id given by the URL, all its artists and a
+// page of its albums. The links of artists and albums point to the routes
+// artistRoute and albumRoute.
+func (self *ControllerGenre) show(r *http.Request, lp *listingParams,
+	artistRoute, albumRoute string) (*genre.Genre, []artist.Artist,
+	[]album.AlbumInfo, string, error) {
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	var g genre.Genre
+
+	err = query.New(self.Env.Db, "genre").Find(id).Exec(&g)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	var artists []artist.Artist
+
+	err = artistQuery(&self.Controller, g.ArtistsQuery(self.Env.Db),
+		lp.Filter.Libraries).Order("sortkey").Exec(&artists)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	for i := 0; i < len(artists); i++ {
+		artists[i].Link, err = self.URL(artistRoute,
+			controller.Pairs{"id": artists[i].Id})
+		if err != nil {
+			return nil, nil, nil, "", err
+		}
+	}
+
+	// the albums are restricted to the genre by the filter
+	lp.Filter.Genre = g.Name
+
+	albums, cursor, err := albumListing(&self.Controller, lp, albumRoute)
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
+
+	return &g, artists, albums, cursor, nil
+}
+
+// Index shows a page of all genres.
+func (self *ControllerGenre) Index(w http.ResponseWriter, r *http.Request) {
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	genres, _, err := self.genres(ids, p, "genre")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("genre_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("genre_index", "Genres", &genres)
+	self.Tmpl.AddDataToTemplate("genre_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"genre_index",
+		&tmpl.Page{Title: "Genres"},
+	)
+}
+
+// Show shows the artists and a page of the albums of a genre.
+func (self *ControllerGenre) Show(w http.ResponseWriter, r *http.Request) {
+	lp, err := newListingParams(&self.Controller, r,
+		albumSorting, "name", "album.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	g, artists, albums, _, err := self.show(r, lp, "artist", "album")
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("genre", controller.Pairs{"id": g.Id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("genre_show", "Genre", g)
+	self.Tmpl.AddDataToTemplate("genre_show", "Artists", &artists)
+	self.Tmpl.AddDataToTemplate("genre_show", "Albums", &albums)
+	self.Tmpl.AddDataToTemplate("genre_show", "SortLinks",
+		albumSorting.Links(url, r.URL.Query(), lp.Sort))
+	self.Tmpl.AddDataToTemplate("genre_show", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), lp.Pagination))
+
+	backlink, _ := self.URL("genre_base", nil)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"genre_show",
+		&tmpl.Page{Title: g.Name, BackLink: backlink},
+	)
+}
+
+// APIIndex serves a page of genres as JSON.
+func (self *ControllerGenre) APIIndex(w http.ResponseWriter, r *http.Request) {
+	p, err := helper.NewPagination(r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	genres, cursor, err := self.genres(ids, p, "api_genre")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: p,
+		NextCursor: cursor,
+		Items:      genres,
+	})
+}
+
+// APIShow serves a genre with its artists and a page of its albums as JSON.
+func (self *ControllerGenre) APIShow(w http.ResponseWriter, r *http.Request) {
+	lp, err := newListingParams(&self.Controller, r,
+		albumSorting, "name", "album.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	g, artists, albums, cursor, err := self.show(r, lp, "api_artist",
+		"api_album")
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	listing := &controller.Listing{
+		Pagination: lp.Pagination,
+		NextCursor: cursor,
+		Items:      albums,
+	}
+
+	self.RenderJSON(w, struct {
+		*genre.Genre
+		Artists []artist.Artist     `json:"artists"`
+		Albums  *controller.Listing `json:"albums"`
+	}{g, artists, listing})
+}
@@ -0,0 +1,191 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/user"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Controller to serve the libraries
+type ControllerLibrary struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewLibrary(env *env.Environment) *ControllerLibrary {
+	return &ControllerLibrary{
+		controller.Controller: *controller.NewController(env),
+	}
+}
+
+// visibleLibraries returns the libraries the user authenticated by r may see
+// and their IDs. If the user sees all libraries, the IDs are nil.
+func visibleLibraries(c *controller.Controller,
+	r *http.Request) ([]library.Library, []int64, error) {
+
+	u, err := currentUser(c, nil, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return userLibraries(c, u)
+}
+
+// userLibraries returns the libraries the user u may see and their IDs. If
+// the user sees all libraries, the IDs are nil. Anonymous users are nil.
+func userLibraries(c *controller.Controller,
+	u *user.User) ([]library.Library, []int64, error) {
+
+	visible, err := library.Visible(c.Env.Db, u)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total, err := query.New(c.Env.Db, "library").Count()
+	if err != nil || len(visible) == total {
+		return visible, nil, err
+	}
+
+	ids := make([]int64, 0, len(visible))
+	for _, l := range visible {
+		ids = append(ids, l.Id)
+	}
+
+	return visible, ids, nil
+}
+
+// libraryScope returns the libraries the user authenticated by r may see, the
+// library selected by the URL parameter library and the IDs of the libraries
+// a listing is restricted to. If the listing isn't restricted, the IDs are
+// nil.
+func libraryScope(c *controller.Controller,
+	r *http.Request) ([]library.Library, int64, []int64, error) {
+
+	visible, ids, err := visibleLibraries(c, r)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	s := r.URL.Query().Get("library")
+	if s == "" {
+		return visible, 0, ids, nil
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		for _, l := range visible {
+			if l.Id == id {
+				return visible, id, []int64{id}, nil
+			}
+		}
+	}
+
+	return nil, 0, nil, fmt.Errorf("Invalid library '%s'.", s)
+}
+
+// containsLibrary reports whether the library with the ID id is one of the
+// libraries ids. nil ids contain all libraries.
+func containsLibrary(ids []int64, id int64) bool {
+	if ids == nil {
+		return true
+	}
+
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// paramError writes err as response to invalid URL parameters, that result in
+// the status 400. Authentication errors are written by authError.
+func paramError(w http.ResponseWriter, err error) {
+	switch err {
+	case errUnauthorized, errForbidden:
+		authError(w, err)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// APIIndex serves the libraries the user may see as JSON. They link to their
+// album listings.
+func (self *ControllerLibrary) APIIndex(w http.ResponseWriter, r *http.Request) {
+	libs, _, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	base, err := self.URL("api_album_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := 0; i < len(libs); i++ {
+		v := url.Values{}
+		v.Set("library", strconv.FormatInt(libs[i].Id, 10))
+
+		libs[i].Link = base + "?" + v.Encode()
+	}
+
+	if libs == nil {
+		libs = []library.Library{}
+	}
+
+	self.RenderJSON(w, libs)
+}
+
+// albumVisible reports whether the album with the ID id has tracks in the
+// libraries ids. nil ids contain all libraries.
+func albumVisible(c *controller.Controller, id int, ids []int64) (bool, error) {
+	if ids == nil {
+		return true, nil
+	}
+
+	n, err := library.TracksQuery(c.Env.Db, ids).
+		Where("track.album_id =", id).Count()
+
+	return n > 0, err
+}
+
+// artistQuery restricts the artists queried by q to those having tracks in the
+// libraries ids. nil ids don't restrict q.
+func artistQuery(c *controller.Controller, q *query.Query,
+	ids []int64) *query.Query {
+
+	if ids == nil {
+		return q
+	}
+
+	albums := query.New(c.Env.Db, "album").Join("track", "album_id", "", "ID")
+	library.Restrict(albums, "track.library_id", ids)
+
+	return q.WhereInQuery("artist.ID", albums, "album.artist_id")
+}
@@ -0,0 +1,416 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Sort keys of album listings.
+var albumSorting = helper.Sorting{
+	"name":     "album.name",
+	"year":     "album.year",
+	"artist":   "artist.name",
+	"added":    "album.added",
+	"duration": "album.length",
+}
+
+// Sort keys of track listings.
+var trackSorting = helper.Sorting{
+	"name":        "track.title",
+	"year":        "track.year",
+	"artist":      "artist.name",
+	"album":       "album.name",
+	"added":       "track.added",
+	"duration":    "track.length",
+	"tracknumber": "track.tracknumber",
+}
+
+// Sort keys of listings of track statistics.
+var statsSorting = helper.Sorting{
+	"plays":       "trackstat.plays",
+	"last_played": "trackstat.last_played",
+	"rating":      "trackstat.rating",
+}
+
+func init() {
+	// track statistics can be sorted like tracks, too
+	for k, v := range trackSorting {
+		statsSorting[k] = v
+	}
+}
+
+// albumSortValue returns the value of a that is sorted by the sort key key.
+func albumSortValue(a *album.AlbumInfo, key string) interface{} {
+	switch key {
+	case "year":
+		return a.Year
+	case "artist":
+		return a.Artist
+	case "added":
+		return a.Added
+	case "duration":
+		return a.Length
+	}
+
+	return a.Name
+}
+
+// trackSortValue returns the value of t that is sorted by the sort key key.
+func trackSortValue(t *track.Track, key string) interface{} {
+	switch key {
+	case "year":
+		return t.Year
+	case "artist":
+		return t.Artist
+	case "album":
+		return t.Album
+	case "added":
+		return t.Added
+	case "duration":
+		return t.Length
+	case "tracknumber":
+		return t.Tracknumber
+	}
+
+	return t.Title
+}
+
+// statsSortValue returns the value of t that is sorted by the sort key key.
+func statsSortValue(t *play.TrackStats, key string) interface{} {
+	switch key {
+	case "plays":
+		return t.Plays
+	case "last_played":
+		return t.LastPlayed
+	case "rating":
+		return t.Rating
+	}
+
+	return trackSortValue(&t.Track, key)
+}
+
+// listingFilter restricts album and track listings. It is read from the URL
+// parameters
+//
+// 		genre=<genre>&year_from=<year>&year_to=<year>&artist=<id>&format=<format>&library=<id>
+//
+// Empty fields don't restrict the listing. The parameter
+//
+// 		decade=<first year of decade>
+//
+// is a shortcut for the years of a decade.
+//
+// Listings are always restricted to the Libraries the user may see, Choices
+// holds them. Libraries is nil, if the user sees all libraries and none is
+// selected.
+type listingFilter struct {
+	Genre     string
+	YearFrom  int
+	YearTo    int
+	ArtistID  int
+	Format    string
+	Library   int64
+	Libraries []int64
+	Choices   []library.Library
+}
+
+// newListingFilter reads a listingFilter from the URL parameters of r. The
+// libraries are restricted to those visible to the user authenticated by r.
+func newListingFilter(c *controller.Controller,
+	r *http.Request) (*listingFilter, error) {
+
+	values := r.URL.Query()
+
+	f := &listingFilter{
+		Genre:  values.Get("genre"),
+		Format: strings.ToLower(values.Get("format")),
+	}
+
+	ints := []struct {
+		param string
+		dest  *int
+	}{
+		{"year_from", &f.YearFrom},
+		{"year_to", &f.YearTo},
+		{"artist", &f.ArtistID},
+	}
+
+	for _, v := range ints {
+		s := values.Get(v.param)
+		if s == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(s)
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("Invalid %s '%s'.", v.param, s)
+		}
+
+		*v.dest = i
+	}
+
+	if s := values.Get("decade"); s != "" {
+		d, err := strconv.Atoi(s)
+		if err != nil || d <= 0 || d%10 != 0 {
+			return nil, fmt.Errorf("Invalid decade '%s'.", s)
+		}
+
+		f.YearFrom, f.YearTo = d, d+9
+	}
+
+	var err error
+
+	f.Choices, f.Library, f.Libraries, err = libraryScope(c, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// needsTracks reports whether the filter restricts properties of tracks.
+func (self *listingFilter) needsTracks() bool {
+	return self.Genre != "" || self.Format != "" || self.Libraries != nil
+}
+
+// apply adds the constrictions of the filter to q. The tables track and album
+// must be accessible in q, if the filter needs them. The year range is
+// compared to the column yearColumn.
+func (self *listingFilter) apply(q *query.Query, yearColumn string) *query.Query {
+	if self.Genre != "" {
+		q.Join("trackgenre", "track_id", "track", "ID")
+		q.Join("genre", "ID", "trackgenre", "genre_id")
+		q.Where("genre.name =", self.Genre)
+	}
+	if self.Format != "" {
+		q.Where("track.format =", self.Format)
+	}
+	if self.YearFrom != 0 {
+		q.Where(yearColumn+" >=", self.YearFrom)
+	}
+	if self.YearTo != 0 {
+		q.Where(yearColumn+" <=", self.YearTo)
+	}
+	if self.ArtistID != 0 {
+		q.Where("album.artist_id =", self.ArtistID)
+	}
+	if self.Libraries != nil {
+		library.Restrict(q, "track.library_id", self.Libraries)
+	}
+
+	return q
+}
+
+// listingParams are the parameters of an album or track listing.
+type listingParams struct {
+	Filter     *listingFilter
+	Sort       string
+	FieldNames []string
+	Pagination *helper.Pagination
+}
+
+// newListingParams reads filter, sort parameter and pagination from the URL
+// parameters of r. The sort parameter is validated against sorting. If it is
+// empty, the sort key def is used. unique is the fieldName that makes the order
+// unique.
+func newListingParams(c *controller.Controller, r *http.Request,
+	sorting helper.Sorting, def, unique string) (*listingParams, error) {
+
+	var err error
+
+	values := r.URL.Query()
+
+	lp := &listingParams{Sort: values.Get("sort")}
+	if lp.Sort == "" {
+		lp.Sort = def
+	}
+
+	lp.FieldNames, err = sorting.FieldNames(lp.Sort, def, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	lp.Filter, err = newListingFilter(c, r)
+	if err != nil {
+		return nil, err
+	}
+
+	lp.Pagination, err = helper.NewPagination(values, len(lp.FieldNames))
+	if err != nil {
+		return nil, err
+	}
+
+	return lp, nil
+}
+
+// albumListing returns a page of albums. The links of the albums point to the
+// route linkRoute.
+//
+// Returns the albums and the cursor to the next page.
+func albumListing(c *controller.Controller, lp *listingParams,
+	linkRoute string) ([]album.AlbumInfo, string, error) {
+
+	q := query.New(c.Env.Db, "album").Join("artist", "ID", "", "artist_id")
+
+	if lp.Filter.needsTracks() {
+		q.Join("track", "album_id", "", "ID").GroupBy("album.ID")
+	}
+
+	lp.Filter.apply(q, "album.year")
+
+	var err error
+	p := lp.Pagination
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var albums []album.AlbumInfo
+
+	err = p.Apply(q, lp.FieldNames...).Exec(&albums)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(albums); i++ {
+		albums[i].Link, err = c.URL(linkRoute,
+			controller.Pairs{"id": albums[i].Id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(albums) == int(p.PerPage) {
+		last := &albums[len(albums)-1]
+		key, _ := helper.ParseSort(lp.Sort)
+		cursor = helper.EncodeCursor(albumSortValue(last, key), last.Id)
+	}
+
+	return albums, cursor, nil
+}
+
+// trackLink returns the link to the content of track t.
+func trackLink(c *controller.Controller, t *track.Track) (string, error) {
+	return c.URL("content", controller.Pairs{
+		"id":       t.Id,
+		"filename": path.Base(t.Path),
+	})
+}
+
+// trackListing returns a page of the tracks queried by q.
+//
+// Returns the tracks and the cursor to the next page.
+func trackListing(c *controller.Controller, q *query.Query,
+	lp *listingParams) ([]track.Track, string, error) {
+
+	q.Join("album", "ID", "", "album_id")
+	q.Join("artist", "ID", "album", "artist_id")
+
+	lp.Filter.apply(q, "track.year")
+
+	var err error
+	p := lp.Pagination
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var tracks []track.Track
+
+	err = p.Apply(q, lp.FieldNames...).Exec(&tracks)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(tracks); i++ {
+		tracks[i].Link, err = trackLink(c, &tracks[i])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(tracks) == int(p.PerPage) {
+		last := &tracks[len(tracks)-1]
+		key, _ := helper.ParseSort(lp.Sort)
+		cursor = helper.EncodeCursor(trackSortValue(last, key), last.Id)
+	}
+
+	return tracks, cursor, nil
+}
+
+// statsListing returns a page of the tracks with statistics queried by q, a
+// query like play.StatsQuery.
+//
+// Returns the tracks and the cursor to the next page.
+func statsListing(c *controller.Controller, q *query.Query,
+	lp *listingParams) ([]play.TrackStats, string, error) {
+
+	q.Join("album", "ID", "", "album_id")
+	q.Join("artist", "ID", "album", "artist_id")
+
+	lp.Filter.apply(q, "track.year")
+
+	var err error
+	p := lp.Pagination
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var tracks []play.TrackStats
+
+	err = p.Apply(q, lp.FieldNames...).Exec(&tracks)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(tracks); i++ {
+		tracks[i].Link, err = trackLink(c, &tracks[i].Track)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(tracks) == int(p.PerPage) {
+		last := &tracks[len(tracks)-1]
+		key, _ := helper.ParseSort(lp.Sort)
+		cursor = helper.EncodeCursor(statsSortValue(last, key), last.Id)
+	}
+
+	return tracks, cursor, nil
+}
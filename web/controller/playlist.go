@@ -0,0 +1,500 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/playlist"
+	"github.com/mokasin/musicrawler/model/track"
+	"github.com/mokasin/musicrawler/model/user"
+	"net/http"
+	"strconv"
+)
+
+// Controller to serve the playlists of the authenticated user. Playlists of
+// other users are reported as missing.
+type ControllerPlaylist struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewPlaylist(env *env.Environment) *ControllerPlaylist {
+	c := &ControllerPlaylist{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("playlist_index", "index", "playlists")
+	c.Tmpl.AddTemplate("playlist_show", "index", "playlist")
+
+	return c
+}
+
+// A playlist with its tracks.
+type playlistWithTracks struct {
+	*playlist.Playlist
+	Tracks []track.Track `json:"tracks"`
+}
+
+// playlistTracks returns the tracks of the playlist p in their order. Tracks
+// of libraries other than ids are left out. nil ids contain all libraries.
+func playlistTracks(c *controller.Controller, p *playlist.Playlist,
+	ids []int64) ([]track.Track, error) {
+
+	q := p.TracksQuery(c.Env.Db).
+		Join("album", "ID", "", "album_id").
+		Join("artist", "ID", "album", "artist_id")
+	if ids != nil {
+		library.Restrict(q, "track.library_id", ids)
+	}
+
+	var tracks []track.Track
+
+	if err := q.Exec(&tracks); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(tracks); i++ {
+		var err error
+
+		tracks[i].Link, err = trackLink(c, &tracks[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tracks, nil
+}
+
+// playlists returns the playlists of the user u. Their links point to the
+// route linkRoute.
+func (self *ControllerPlaylist) playlists(u *user.User,
+	linkRoute string) ([]playlist.Playlist, error) {
+
+	var playlists []playlist.Playlist
+
+	err := playlist.UserQuery(self.Env.Db, u.Id).Exec(&playlists)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(playlists); i++ {
+		playlists[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": playlists[i].Id})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return playlists, nil
+}
+
+// load returns the playlist of the user u given by the route variable id. Its
+// link points to the route linkRoute. Playlists of other users result in
+// sql.ErrNoRows.
+func (self *ControllerPlaylist) load(r *http.Request, u *user.User,
+	linkRoute string) (*playlist.Playlist, error) {
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := playlist.Load(self.Env.Db, id, u.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Link, err = self.URL(linkRoute, controller.Pairs{"id": p.Id})
+
+	return p, err
+}
+
+// Index shows a page of the playlists of the user.
+func (self *ControllerPlaylist) Index(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	playlists, err := self.playlists(u, "playlist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("playlist_index", "Playlists", playlists)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"playlist_index",
+		&tmpl.Page{Title: "Playlists"},
+	)
+}
+
+// Show shows a page of a playlist of the user with its tracks.
+func (self *ControllerPlaylist) Show(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "playlist")
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tracks, err := playlistTracks(&self.Controller, p, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backlink, _ := self.URL("playlist_base", nil)
+	feedlink, _ := feedLink(&self.Controller, u, "feed_playlist",
+		controller.Pairs{"id": p.Id})
+	downloadlink, _ := self.URL("playlist_download",
+		controller.Pairs{"id": p.Id})
+
+	self.Tmpl.AddDataToTemplate("playlist_show", "Playlist", p)
+	self.Tmpl.AddDataToTemplate("playlist_show", "Tracks", &tracks)
+	self.Tmpl.AddDataToTemplate("playlist_show", "FeedLink", feedlink)
+	self.Tmpl.AddDataToTemplate("playlist_show", "DownloadLink", downloadlink)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"playlist_show",
+		&tmpl.Page{Title: p.Name, BackLink: backlink},
+	)
+}
+
+// downloadTracks returns the playlist of the user u given by the route variable
+// id and its tracks in the libraries ids. Playlists of other users result in
+// sql.ErrNoRows.
+func (self *ControllerPlaylist) downloadTracks(r *http.Request, u *user.User,
+	ids []int64) (*playlist.Playlist, []track.Track, error) {
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		return nil, nil, err
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "playlist")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tracks, err := playlistTracks(&self.Controller, p, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p, tracks, nil
+}
+
+// Download serves the tracks of a playlist of the user as ZIP archive, in a
+// folder of the playlist together with a playlist file of them. The files are
+// numbered in the order of the playlist.
+func (self *ControllerPlaylist) Download(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the database isn't locked while the archive is streamed
+	p, tracks, err := self.downloadTracks(r, u, ids)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i := range tracks {
+		tracks[i].Tracknumber = i + 1
+	}
+
+	serveArchive(&self.Controller, w, p.Name, archiveName(p.Name), tracks)
+}
+
+// APIIndex serves the playlists of the user as JSON.
+func (self *ControllerPlaylist) APIIndex(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	playlists, err := self.playlists(u, "api_playlist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if playlists == nil {
+		playlists = []playlist.Playlist{}
+	}
+
+	self.RenderJSON(w, playlists)
+}
+
+// APICreate creates an empty playlist of the user named by the parameter name
+// and serves it as JSON.
+func (self *ControllerPlaylist) APICreate(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := playlist.Create(self.Env.Db, u.Id, r.FormValue("name"))
+	switch {
+	case err == playlist.ErrName:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.Link, err = self.URL("api_playlist", controller.Pairs{"id": p.Id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, p)
+}
+
+// APIShow serves a playlist of the user with its tracks as JSON.
+func (self *ControllerPlaylist) APIShow(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "api_playlist")
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tracks, err := playlistTracks(&self.Controller, p, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if tracks == nil {
+		tracks = []track.Track{}
+	}
+
+	self.RenderJSON(w, &playlistWithTracks{Playlist: p, Tracks: tracks})
+}
+
+// APIDelete deletes a playlist of the user.
+func (self *ControllerPlaylist) APIDelete(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "api_playlist")
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := p.Delete(self.Env.Db); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIAddTrack appends the track given by the route variable track to a
+// playlist of the user. Tracks of libraries hidden from the user result in the
+// status 404.
+func (self *ControllerPlaylist) APIAddTrack(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	trackID, err := strconv.Atoi(mux.Vars(r)["track"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, ids, err := userLibraries(&self.Controller, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "api_playlist")
+	if err == nil {
+		var t track.RawTrack
+
+		err = query.New(self.Env.Db, "track").Find(trackID).Exec(&t)
+		if err == nil && !containsLibrary(ids, t.LibraryID) {
+			err = sql.ErrNoRows
+		}
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := p.Add(self.Env.Db, int64(trackID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIRemoveTrack removes the track at the position given by the route
+// variable position from a playlist of the user. Positions count from 0.
+func (self *ControllerPlaylist) APIRemoveTrack(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	position, err := strconv.Atoi(mux.Vars(r)["position"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	p, err := self.load(r, u, "api_playlist")
+	if err == nil {
+		err = p.Remove(self.Env.Db, position)
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
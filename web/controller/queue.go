@@ -0,0 +1,383 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/model/album"
+	"github.com/mokasin/musicrawler/model/library"
+	"github.com/mokasin/musicrawler/model/playlist"
+	"github.com/mokasin/musicrawler/model/queue"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+	"strconv"
+)
+
+// Controller to serve the playback queues of the users to the player in the
+// browser. Every change responds with the changed queue.
+type ControllerQueue struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewQueue(env *env.Environment) *ControllerQueue {
+	return &ControllerQueue{
+		controller.Controller: *controller.NewController(env),
+	}
+}
+
+// queueState is a queue as served. Tracks are in the order they are played,
+// Current is the one at Position. Play tells the player to start playing
+// Current.
+type queueState struct {
+	Position int           `json:"position"`
+	Shuffle  bool          `json:"shuffle"`
+	Repeat   string        `json:"repeat"`
+	Play     bool          `json:"play"`
+	Current  *track.Track  `json:"current"`
+	Tracks   []track.Track `json:"tracks"`
+}
+
+// edit loads the queue of the user, changes it by calling change with the IDs
+// of the libraries visible to the user, saves and serves it. change reports
+// whether the player should start playing.
+func (self *ControllerQueue) edit(w http.ResponseWriter, r *http.Request,
+	change func(q *queue.Queue, ids []int64) (bool, error)) {
+
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	q, err := queue.Load(self.Env.Db, u.Id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// tracks removed or hidden since they were added are dropped first, so
+	// positions refer to the served tracks
+	tracks, err := self.tracks(q, ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	play, err := change(q, ids)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err == queue.ErrRepeat || err == queue.ErrPosition:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := q.Save(self.Env.Db); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// tracks added are looked up, too
+	for _, id := range q.Tracks {
+		if tracks[id] == nil {
+			tracks, err = self.tracks(q, ids)
+			break
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	state := &queueState{
+		Position: q.Position,
+		Shuffle:  q.Shuffled(),
+		Repeat:   q.Repeat,
+		Play:     play,
+		Tracks:   []track.Track{},
+	}
+
+	for _, id := range q.Ordered() {
+		state.Tracks = append(state.Tracks, *tracks[id])
+	}
+
+	if q.Position < len(state.Tracks) {
+		state.Current = &state.Tracks[q.Position]
+	}
+
+	self.RenderJSON(w, state)
+}
+
+// tracks returns the tracks of the queue q by their IDs. Tracks missing or
+// not in the libraries ids are removed from q.
+func (self *ControllerQueue) tracks(q *queue.Queue,
+	ids []int64) (map[int64]*track.Track, error) {
+
+	found := make(map[int64]*track.Track)
+
+	if len(q.Tracks) > 0 {
+		values := make([]interface{}, len(q.Tracks))
+		for i, id := range q.Tracks {
+			values[i] = id
+		}
+
+		tq := query.New(self.Env.Db, "track").
+			Join("album", "ID", "", "album_id").
+			Join("artist", "ID", "album", "artist_id").
+			WhereIn("track.ID", values...)
+		if ids != nil {
+			library.Restrict(tq, "track.library_id", ids)
+		}
+
+		var tracks []track.Track
+
+		if err := tq.Exec(&tracks); err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < len(tracks); i++ {
+			var err error
+
+			tracks[i].Link, err = trackLink(&self.Controller, &tracks[i])
+			if err != nil {
+				return nil, err
+			}
+
+			found[tracks[i].Id] = &tracks[i]
+		}
+	}
+
+	q.Keep(func(id int64) bool {
+		return found[id] != nil
+	})
+
+	return found, nil
+}
+
+// APIShow serves the queue of the user.
+func (self *ControllerQueue) APIShow(w http.ResponseWriter, r *http.Request) {
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		return false, nil
+	})
+}
+
+// APIAdd adds the tracks of an album, a playlist of the user or a track to the
+// queue. The tracks of an album are added in the order of their track numbers,
+// those of a playlist in its order. If the URL parameter play is given, they
+// are played right away.
+func (self *ControllerQueue) APIAdd(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, play := r.URL.Query()["play"]
+
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		added, err := self.addedTracks(mux.Vars(r)["kind"], id, q.UserID, ids)
+		if err != nil {
+			return false, err
+		}
+
+		if len(added) == 0 {
+			return false, sql.ErrNoRows
+		}
+
+		q.Add(play, added...)
+
+		return play, nil
+	})
+}
+
+// addedTracks returns the IDs of the tracks of the album, the playlist of the
+// user with ID userID or the track with the ID id, as given by kind. Tracks of
+// libraries other than ids are left out. nil ids contain all libraries.
+func (self *ControllerQueue) addedTracks(kind string, id int, userID int64,
+	ids []int64) ([]int64, error) {
+
+	var added []int64
+
+	// the tracks of a playlist are joined to their positions
+	if kind == "playlist" {
+		p, err := playlist.Load(self.Env.Db, int64(id), userID)
+		if err != nil {
+			return nil, err
+		}
+
+		tracks, err := playlistTracks(&self.Controller, p, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range tracks {
+			added = append(added, tracks[i].Id)
+		}
+
+		return added, nil
+	}
+
+	tq := query.New(self.Env.Db, "track")
+
+	switch kind {
+	case "album":
+		var a album.Album
+
+		err := query.New(self.Env.Db, "album").Find(id).Exec(&a)
+		if err != nil {
+			return nil, err
+		}
+
+		tq = a.TracksQuery(self.Env.Db).
+			Order("track.tracknumber").
+			Order("track.path")
+	default:
+		tq.Where("track.ID =", id)
+	}
+
+	if ids != nil {
+		library.Restrict(tq, "track.library_id", ids)
+	}
+
+	var tracks []track.RawTrack
+
+	if err := tq.Exec(&tracks); err != nil {
+		return nil, err
+	}
+
+	for i := range tracks {
+		added = append(added, tracks[i].Id)
+	}
+
+	return added, nil
+}
+
+// APIAddFolder adds the tracks in a browsed folder and below it to the queue,
+// ordered by their paths. If the URL parameter play is given, they are played
+// right away.
+func (self *ControllerQueue) APIAddFolder(w http.ResponseWriter, r *http.Request) {
+	_, play := r.URL.Query()["play"]
+
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		source, dir, err := browseFolder(&self.Controller, ids, browsePath(r))
+		if err != nil {
+			return false, err
+		}
+
+		tracks, err := browseTracks(&self.Controller, ids, source, dir)
+		if err != nil {
+			return false, err
+		}
+
+		added := make([]int64, len(tracks))
+		for i := range tracks {
+			added[i] = tracks[i].Id
+		}
+
+		q.Add(play, added...)
+
+		return play, nil
+	})
+}
+
+// APINext moves on to the next track of the queue. The URL parameter ended
+// tells that the track playing ended by itself.
+func (self *ControllerQueue) APINext(w http.ResponseWriter, r *http.Request) {
+	_, ended := r.URL.Query()["ended"]
+
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		return q.Next(ended), nil
+	})
+}
+
+// APIPrevious moves back to the previous track of the queue.
+func (self *ControllerQueue) APIPrevious(w http.ResponseWriter, r *http.Request) {
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		return q.Previous(), nil
+	})
+}
+
+// APIJump moves to the track at the position given by the URL parameter
+// position.
+func (self *ControllerQueue) APIJump(w http.ResponseWriter, r *http.Request) {
+	position, err := strconv.Atoi(r.FormValue("position"))
+	if err != nil {
+		http.Error(w, "Invalid position '"+r.FormValue("position")+"'.",
+			http.StatusBadRequest)
+		return
+	}
+
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		return true, q.Jump(position)
+	})
+}
+
+// APIShuffle shuffles the queue, or unshuffles it if the URL parameter shuffle
+// is false.
+func (self *ControllerQueue) APIShuffle(w http.ResponseWriter, r *http.Request) {
+	shuffle := true
+	if s := r.FormValue("shuffle"); s != "" {
+		var err error
+		shuffle, err = strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "Invalid shuffle '"+s+"'.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		q.SetShuffle(shuffle)
+		return false, nil
+	})
+}
+
+// APIRepeat sets the repeat mode of the queue to the URL parameter repeat,
+// that is off, all or one.
+func (self *ControllerQueue) APIRepeat(w http.ResponseWriter, r *http.Request) {
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		return false, q.SetRepeat(r.FormValue("repeat"))
+	})
+}
+
+// APIClear removes all tracks from the queue.
+func (self *ControllerQueue) APIClear(w http.ResponseWriter, r *http.Request) {
+	self.edit(w, r, func(q *queue.Queue, ids []int64) (bool, error) {
+		q.Clear()
+		return false, nil
+	})
+}
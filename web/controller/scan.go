@@ -0,0 +1,377 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/scanner"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/scan"
+	"net/http"
+	"strconv"
+)
+
+// Controller to serve the history of scans and their errors and to run
+// rescans by scanner. As errors expose paths of files, it is restricted to
+// admins.
+type ControllerScan struct {
+	controller.Controller
+	scanner *scanner.Scanner
+}
+
+// Constructor.
+func NewScan(env *env.Environment, sc *scanner.Scanner) *ControllerScan {
+	c := &ControllerScan{
+		controller.Controller: *controller.NewController(env),
+		scanner:               sc,
+	}
+
+	c.Tmpl.AddTemplate("scan_index", "index", "pager", "scans")
+	c.Tmpl.AddTemplate("scan_show", "index", "pager", "scan")
+
+	return c
+}
+
+// scans returns a page of all scans, latest first. The links of the scans
+// point to the route linkRoute.
+//
+// Returns the scans and the cursor to the next page.
+func (self *ControllerScan) scans(p *helper.Pagination,
+	linkRoute string) ([]scan.Scan, string, error) {
+
+	q := query.New(self.Env.Db, "scan")
+
+	var err error
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var scans []scan.Scan
+
+	err = p.Apply(q, "-scan.ID").Exec(&scans)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < len(scans); i++ {
+		scans[i].Link, err = self.URL(linkRoute,
+			controller.Pairs{"id": scans[i].Id})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var cursor string
+
+	if len(scans) == int(p.PerPage) {
+		cursor = helper.EncodeCursor(scans[len(scans)-1].Id)
+	}
+
+	return scans, cursor, nil
+}
+
+// show retrieves the scan with the id given by the URL and a page of its
+// errors.
+//
+// Returns the scan, the errors and the cursor to the next page.
+func (self *ControllerScan) show(r *http.Request,
+	p *helper.Pagination) (*scan.Scan, []scan.ScanError, string, error) {
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var s scan.Scan
+
+	err = query.New(self.Env.Db, "scan").Find(id).Exec(&s)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	q := s.ErrorsQuery(self.Env.Db)
+
+	p.Total, err = q.Count()
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var scanErrors []scan.ScanError
+
+	err = p.Apply(q, "scanerror.ID").Exec(&scanErrors)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var cursor string
+
+	if len(scanErrors) == int(p.PerPage) {
+		cursor = helper.EncodeCursor(scanErrors[len(scanErrors)-1].Id)
+	}
+
+	return &s, scanErrors, cursor, nil
+}
+
+// Index shows a page of all scans.
+func (self *ControllerScan) Index(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scans, _, err := self.scans(p, "scan")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("scan_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("scan_index", "Scans", &scans)
+	self.Tmpl.AddDataToTemplate("scan_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"scan_index",
+		&tmpl.Page{Title: "Scans"},
+	)
+}
+
+// Show shows a scan and a page of its errors.
+func (self *ControllerScan) Show(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, scanErrors, _, err := self.show(r, p)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("scan", controller.Pairs{"id": s.Id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("scan_show", "Scan", s)
+	self.Tmpl.AddDataToTemplate("scan_show", "Errors", &scanErrors)
+	self.Tmpl.AddDataToTemplate("scan_show", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), p))
+
+	backlink, _ := self.URL("scan_base", nil)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"scan_show",
+		&tmpl.Page{Title: "Scan " + s.StartedString(), BackLink: backlink},
+	)
+}
+
+// APIIndex serves a page of all scans as JSON.
+func (self *ControllerScan) APIIndex(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scans, cursor, err := self.scans(p, "api_scan")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: p,
+		NextCursor: cursor,
+		Items:      scans,
+	})
+}
+
+// APIShow serves a scan with a page of its errors as JSON.
+func (self *ControllerScan) APIShow(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p, err := helper.NewPagination(r.URL.Query(), 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, scanErrors, cursor, err := self.show(r, p)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, struct {
+		*scan.Scan
+		ErrorList *controller.Listing `json:"error_list"`
+	}{s, &controller.Listing{
+		Pagination: p,
+		NextCursor: cursor,
+		Items:      scanErrors,
+	}})
+}
+
+// APIStart starts a rescan of the library in the background and serves its
+// progress as JSON. If a scan is running already, it fails with status 409.
+func (self *ControllerScan) APIStart(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p, err := self.scanner.Start()
+	if err == scanner.ErrRunning {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	b, err := json.Marshal(&p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if url, err := self.URL("api_scan_current", nil); err == nil {
+		w.Header().Set("Location", url)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(b)
+}
+
+// APIProgress serves the progress of the running or the last rescan as JSON.
+func (self *ControllerScan) APIProgress(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	p := self.scanner.Progress()
+	self.RenderJSON(w, &p)
+}
+
+// APICancel cancels the running rescan. If no scan is running, it fails with
+// status 409.
+func (self *ControllerScan) APICancel(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	if err := self.scanner.Cancel(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIEvents streams the progress of the running rescan as Server-Sent Events.
+// Every change is sent as event "progress" with the progress as JSON. The
+// stream ends after the scan has finished.
+func (self *ControllerScan) APIEvents(w http.ResponseWriter, r *http.Request) {
+	if _, err := requireAdmin(&self.Controller, w, r); err != nil {
+		authError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported.",
+			http.StatusInternalServerError)
+		return
+	}
+
+	progress, unsubscribe := self.scanner.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		select {
+		case p := <-progress:
+			b, err := json.Marshal(&p)
+			if err != nil {
+				return
+			}
+
+			if _, err := fmt.Fprintf(w, "event: progress\ndata: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			if !p.Running {
+				return
+			}
+		case <-r.Context().Done():
+			// the client went away
+			return
+		}
+	}
+}
@@ -0,0 +1,105 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/stats"
+	"net/http"
+)
+
+// Controller to serve statistics of the library
+type ControllerStats struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewStats(env *env.Environment) *ControllerStats {
+	c := &ControllerStats{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("stats_index", "index", "stats")
+
+	return c
+}
+
+// library returns the statistics of the libraries ids, all libraries if they
+// are nil. The top artists link to the route artistRoute.
+func (self *ControllerStats) library(ids []int64,
+	artistRoute string) (*stats.Library, error) {
+
+	l, err := stats.Compute(self.Env.Db, stats.TopArtistsNumber, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(l.TopArtists); i++ {
+		l.TopArtists[i].Link, err = self.URL(artistRoute,
+			controller.Pairs{"id": l.TopArtists[i].ArtistID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Index shows the statistics of the library. They can be restricted to a
+// library by the URL parameter library.
+func (self *ControllerStats) Index(w http.ResponseWriter, r *http.Request) {
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	l, err := self.library(ids, "artist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("stats_index", "Stats", l)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"stats_index",
+		&tmpl.Page{Title: "Statistics"},
+	)
+}
+
+// APIIndex serves the statistics of the library as JSON. They can be
+// restricted to a library by the URL parameter library.
+func (self *ControllerStats) APIIndex(w http.ResponseWriter, r *http.Request) {
+	_, _, ids, err := libraryScope(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	l, err := self.library(ids, "api_artist")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, l)
+}
@@ -0,0 +1,398 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"code.google.com/p/gorilla/mux"
+	"database/sql"
+	"fmt"
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/book"
+	"github.com/mokasin/musicrawler/model/play"
+	"github.com/mokasin/musicrawler/model/track"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Controller to serve tracks
+type ControllerTrack struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewTrack(env *env.Environment) *ControllerTrack {
+	c := &ControllerTrack{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("track_index", "index", "pager", "filter", "tracks")
+	c.Tmpl.AddTemplate("track_stats", "index", "pager", "trackstats")
+
+	return c
+}
+
+// Index shows a page of all tracks.
+func (self *ControllerTrack) Index(w http.ResponseWriter, r *http.Request) {
+	lp, err := newListingParams(&self.Controller, r,
+		trackSorting, "name", "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	tracks, _, err := trackListing(&self.Controller,
+		query.New(self.Env.Db, "track"), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("track_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("track_index", "Tracks", &tracks)
+	self.Tmpl.AddDataToTemplate("track_index", "Filter", lp.Filter)
+	self.Tmpl.AddDataToTemplate("track_index", "SortLinks",
+		trackSorting.Links(url, r.URL.Query(), lp.Sort))
+	self.Tmpl.AddDataToTemplate("track_index", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), lp.Pagination))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"track_index",
+		&tmpl.Page{Title: "Tracks"},
+	)
+}
+
+// APIIndex serves a page of tracks as JSON.
+func (self *ControllerTrack) APIIndex(w http.ResponseWriter, r *http.Request) {
+	lp, err := newListingParams(&self.Controller, r,
+		trackSorting, "name", "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	tracks, cursor, err := trackListing(&self.Controller,
+		query.New(self.Env.Db, "track"), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: lp.Pagination,
+		NextCursor: cursor,
+		Items:      tracks,
+	})
+}
+
+// A listing of track statistics. Tracks without the statistic are left out by
+// the constriction Where. Sort is the default sort key.
+type statsKind struct {
+	Title string
+	Sort  string
+	Where string
+}
+
+// Listings of track statistics by name.
+var statsKinds = map[string]*statsKind{
+	"most_played":     {"Most played", "-plays", "trackstat.plays >"},
+	"recently_played": {"Recently played", "-last_played", "trackstat.last_played >"},
+	"top_rated":       {"Top rated", "-rating", "trackstat.rating >"},
+}
+
+// statsUserID returns the ID of the user whose statistics are listed. It is
+// the authenticated user, unless the ID of another user is given by the URL
+// parameter user. Only admins may list the statistics of other users.
+func (self *ControllerTrack) statsUserID(w http.ResponseWriter,
+	r *http.Request) (int64, error) {
+
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		return 0, err
+	}
+
+	s := r.URL.Query().Get("user")
+	if s == "" {
+		return u.Id, nil
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid user '%s'.", s)
+	}
+
+	if id != u.Id && !u.IsAdmin() {
+		return 0, errForbidden
+	}
+
+	return id, nil
+}
+
+// Stats shows a page of a listing of track statistics. The listing is given
+// by the route variable listing.
+func (self *ControllerTrack) Stats(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["listing"]
+
+	kind, ok := statsKinds[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	lp, err := newListingParams(&self.Controller, r,
+		statsSorting, kind.Sort, "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	userID, err := self.statsUserID(w, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	tracks, _, err := statsListing(&self.Controller,
+		play.StatsQuery(self.Env.Db, userID).Where(kind.Where, 0), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url, err := self.URL("track_stats", controller.Pairs{"listing": name})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("track_stats", "Tracks", &tracks)
+	self.Tmpl.AddDataToTemplate("track_stats", "SortLinks",
+		statsSorting.Links(url, r.URL.Query(), lp.Sort))
+	self.Tmpl.AddDataToTemplate("track_stats", "NumberPager",
+		helper.NewNumberPager(url, r.URL.Query(), lp.Pagination))
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"track_stats",
+		&tmpl.Page{Title: kind.Title},
+	)
+}
+
+// APIStats serves a page of a listing of track statistics as JSON. The listing
+// is given by the route variable listing.
+func (self *ControllerTrack) APIStats(w http.ResponseWriter, r *http.Request) {
+	kind, ok := statsKinds[mux.Vars(r)["listing"]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	lp, err := newListingParams(&self.Controller, r,
+		statsSorting, kind.Sort, "track.ID")
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	userID, err := self.statsUserID(w, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	tracks, cursor, err := statsListing(&self.Controller,
+		play.StatsQuery(self.Env.Db, userID).Where(kind.Where, 0), lp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{
+		Pagination: lp.Pagination,
+		NextCursor: cursor,
+		Items:      tracks,
+	})
+}
+
+// trackID returns the ID of the track given by the route variable id. If
+// there is no such track or it belongs to a library the user can't see,
+// sql.ErrNoRows is returned.
+func (self *ControllerTrack) trackID(r *http.Request) (int64, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, err
+	}
+
+	var t track.RawTrack
+
+	err = query.New(self.Env.Db, "track").Find(id).Exec(&t)
+	if err != nil {
+		return 0, err
+	}
+
+	_, ids, err := visibleLibraries(&self.Controller, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if !containsLibrary(ids, t.LibraryID) {
+		return 0, sql.ErrNoRows
+	}
+
+	return t.Id, nil
+}
+
+// Scrobble records a play of a track reported by a client. The time of the
+// play can be given as Unix time by the parameter time, it defaults to now.
+func (self *ControllerTrack) Scrobble(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	played := time.Now().Unix()
+
+	if s := r.FormValue("time"); s != "" {
+		played, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || played <= 0 {
+			http.Error(w, "Invalid time '"+s+"'.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	id, err := self.trackID(r)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := play.Record(self.Env.Db, id, u.Id, played); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Rate sets the rating of a track by the authenticated user to the number of
+// stars given by the parameter rating. A rating of 0 removes the rating.
+func (self *ControllerTrack) Rate(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	stars, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || stars < 0 || stars > play.MaxRating {
+		http.Error(w, "Invalid rating '"+r.FormValue("rating")+"'.",
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	id, err := self.trackID(r)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := play.Rate(self.Env.Db, id, u.Id, stars); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Position saves where the authenticated user resumes the book of a track. The
+// position is given in milliseconds into the track by the parameter position.
+// Tracks, that aren't part of a book, result in the status 400.
+func (self *ControllerTrack) Position(w http.ResponseWriter, r *http.Request) {
+	u, err := requireUser(&self.Controller, w, r)
+	if err != nil {
+		authError(w, err)
+		return
+	}
+
+	position, err := strconv.Atoi(r.FormValue("position"))
+	if err != nil || position < 0 {
+		http.Error(w, "Invalid position '"+r.FormValue("position")+"'.",
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := self.Env.Db.BeginTransaction(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer self.Env.Db.EndTransaction()
+
+	id, err := self.trackID(r)
+	switch {
+	case err == sql.ErrNoRows:
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = book.SavePosition(self.Env.Db, id, u.Id, position)
+	switch {
+	case err == book.ErrNoBook:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,248 @@
+/*  Copyright 2012, mokasin
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package controller
+
+import (
+	"github.com/mokasin/musicrawler/lib/database/query"
+	"github.com/mokasin/musicrawler/lib/model/helper"
+	"github.com/mokasin/musicrawler/lib/web/controller"
+	"github.com/mokasin/musicrawler/lib/web/env"
+	"github.com/mokasin/musicrawler/lib/web/tmpl"
+	"github.com/mokasin/musicrawler/model/album"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Controller to serve years and decades
+type ControllerYear struct {
+	controller.Controller
+}
+
+// Constructor.
+func NewYear(env *env.Environment) *ControllerYear {
+	c := &ControllerYear{
+		controller.Controller: *controller.NewController(env),
+	}
+
+	c.Tmpl.AddTemplate("year_index", "index", "pager", "years")
+	c.Tmpl.AddTemplate("decade_index", "index", "decades")
+
+	return c
+}
+
+// filterAlbums restricts the albums queried by q to those matched by the
+// filter f.
+func filterAlbums(q *query.Query, f *listingFilter) *query.Query {
+	if f.needsTracks() {
+		q.Join("track", "album_id", "", "ID")
+	}
+
+	return f.apply(q, "album.year")
+}
+
+// libraryValues returns the URL parameters selecting the library selected by
+// f.
+func libraryValues(f *listingFilter) url.Values {
+	v := url.Values{}
+	if f.Library != 0 {
+		v.Set("library", strconv.FormatInt(f.Library, 10))
+	}
+
+	return v
+}
+
+// yearLink returns a link to the listing at the route route, that is
+// restricted to the years from to to and the library selected by f.
+func (self *ControllerYear) yearLink(route string, f *listingFilter,
+	from, to int) (string, error) {
+
+	base, err := self.URL(route, nil)
+	if err != nil {
+		return "", err
+	}
+
+	v := libraryValues(f)
+	v.Set("year_from", strconv.Itoa(from))
+	v.Set("year_to", strconv.Itoa(to))
+
+	return base + "?" + v.Encode(), nil
+}
+
+// years returns all years of the albums matched by f with the number of their
+// albums. The years link to the album listing at the route albumRoute.
+func (self *ControllerYear) years(f *listingFilter,
+	albumRoute string) ([]album.YearInfo, error) {
+
+	var years []album.YearInfo
+
+	err := filterAlbums(album.YearsQuery(self.Env.Db), f).
+		Order("album.year").Exec(&years)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(years); i++ {
+		years[i].Link, err = self.yearLink(albumRoute, f, years[i].Year,
+			years[i].Year)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return years, nil
+}
+
+// decades returns all decades of the albums matched by f with the number of
+// their albums. The decades link to the year listing at the route yearRoute.
+func (self *ControllerYear) decades(f *listingFilter,
+	yearRoute string) ([]album.DecadeInfo, error) {
+
+	var decades []album.DecadeInfo
+
+	err := filterAlbums(album.DecadesQuery(self.Env.Db), f).
+		Order("album.year/10*10").Exec(&decades)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := self.URL(yearRoute, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(decades); i++ {
+		v := libraryValues(f)
+		v.Set("decade", strconv.Itoa(decades[i].Decade))
+
+		decades[i].Link = base + "?" + v.Encode()
+	}
+
+	return decades, nil
+}
+
+// Index shows all years with the number of their albums. The years can be
+// restricted by the URL parameters of a listingFilter.
+func (self *ControllerYear) Index(w http.ResponseWriter, r *http.Request) {
+	f, err := newListingFilter(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	years, err := self.years(f, "album_base")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// the decades of the libraries are used to navigate between the years
+	decades, err := self.decades(&listingFilter{
+		Library:   f.Library,
+		Libraries: f.Libraries,
+	}, "year_base")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	labels := make([]string, len(decades))
+	for i, d := range decades {
+		labels[i] = strconv.Itoa(d.Decade)
+	}
+
+	url, err := self.URL("year_base", nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pager := helper.NewPager(url, "decade", labels, r.URL.Query().Get("decade"))
+
+	self.Tmpl.AddDataToTemplate("year_index", "Years", &years)
+	self.Tmpl.AddDataToTemplate("year_index", "Pager", pager)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"year_index",
+		&tmpl.Page{Title: "Years"},
+	)
+}
+
+// Decades shows all decades with the number of their albums. The decades can
+// be restricted by the URL parameters of a listingFilter.
+func (self *ControllerYear) Decades(w http.ResponseWriter, r *http.Request) {
+	f, err := newListingFilter(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	decades, err := self.decades(f, "year_base")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.Tmpl.AddDataToTemplate("decade_index", "Decades", &decades)
+
+	// render the website
+	self.Tmpl.RenderPage(
+		w,
+		"decade_index",
+		&tmpl.Page{Title: "Decades"},
+	)
+}
+
+// APIIndex serves all years with the number of their albums as JSON. The
+// years can be restricted by the URL parameters of a listingFilter, e.g.
+//
+// 		/api/v1/year?year_from=1970&year_to=1985
+func (self *ControllerYear) APIIndex(w http.ResponseWriter, r *http.Request) {
+	f, err := newListingFilter(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	years, err := self.years(f, "api_album_base")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{Items: years})
+}
+
+// APIDecades serves all decades with the number of their albums as JSON. The
+// decades can be restricted by the URL parameters of a listingFilter.
+func (self *ControllerYear) APIDecades(w http.ResponseWriter, r *http.Request) {
+	f, err := newListingFilter(&self.Controller, r)
+	if err != nil {
+		paramError(w, err)
+		return
+	}
+
+	decades, err := self.decades(f, "api_year_base")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	self.RenderJSON(w, &controller.Listing{Items: decades})
+}
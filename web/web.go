@@ -18,8 +18,10 @@ package web
 
 import (
 	"github.com/mokasin/musicrawler/lib/database"
+	"github.com/mokasin/musicrawler/lib/scanner"
 	"github.com/mokasin/musicrawler/lib/web/env"
 	"github.com/mokasin/musicrawler/web/controller"
+	"io/fs"
 	"net"
 	"net/http"
 	"time"
@@ -54,15 +56,31 @@ type Webserver struct {
 
 	cartist  *controller.ControllerArtist
 	calbum   *controller.ControllerAlbum
+	ctrack   *controller.ControllerTrack
+	cgenre   *controller.ControllerGenre
+	cyear    *controller.ControllerYear
+	cdup     *controller.ControllerDuplicate
+	cstats   *controller.ControllerStats
+	clib     *controller.ControllerLibrary
+	cbook    *controller.ControllerBook
+	cfeed    *controller.ControllerFeed
+	cbrowse  *controller.ControllerBrowse
+	cqueue   *controller.ControllerQueue
+	cscan    *controller.ControllerScan
 	ccontent *controller.ControllerContent
+	cplist   *controller.ControllerPlaylist
 }
 
-// Constructor of Webserver. Needs an db.db to work on.
-func New(db *database.Database, stat chan<- *Status, addr string) *Webserver {
+// Constructor of Webserver. Needs an db.db to work on. The audio files are
+// served from files, the file systems of the sources by their IDs. Rescans of
+// the library are run by sc.
+func New(db *database.Database, files map[string]fs.FS, sc *scanner.Scanner,
+	stat chan<- *Status, addr string) *Webserver {
 	// set global variable
 	statusChannel = stat
 
 	env := env.New(db, websitePath)
+	env.Files = files
 
 	w := &Webserver{
 		addr: addr,
@@ -70,7 +88,19 @@ func New(db *database.Database, stat chan<- *Status, addr string) *Webserver {
 
 		cartist:  controller.NewArtist(env),
 		calbum:   controller.NewAlbum(env),
+		ctrack:   controller.NewTrack(env),
+		cgenre:   controller.NewGenre(env),
+		cyear:    controller.NewYear(env),
+		cdup:     controller.NewDuplicate(env),
+		cstats:   controller.NewStats(env),
+		clib:     controller.NewLibrary(env),
+		cbook:    controller.NewBook(env),
+		cfeed:    controller.NewFeed(env),
+		cbrowse:  controller.NewBrowse(env),
+		cqueue:   controller.NewQueue(env),
+		cscan:    controller.NewScan(env, sc),
 		ccontent: controller.NewContent(env),
+		cplist:   controller.NewPlaylist(env),
 	}
 
 	w.establishRoutes()
@@ -105,11 +135,327 @@ func (self *Webserver) establishRoutes() {
 			self.calbum.Show(w, r)
 		}).Methods("GET").Name("album")
 
+	self.env.Router.HandleFunc("/album/{id:[0-9]+}/download",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.calbum.Download(w, r)
+		}).Methods("GET").Name("album_download")
+
+	self.env.Router.HandleFunc("/track",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.Index(w, r)
+		}).Methods("GET").Name("track_base")
+
+	self.env.Router.HandleFunc("/track/{listing:[a-z_]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.Stats(w, r)
+		}).Methods("GET").Name("track_stats")
+
+	self.env.Router.HandleFunc("/genre",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cgenre.Index(w, r)
+		}).Methods("GET").Name("genre_base")
+
+	self.env.Router.HandleFunc("/genre/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cgenre.Show(w, r)
+		}).Methods("GET").Name("genre")
+
+	self.env.Router.HandleFunc("/year",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cyear.Index(w, r)
+		}).Methods("GET").Name("year_base")
+
+	self.env.Router.HandleFunc("/decade",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cyear.Decades(w, r)
+		}).Methods("GET").Name("decade_base")
+
+	self.env.Router.HandleFunc("/duplicates",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cdup.Index(w, r)
+		}).Methods("GET").Name("duplicate_base")
+
+	self.env.Router.HandleFunc("/stats",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cstats.Index(w, r)
+		}).Methods("GET").Name("stats")
+
+	self.env.Router.HandleFunc("/scans",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.Index(w, r)
+		}).Methods("GET").Name("scan_base")
+
+	self.env.Router.HandleFunc("/scans/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.Show(w, r)
+		}).Methods("GET").Name("scan")
+
+	self.env.Router.HandleFunc("/books",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.Index(w, r)
+		}).Methods("GET").Name("book_base")
+
+	self.env.Router.HandleFunc("/books/continue",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.Continue(w, r)
+		}).Methods("GET").Name("book_continue")
+
+	self.env.Router.HandleFunc("/books/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.Show(w, r)
+		}).Methods("GET").Name("book")
+
+	self.env.Router.HandleFunc("/playlist",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.Index(w, r)
+		}).Methods("GET").Name("playlist_base")
+
+	self.env.Router.HandleFunc("/playlist/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.Show(w, r)
+		}).Methods("GET").Name("playlist")
+
+	self.env.Router.HandleFunc("/playlist/{id:[0-9]+}/download",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.Download(w, r)
+		}).Methods("GET").Name("playlist_download")
+
+	self.env.Router.HandleFunc("/browse",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbrowse.Show(w, r)
+		}).Methods("GET").Name("browse_base")
+
+	self.env.Router.HandleFunc("/browse/{path:.+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbrowse.Show(w, r)
+		}).Methods("GET").Name("browse")
+
+	self.env.Router.HandleFunc("/feed/album/{id:[0-9]+}.xml",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cfeed.Album(w, r)
+		}).Methods("GET").Name("feed_album")
+
+	self.env.Router.HandleFunc("/feed/playlist/{id:[0-9]+}.xml",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cfeed.Playlist(w, r)
+		}).Methods("GET").Name("feed_playlist")
+
 	self.env.Router.HandleFunc("/content/{id:[0-9]+}/{filename}",
 		func(w http.ResponseWriter, r *http.Request) {
 			self.ccontent.Show(w, r)
 		}).Methods("GET").Name("content")
 
+	// JSON API
+	self.env.Router.HandleFunc("/api/v1/artist",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cartist.APIIndex(w, r)
+		}).Methods("GET").Name("api_artist_base")
+
+	self.env.Router.HandleFunc("/api/v1/artist/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cartist.APIShow(w, r)
+		}).Methods("GET").Name("api_artist")
+
+	self.env.Router.HandleFunc("/api/v1/album",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.calbum.APIIndex(w, r)
+		}).Methods("GET").Name("api_album_base")
+
+	self.env.Router.HandleFunc("/api/v1/album/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.calbum.APIShow(w, r)
+		}).Methods("GET").Name("api_album")
+
+	self.env.Router.HandleFunc("/api/v1/track",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.APIIndex(w, r)
+		}).Methods("GET").Name("api_track")
+
+	self.env.Router.HandleFunc("/api/v1/track/{listing:[a-z_]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.APIStats(w, r)
+		}).Methods("GET").Name("api_track_stats")
+
+	self.env.Router.HandleFunc("/api/v1/track/{id:[0-9]+}/scrobble",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.Scrobble(w, r)
+		}).Methods("POST").Name("api_track_scrobble")
+
+	self.env.Router.HandleFunc("/api/v1/track/{id:[0-9]+}/rating",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.Rate(w, r)
+		}).Methods("PUT", "POST").Name("api_track_rating")
+
+	self.env.Router.HandleFunc("/api/v1/track/{id:[0-9]+}/position",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.ctrack.Position(w, r)
+		}).Methods("PUT", "POST").Name("api_track_position")
+
+	self.env.Router.HandleFunc("/api/v1/genre",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cgenre.APIIndex(w, r)
+		}).Methods("GET").Name("api_genre_base")
+
+	self.env.Router.HandleFunc("/api/v1/genre/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cgenre.APIShow(w, r)
+		}).Methods("GET").Name("api_genre")
+
+	self.env.Router.HandleFunc("/api/v1/year",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cyear.APIIndex(w, r)
+		}).Methods("GET").Name("api_year_base")
+
+	self.env.Router.HandleFunc("/api/v1/decade",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cyear.APIDecades(w, r)
+		}).Methods("GET").Name("api_decade_base")
+
+	self.env.Router.HandleFunc("/api/v1/duplicates",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cdup.APIIndex(w, r)
+		}).Methods("GET").Name("api_duplicate_base")
+
+	self.env.Router.HandleFunc("/api/v1/playlist",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APIIndex(w, r)
+		}).Methods("GET").Name("api_playlist_base")
+
+	self.env.Router.HandleFunc("/api/v1/playlist",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APICreate(w, r)
+		}).Methods("POST").Name("api_playlist_create")
+
+	self.env.Router.HandleFunc("/api/v1/playlist/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APIShow(w, r)
+		}).Methods("GET").Name("api_playlist")
+
+	self.env.Router.HandleFunc("/api/v1/playlist/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APIDelete(w, r)
+		}).Methods("DELETE").Name("api_playlist_delete")
+
+	self.env.Router.HandleFunc("/api/v1/playlist/{id:[0-9]+}/track/{track:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APIAddTrack(w, r)
+		}).Methods("POST").Name("api_playlist_track_add")
+
+	self.env.Router.HandleFunc("/api/v1/playlist/{id:[0-9]+}/track/{position:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cplist.APIRemoveTrack(w, r)
+		}).Methods("DELETE").Name("api_playlist_track_remove")
+
+	self.env.Router.HandleFunc("/api/v1/stats",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cstats.APIIndex(w, r)
+		}).Methods("GET").Name("api_stats")
+
+	self.env.Router.HandleFunc("/api/v1/library",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.clib.APIIndex(w, r)
+		}).Methods("GET").Name("api_library_base")
+
+	self.env.Router.HandleFunc("/api/v1/book",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.APIIndex(w, r)
+		}).Methods("GET").Name("api_book_base")
+
+	self.env.Router.HandleFunc("/api/v1/book/continue",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.APIContinue(w, r)
+		}).Methods("GET").Name("api_book_continue")
+
+	self.env.Router.HandleFunc("/api/v1/book/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbook.APIShow(w, r)
+		}).Methods("GET").Name("api_book")
+
+	self.env.Router.HandleFunc("/api/v1/queue",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIShow(w, r)
+		}).Methods("GET").Name("api_queue")
+
+	self.env.Router.HandleFunc("/api/v1/queue",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIClear(w, r)
+		}).Methods("DELETE").Name("api_queue_clear")
+
+	self.env.Router.HandleFunc("/api/v1/queue/{kind:album|playlist|track}/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIAdd(w, r)
+		}).Methods("POST").Name("api_queue_add")
+
+	self.env.Router.HandleFunc("/api/v1/queue/browse/{path:.+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIAddFolder(w, r)
+		}).Methods("POST").Name("api_queue_browse")
+
+	self.env.Router.HandleFunc("/api/v1/queue/next",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APINext(w, r)
+		}).Methods("POST").Name("api_queue_next")
+
+	self.env.Router.HandleFunc("/api/v1/queue/previous",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIPrevious(w, r)
+		}).Methods("POST").Name("api_queue_previous")
+
+	self.env.Router.HandleFunc("/api/v1/queue/position",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIJump(w, r)
+		}).Methods("PUT", "POST").Name("api_queue_position")
+
+	self.env.Router.HandleFunc("/api/v1/queue/shuffle",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIShuffle(w, r)
+		}).Methods("PUT", "POST").Name("api_queue_shuffle")
+
+	self.env.Router.HandleFunc("/api/v1/queue/repeat",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cqueue.APIRepeat(w, r)
+		}).Methods("PUT", "POST").Name("api_queue_repeat")
+
+	self.env.Router.HandleFunc("/api/v1/browse",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbrowse.APIShow(w, r)
+		}).Methods("GET").Name("api_browse_base")
+
+	self.env.Router.HandleFunc("/api/v1/browse/{path:.+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cbrowse.APIShow(w, r)
+		}).Methods("GET").Name("api_browse")
+
+	self.env.Router.HandleFunc("/api/v1/scan",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APIIndex(w, r)
+		}).Methods("GET").Name("api_scan_base")
+
+	self.env.Router.HandleFunc("/api/v1/scan",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APIStart(w, r)
+		}).Methods("POST").Name("api_scan_start")
+
+	self.env.Router.HandleFunc("/api/v1/scan/current",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APIProgress(w, r)
+		}).Methods("GET").Name("api_scan_current")
+
+	self.env.Router.HandleFunc("/api/v1/scan/current",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APICancel(w, r)
+		}).Methods("DELETE").Name("api_scan_cancel")
+
+	self.env.Router.HandleFunc("/api/v1/scan/current/events",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APIEvents(w, r)
+		}).Methods("GET").Name("api_scan_events")
+
+	self.env.Router.HandleFunc("/api/v1/scan/{id:[0-9]+}",
+		func(w http.ResponseWriter, r *http.Request) {
+			self.cscan.APIShow(w, r)
+		}).Methods("GET").Name("api_scan")
+
 	// Just serve the assets.
 	http.Handle("/assets/",
 		http.StripPrefix("/assets/", http.FileServer(http.Dir(assetsPath))))
@@ -0,0 +1,77 @@
+// Plays the parts of a book on the book page and reports the position to the
+// API, so listening is resumed there later.
+(function() {
+	var api = '/api/v1/track/';
+
+	// the token the page was requested with is passed on to the API
+	var token = /[?&]token=([^&]*)/.exec(window.location.search);
+	var query = token ? '&token=' + token[1] : '';
+
+	var player = document.getElementById('book-player');
+	var audio = player.getElementsByTagName('audio')[0];
+	var status = document.getElementById('book-status');
+	var parts = document.getElementsByClassName('book-part');
+
+	// seconds between reports while playing
+	var interval = 15;
+
+	var track = player.getAttribute('data-track');
+	var reported = 0;
+
+	function play(link, start) {
+		track = link.getAttribute('data-track');
+		audio.src = link.href;
+		audio.addEventListener('loadedmetadata', function seek() {
+			audio.removeEventListener('loadedmetadata', seek);
+			audio.currentTime = start / 1000;
+		});
+		audio.play();
+	}
+
+	function report() {
+		if (!track) {
+			return;
+		}
+
+		reported = audio.currentTime;
+
+		var xhr = new XMLHttpRequest();
+		xhr.open('POST', api + track + '/position?position=' +
+			Math.floor(audio.currentTime * 1000) + query);
+		xhr.onload = function() {
+			// anonymous listeners can't save positions
+			if (xhr.status >= 400 && xhr.status != 401) {
+				status.innerHTML = xhr.responseText;
+			}
+		};
+		xhr.send();
+	}
+
+	for (var i = 0; i < parts.length; i++) {
+		parts[i].addEventListener('click', function(e) {
+			e.preventDefault();
+			play(this, this.getAttribute('data-start') || 0);
+		});
+	}
+
+	audio.addEventListener('timeupdate', function() {
+		if (Math.abs(audio.currentTime - reported) >= interval) {
+			report();
+		}
+	});
+	audio.addEventListener('pause', report);
+
+	// resume at the bookmark or start with the first part
+	for (var i = 0; i < parts.length; i++) {
+		if (!track || parts[i].getAttribute('data-track') == track) {
+			track = parts[i].getAttribute('data-track');
+			audio.src = parts[i].href;
+			audio.addEventListener('loadedmetadata', function seek() {
+				audio.removeEventListener('loadedmetadata', seek);
+				audio.currentTime =
+					(player.getAttribute('data-position') || 0) / 1000;
+			});
+			break;
+		}
+	}
+})();
@@ -0,0 +1,197 @@
+// Plays the queue of the user in the player bar. Pages linked by js-pjax links
+// are loaded into the content of the page, so playback continues while
+// browsing. Links with the class js-queue change the queue.
+(function() {
+	var api = '/api/v1/queue';
+
+	// the token the page was requested with is passed on to the API
+	var token = /[?&]token=([^&]*)/.exec(window.location.search);
+	var query = token ? 'token=' + token[1] : '';
+
+	var bar = document.getElementById('player');
+	var audio = document.getElementById('player-audio');
+	var title = document.getElementById('player-title');
+	var play = document.getElementById('player-play');
+	var shuffle = document.getElementById('player-shuffle');
+	var repeat = document.getElementById('player-repeat');
+	var content = document.getElementById('content');
+
+	// the queue as served last
+	var state = null;
+
+	// repeat modes in the order they are switched through
+	var repeats = {off: 'all', all: 'one', one: 'off'};
+
+	function request(method, url) {
+		if (query) {
+			url += (url.indexOf('?') < 0 ? '?' : '&') + query;
+		}
+
+		var xhr = new XMLHttpRequest();
+		xhr.open(method, url);
+		xhr.onload = function() {
+			if (xhr.status == 200) {
+				show(JSON.parse(xhr.responseText));
+			} else if (xhr.status != 401) {
+				// anonymous listeners have no queue
+				bar.style.display = '';
+				title.textContent = xhr.responseText;
+			}
+		};
+		xhr.send();
+	}
+
+	function show(s) {
+		var changed = !state || !state.current || !s.current ||
+			state.current.id != s.current.id;
+
+		state = s;
+		bar.style.display = '';
+
+		shuffle.className = s.shuffle ? 'btn active' : 'btn';
+		repeat.className = s.repeat != 'off' ? 'btn active' : 'btn';
+		repeat.getElementsByTagName('span')[0].textContent = s.repeat;
+
+		if (!s.current) {
+			title.textContent = 'The queue is empty.';
+			audio.pause();
+			audio.removeAttribute('src');
+			return;
+		}
+
+		title.textContent = (s.position + 1) + '/' + s.tracks.length + ' ' +
+			s.current.artist + ' - ' + s.current.title;
+
+		if (changed) {
+			audio.src = s.current.link;
+		}
+
+		if (s.play) {
+			// repeated tracks start over
+			if (!changed) {
+				audio.currentTime = 0;
+			}
+			audio.play();
+		}
+	}
+
+	// load loads the page at url into the content. Pages that can't be loaded
+	// are opened as usual.
+	function load(url, push) {
+		var xhr = new XMLHttpRequest();
+		xhr.open('GET', url);
+		xhr.responseType = 'document';
+		xhr.onload = function() {
+			var page = xhr.response;
+			var loaded = page && page.getElementById('content');
+
+			if (xhr.status != 200 || !loaded) {
+				window.location = url;
+				return;
+			}
+
+			content.innerHTML = loaded.innerHTML;
+			document.title = page.title;
+
+			// scripts inserted as HTML don't run
+			var scripts = content.getElementsByTagName('script');
+			for (var i = 0; i < scripts.length; i++) {
+				var script = document.createElement('script');
+				if (scripts[i].src) {
+					script.src = scripts[i].src;
+				} else {
+					script.text = scripts[i].text;
+				}
+				scripts[i].parentNode.replaceChild(script, scripts[i]);
+			}
+
+			if (push) {
+				history.pushState({pjax: true}, page.title, url);
+				window.scrollTo(0, 0);
+			}
+		};
+		xhr.onerror = function() {
+			window.location = url;
+		};
+		xhr.send();
+	}
+
+	// closest returns the link el is part of, if it has the class name.
+	function closest(el, name) {
+		for (; el && el.tagName; el = el.parentNode) {
+			if (el.tagName == 'A') {
+				return (' ' + el.className + ' ').indexOf(' ' + name + ' ') >= 0 ?
+					el : null;
+			}
+		}
+
+		return null;
+	}
+
+	document.addEventListener('click', function(e) {
+		if (e.button != 0 || e.ctrlKey || e.metaKey || e.shiftKey) {
+			return;
+		}
+
+		var link = closest(e.target, 'js-queue');
+		if (link) {
+			e.preventDefault();
+			request('POST', link.getAttribute('href'));
+			return;
+		}
+
+		link = closest(e.target, 'js-pjax');
+		if (link && link.host == window.location.host) {
+			e.preventDefault();
+			load(link.href, true);
+		}
+	});
+
+	window.addEventListener('popstate', function(e) {
+		if (e.state && e.state.pjax) {
+			load(window.location.href, false);
+		}
+	});
+	history.replaceState({pjax: true}, document.title);
+
+	play.addEventListener('click', function() {
+		if (!audio.getAttribute('src')) {
+			return;
+		}
+
+		if (audio.paused) {
+			audio.play();
+		} else {
+			audio.pause();
+		}
+	});
+
+	document.getElementById('player-previous').addEventListener('click',
+		function() {
+			request('POST', api + '/previous');
+		});
+	document.getElementById('player-next').addEventListener('click',
+		function() {
+			request('POST', api + '/next');
+		});
+
+	shuffle.addEventListener('click', function() {
+		request('PUT', api + '/shuffle?shuffle=' + !(state && state.shuffle));
+	});
+	repeat.addEventListener('click', function() {
+		request('PUT', api + '/repeat?repeat=' +
+			repeats[state ? state.repeat : 'off']);
+	});
+
+	audio.addEventListener('ended', function() {
+		request('POST', api + '/next?ended');
+	});
+	audio.addEventListener('play', function() {
+		play.innerHTML = '<i class="icon-pause"></i>';
+	});
+	audio.addEventListener('pause', function() {
+		play.innerHTML = '<i class="icon-play"></i>';
+	});
+
+	request('GET', api);
+})();
@@ -0,0 +1,101 @@
+// Starts, cancels and shows the progress of rescans of the library on the
+// scans page.
+(function() {
+	var api = '/api/v1/scan';
+
+	// the token the page was requested with is passed on to the API
+	var token = /[?&]token=([^&]*)/.exec(window.location.search);
+	var query = token ? '?token=' + token[1] : '';
+
+	var start = document.getElementById('rescan-start');
+	var cancel = document.getElementById('rescan-cancel');
+	var progress = document.getElementById('rescan-progress');
+
+	function show(p) {
+		start.disabled = p.running;
+		cancel.disabled = !p.running || p.cancelled;
+
+		if (!p.started) {
+			progress.innerHTML = '';
+			return;
+		}
+
+		var text = p.seen + ' files seen, ' + p.added + ' added, ' +
+			p.updated + ' updated, ' + p.skipped + ' skipped, ' + p.errors +
+			' errors';
+
+		if (p.running) {
+			text += p.cancelled ? ' (cancelling)' : '';
+			text += '<br />' + escape(p.current);
+		} else if (p.error) {
+			text += '<br />Failed: ' + escape(p.error);
+		} else if (p.cancelled) {
+			text += '<br />Cancelled.';
+		} else {
+			text += '<br />Finished. <a href="">Reload</a>';
+		}
+
+		progress.innerHTML = text;
+	}
+
+	function escape(s) {
+		return s.replace(/&/g, '&amp;').replace(/</g, '&lt;')
+			.replace(/>/g, '&gt;');
+	}
+
+	function request(method, url, done) {
+		var xhr = new XMLHttpRequest();
+		xhr.open(method, url + query);
+		xhr.onload = function() {
+			if (xhr.status >= 400) {
+				progress.innerHTML = escape(xhr.responseText);
+				return;
+			}
+			if (done) {
+				done(xhr.responseText ? JSON.parse(xhr.responseText) : null);
+			}
+		};
+		xhr.send();
+	}
+
+	// follow follows the progress of the running scan. Browsers without
+	// Server-Sent Events poll the progress instead.
+	function follow() {
+		if (!window.EventSource) {
+			request('GET', api + '/current', function(p) {
+				show(p);
+				if (p.running) {
+					window.setTimeout(follow, 1000);
+				}
+			});
+			return;
+		}
+
+		var events = new EventSource(api + '/current/events' + query);
+		events.addEventListener('progress', function(e) {
+			var p = JSON.parse(e.data);
+			show(p);
+			if (!p.running) {
+				events.close();
+			}
+		});
+	}
+
+	start.onclick = function() {
+		request('POST', api, function(p) {
+			show(p);
+			follow();
+		});
+	};
+
+	cancel.onclick = function() {
+		request('DELETE', api + '/current');
+	};
+
+	request('GET', api + '/current', function(p) {
+		show(p);
+		if (p.running) {
+			follow();
+		}
+	});
+})();
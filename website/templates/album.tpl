@@ -1,12 +1,17 @@
 {{define "content"}}
-<a href="{{.Page.BackLink}}" class="btn">
+<a href="{{.Page.BackLink}}" class="btn js-pjax">
 	<i class="icon-chevron-left"></i> Back to artist
 </a>
 
-<link href="/assets/widgets/360-player/360player.css" rel="stylesheet" />
-
 <h1 class="album-title">{{.Album.Name}}</h1>
 
+<p>
+	<a href="/api/v1/queue/album/{{.Album.Id}}?play" class="btn btn-mini js-queue"><i class="icon-play"></i> Play</a>
+	<a href="/api/v1/queue/album/{{.Album.Id}}" class="btn btn-mini js-queue"><i class="icon-plus"></i> Add to queue</a>
+	<a href="{{.DownloadLink}}" class="btn btn-mini"><i class="icon-download-alt"></i> Download</a>
+	<a href="{{.FeedLink}}" class="btn btn-mini"><i class="icon-music"></i> Podcast feed</a>
+</p>
+
 <div class="table-album">
 	<table class="table table-condensed table-striped">
 		<thead>
@@ -14,19 +19,18 @@
 				<th></th>
 				<th>Artist</th>
 				<th>Album</th>
-				<th>Title</th>
-				<th>Track</th>
-				<th>Year</th>
-				<th>Length</th>
+				<th><a href="{{.SortLinks.name}}">Title</a></th>
+				<th><a href="{{.SortLinks.tracknumber}}">Track</a></th>
+				<th><a href="{{.SortLinks.year}}">Year</a></th>
+				<th><a href="{{.SortLinks.duration}}">Length</a></th>
 			</tr>
 		</thead>
 		<tbody>
 			{{range .Tracks}}
 				<tr>
 					<td>
-						<div class="sm2-inline-list ui360">
-							<a href="{{.Link}}" title="Play"></a>
-						</div>
+						<a href="/api/v1/queue/track/{{.Id}}?play" class="btn btn-mini js-queue" title="Play"><i class="icon-play"></i></a>
+						<a href="/api/v1/queue/track/{{.Id}}" class="btn btn-mini js-queue" title="Add to queue"><i class="icon-plus"></i></a>
 					</td>
 					<td>{{.Artist}}</td>
 					<td>{{.Album}}</td>
@@ -44,10 +48,5 @@
 	</table>
 </div>
 
-<!--/ Placed at the end of the document so the pages load faster -->
-<script src="/assets/js/SoundManager2/soundmanager2-nodebug-jsmin.js"></script> 
-<script src="/assets/js/soundmanager-settings.js"></script>
-
-<script src="/assets/widgets/360-player/script/berniecode-animator.js"></script>
-<script src="/assets/widgets/360-player/script/360player.js"></script>
+{{template "pager" .NumberPager}}
 {{end}}
@@ -1,20 +1,32 @@
 {{define "content"}}
 <h1>Albums</h1>
 
+{{template "filter" .Filter}}
+
 <div class="table-albums">
 	<table class="table table-condensed table-striped">
 		<thead>
 			<tr>
-				<th>Album</th>
+				<th><a href="{{.SortLinks.name}}">Album</a></th>
+				<th><a href="{{.SortLinks.artist}}">Artist</a></th>
+				<th><a href="{{.SortLinks.year}}">Year</a></th>
+				<th><a href="{{.SortLinks.duration}}">Length</a></th>
 			</tr>
 		</thead>
 		<tbody>
 			{{range .Albums}}
 				<tr>
-					<td><a href="{{.Path}}">{{.Album.Name}}</a></td>
+					<td><a href="{{.Link}}" class="js-pjax">{{.Name}}</a></td>
+					<td>{{.Artist}}</td>
+					<td>{{if .Year}}{{.Year}}{{end}}</td>
+					<td>{{.LengthString}}</td>
 				</tr>
+			{{else}}
+				<tr><td colspan="4">No albums in database.</td></tr>
 			{{end}}
 		</tbody>
 	</table>
 </div>
+
+{{template "pager" .NumberPager}}
 {{end}}
@@ -27,4 +27,6 @@
 		</tbody>
 	</table>
 </div>
+
+{{template "pager" .NumberPager}}
 {{end}}
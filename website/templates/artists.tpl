@@ -31,4 +31,6 @@
 		</tbody>
 	</table>
 </div>
+
+{{template "pager" .NumberPager}}
 {{end}}
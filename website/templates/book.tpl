@@ -0,0 +1,40 @@
+{{define "content"}}
+<a href="{{.Page.BackLink}}" class="btn">
+	<i class="icon-chevron-left"></i> Back to audiobooks
+</a>
+
+<h1>{{.Book.Title}}</h1>
+<p>{{.Book.Author}} &middot; {{.Book.LengthString}}</p>
+
+<div id="book-player"{{with .Bookmark}} data-track="{{.TrackID}}" data-position="{{.Position}}"{{end}}>
+	<audio controls="controls" preload="none"></audio>
+	<p id="book-status">{{if .Bookmark}}Resumes where you stopped listening.{{end}}</p>
+</div>
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Part</th>
+			<th>Chapters</th>
+			<th>Length</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range $part := .Parts}}
+			<tr>
+				<td><a href="{{.Link}}" class="book-part" data-track="{{.Id}}">{{.Title}}</a></td>
+				<td>
+					{{range .Chapters}}
+						<a href="{{$part.Link}}" class="book-part" data-track="{{$part.Id}}" data-start="{{.Start}}">{{.Title}}</a><br />
+					{{end}}
+				</td>
+				<td>{{.LengthString}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="3">Book has no parts.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+
+<script src="/assets/js/book.js"></script>
+{{end}}
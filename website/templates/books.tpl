@@ -0,0 +1,40 @@
+{{define "content"}}
+<h1>Audiobooks</h1>
+
+<p><a href="/books/continue" class="btn"><i class="icon-play"></i> Continue listening</a></p>
+
+{{if gt (len .Libraries) 1}}
+<form class="form-inline" method="get">
+	<select name="library" class="input-medium">
+		<option value="">All audiobooks</option>
+		{{range .Libraries}}
+			<option value="{{.Id}}"{{if eq .Id $.Library}} selected="selected"{{end}}>{{.Name}}</option>
+		{{end}}
+	</select>
+	<button type="submit" class="btn">Filter</button>
+</form>
+{{end}}
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Title</th>
+			<th>Author</th>
+			<th>Length</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Books}}
+			<tr>
+				<td><a href="{{.Link}}">{{.Title}}</a></td>
+				<td>{{.Author}}</td>
+				<td>{{.LengthString}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="3">No audiobooks in database.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+
+{{template "pager" .NumberPager}}
+{{end}}
@@ -0,0 +1,79 @@
+{{define "content"}}
+<ul class="breadcrumb">
+	{{range .Folder.Parents}}
+		<li><a href="{{.Link}}" class="js-pjax">{{.Name}}</a> <span class="divider">/</span></li>
+	{{end}}
+	<li class="active">{{.Folder.Name}}</li>
+</ul>
+
+{{if .QueueLink}}
+<p>
+	<a href="{{.QueueLink}}?play" class="btn btn-mini js-queue"><i class="icon-play"></i> Play</a>
+	<a href="{{.QueueLink}}" class="btn btn-mini js-queue"><i class="icon-plus"></i> Add to queue</a>
+	<a href="{{.DownloadLink}}" class="btn btn-mini"><i class="icon-download-alt"></i> Download</a>
+</p>
+{{end}}
+
+{{if .Folder.Folders}}
+<div class="table-folders">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th>Folder</th>
+				<th>Tracks</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Folder.Folders}}
+				<tr>
+					<td><a href="{{.Link}}" class="js-pjax"><i class="icon-folder-close"></i> {{.Name}}</a></td>
+					<td>{{.Tracks}}</td>
+				</tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+{{end}}
+
+{{if .Folder.Tracks}}
+<div class="table-tracks">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th></th>
+				<th>File</th>
+				<th>Artist</th>
+				<th>Album</th>
+				<th>Title</th>
+				<th>Length</th>
+				<th>Format</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Folder.Tracks}}
+				<tr>
+					<td>
+						<a href="/api/v1/queue/track/{{.Id}}?play" class="btn btn-mini js-queue" title="Play"><i class="icon-play"></i></a>
+						<a href="/api/v1/queue/track/{{.Id}}" class="btn btn-mini js-queue" title="Add to queue"><i class="icon-plus"></i></a>
+					</td>
+					<td><a href="{{.Link}}">{{.FileName}}</a></td>
+					<td>{{.Artist}}</td>
+					<td>{{.Album}}</td>
+					<td>{{.Title}}</td>
+					<td>{{.LengthString}}</td>
+					<td>{{.Format}}</td>
+				</tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+{{end}}
+
+{{if .Folder.Tracks}}
+{{template "pager" .NumberPager}}
+{{end}}
+
+{{if not (or .Folder.Folders .Folder.Tracks)}}
+<p>No folders found.</p>
+{{end}}
+{{end}}
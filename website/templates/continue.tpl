@@ -0,0 +1,28 @@
+{{define "content"}}
+<h1>Continue listening</h1>
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Title</th>
+			<th>Author</th>
+			<th>Position</th>
+			<th>Last listened</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Books}}
+			<tr>
+				<td><a href="{{.Link}}">{{.Title}}</a></td>
+				<td>{{.Author}}</td>
+				<td>{{.PositionString}}</td>
+				<td>{{.UpdatedString}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="4">You aren't listening to any book.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+
+{{template "pager" .NumberPager}}
+{{end}}
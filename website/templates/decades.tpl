@@ -0,0 +1,24 @@
+{{define "content"}}
+<h1>Decades</h1>
+
+<div class="decade-table">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th>Decade</th>
+				<th>Albums</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Decades}}
+				<tr>
+					<td><a href="{{.Link}}" class="js-pjax">{{.Decade}}s</a></td>
+					<td>{{.Albums}}</td>
+				</tr>
+			{{else}}
+				<tr><td colspan="2">No albums of known year in database.</td></tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+{{end}}
@@ -0,0 +1,37 @@
+{{define "content"}}
+<h1>Duplicates</h1>
+
+{{range .Groups}}
+	<h3>{{with index .Copies 0}}{{.Artist}} - {{.Title}}{{end}}
+		<small>{{if eq .Reason "content"}}same audio content{{else}}same artist, title and length{{end}}</small>
+	</h3>
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th></th>
+				<th>Path</th>
+				<th>Album</th>
+				<th>Format</th>
+				<th>Bitrate</th>
+				<th>Length</th>
+				<th>Size</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Copies}}
+				<tr{{if .Keep}} class="success"{{end}}>
+					<td>{{if .Keep}}<span class="label label-success">keep</span>{{end}}</td>
+					<td><a href="{{.Link}}">{{.Path}}</a></td>
+					<td>{{.Album}}</td>
+					<td>{{.Format}}</td>
+					<td>{{if .Bitrate}}{{.Bitrate}} kbit/s{{end}}</td>
+					<td>{{.LengthString}}</td>
+					<td>{{.SizeString}}</td>
+				</tr>
+			{{end}}
+		</tbody>
+	</table>
+{{else}}
+	<p>No duplicates found.</p>
+{{end}}
+{{end}}
@@ -0,0 +1,20 @@
+{{define "filter"}}
+<form class="form-inline" method="get">
+	<input type="text" name="genre" class="input-medium" placeholder="Genre" value="{{.Genre}}" />
+	<input type="text" name="year_from" class="input-mini" placeholder="From" value="{{if .YearFrom}}{{.YearFrom}}{{end}}" />
+	<input type="text" name="year_to" class="input-mini" placeholder="To" value="{{if .YearTo}}{{.YearTo}}{{end}}" />
+	<input type="text" name="format" class="input-mini" placeholder="Format" value="{{.Format}}" />
+	{{if gt (len .Choices) 1}}
+		<select name="library" class="input-medium">
+			<option value="">All libraries</option>
+			{{range .Choices}}
+				<option value="{{.Id}}"{{if eq .Id $.Library}} selected="selected"{{end}}>{{.Name}}</option>
+			{{end}}
+		</select>
+	{{end}}
+	{{if .ArtistID}}
+		<input type="hidden" name="artist" value="{{.ArtistID}}" />
+	{{end}}
+	<button type="submit" class="btn">Filter</button>
+</form>
+{{end}}
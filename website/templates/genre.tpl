@@ -0,0 +1,44 @@
+{{define "content"}}
+<a href="{{.Page.BackLink}}" class="btn">
+	<i class="icon-chevron-left"></i> Back to genres
+</a>
+
+<h1 class="genre-title">{{.Genre.Name}}</h1>
+
+<h2>Artists</h2>
+
+<ul class="inline genre-artists">
+	{{range .Artists}}
+		<li><a href="{{.Link}}" class="js-pjax">{{.Name}}</a></li>
+	{{end}}
+</ul>
+
+<h2>Albums</h2>
+
+<div class="table-albums">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th><a href="{{.SortLinks.name}}">Album</a></th>
+				<th><a href="{{.SortLinks.artist}}">Artist</a></th>
+				<th><a href="{{.SortLinks.year}}">Year</a></th>
+				<th><a href="{{.SortLinks.duration}}">Length</a></th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Albums}}
+				<tr>
+					<td><a href="{{.Link}}" class="js-pjax">{{.Name}}</a></td>
+					<td>{{.Artist}}</td>
+					<td>{{if .Year}}{{.Year}}{{end}}</td>
+					<td>{{.LengthString}}</td>
+				</tr>
+			{{else}}
+				<tr><td colspan="4">Genre has no albums.</td></tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+
+{{template "pager" .NumberPager}}
+{{end}}
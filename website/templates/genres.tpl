@@ -0,0 +1,26 @@
+{{define "content"}}
+<h1>Genres</h1>
+
+<div class="genre-table">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th>Genre</th>
+				<th>Tracks</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Genres}}
+				<tr>
+					<td><a href="{{.Link}}" class="js-pjax">{{.Name}}</a></td>
+					<td>{{.Tracks}}</td>
+				</tr>
+			{{else}}
+				<tr><td colspan="2">No genres in database.</td></tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+
+{{template "pager" .NumberPager}}
+{{end}}
@@ -6,7 +6,8 @@
 		<link href="/assets/css/bootstrap.css" rel="stylesheet" />
 		<link href="/assets/css/responsive.css" rel="stylesheet" />
 		<style>
-			body { padding-top: 60px }
+			body { padding-top: 60px; padding-bottom: 60px }
+			#player-title { margin-left: 10px }
 		</style>
 		<!-- HTML5 shim, for IE6-8 support of HTML5 elements -->
 		<!--[if IE 9]>
@@ -22,20 +23,47 @@
 						<span class="icon-bar"></span>
 						<span class="icon-bar"></span>
 					</a>
-					<a class="brand" href="#">musicrawler</a>
+					<a class="brand js-pjax" href="/">musicrawler</a>
 					<div class="nav-collapse">
 						<ul class="nav">
 							<li>
-								<a href="/">Home</a>
+								<a class="js-pjax" href="/">Home</a>
 							</li>
-							<li><a href="/artist">Artists</a></li>
+							<li><a class="js-pjax" href="/artist">Artists</a></li>
+							<li><a class="js-pjax" href="/album">Albums</a></li>
+							<li><a class="js-pjax" href="/track">Tracks</a></li>
+							<li><a class="js-pjax" href="/genre">Genres</a></li>
+							<li><a class="js-pjax" href="/decade">Decades</a></li>
+							<li><a class="js-pjax" href="/track/most_played">Most played</a></li>
+							<li><a class="js-pjax" href="/books">Audiobooks</a></li>
+							<li><a class="js-pjax" href="/playlist">Playlists</a></li>
+							<li><a class="js-pjax" href="/browse">Folders</a></li>
+							<li><a class="js-pjax" href="/stats">Statistics</a></li>
 						</ul>
 					</div>
 				</div>
 			</div>
 		</div>
-		<div class="container">
+		<div class="container" id="content">
 			{{template "content" .}}
 		</div>
+		<div class="navbar navbar-fixed-bottom" id="player" style="display: none">
+			<div class="navbar-inner">
+				<div class="container">
+					<div class="btn-group pull-left">
+						<button class="btn" id="player-previous" title="Previous"><i class="icon-step-backward"></i></button>
+						<button class="btn" id="player-play" title="Play"><i class="icon-play"></i></button>
+						<button class="btn" id="player-next" title="Next"><i class="icon-step-forward"></i></button>
+					</div>
+					<div class="btn-group pull-left">
+						<button class="btn" id="player-shuffle" title="Shuffle"><i class="icon-random"></i></button>
+						<button class="btn" id="player-repeat" title="Repeat"><i class="icon-repeat"></i> <span>off</span></button>
+					</div>
+					<p class="navbar-text pull-left" id="player-title"></p>
+					<audio id="player-audio" preload="none"></audio>
+				</div>
+			</div>
+		</div>
+		<script src="/assets/js/player.js"></script>
 	</body>
 </html>
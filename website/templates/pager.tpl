@@ -0,0 +1,27 @@
+{{define "pager"}}
+{{if .}}
+	{{if gt (len .Pages) 1}}
+		<div class="pagination pagination-centered">
+			<ul>
+				{{if .Prev}}
+					<li><a href="{{.Prev}}" class="js-pjax">&laquo;</a></li>
+				{{else}}
+					<li class="disabled"><span>&laquo;</span></li>
+				{{end}}
+				{{range .Pages}}
+					{{if .Active}}
+						<li class="active"><span>{{.Label}}</span></li>
+					{{else}}
+						<li><a href="{{.Link}}" class="js-pjax">{{.Label}}</a></li>
+					{{end}}
+				{{end}}
+				{{if .Next}}
+					<li><a href="{{.Next}}" class="js-pjax">&raquo;</a></li>
+				{{else}}
+					<li class="disabled"><span>&raquo;</span></li>
+				{{end}}
+			</ul>
+		</div>
+	{{end}}
+{{end}}
+{{end}}
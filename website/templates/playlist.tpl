@@ -0,0 +1,42 @@
+{{define "content"}}
+<a href="{{.Page.BackLink}}" class="btn js-pjax">
+	<i class="icon-chevron-left"></i> Back to playlists
+</a>
+
+<h1>{{.Playlist.Name}}</h1>
+
+<p>
+	<a href="/api/v1/queue/playlist/{{.Playlist.Id}}?play" class="btn btn-mini js-queue"><i class="icon-play"></i> Play</a>
+	<a href="/api/v1/queue/playlist/{{.Playlist.Id}}" class="btn btn-mini js-queue"><i class="icon-plus"></i> Add to queue</a>
+	<a href="{{.DownloadLink}}" class="btn btn-mini"><i class="icon-download-alt"></i> Download</a>
+	<a href="{{.FeedLink}}" class="btn btn-mini"><i class="icon-music"></i> Podcast feed</a>
+</p>
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th></th>
+			<th>Artist</th>
+			<th>Album</th>
+			<th>Title</th>
+			<th>Length</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Tracks}}
+			<tr>
+				<td>
+					<a href="/api/v1/queue/track/{{.Id}}?play" class="btn btn-mini js-queue" title="Play"><i class="icon-play"></i></a>
+					<a href="/api/v1/queue/track/{{.Id}}" class="btn btn-mini js-queue" title="Add to queue"><i class="icon-plus"></i></a>
+				</td>
+				<td>{{.Artist}}</td>
+				<td>{{.Album}}</td>
+				<td><a href="{{.Link}}">{{.Title}}</a></td>
+				<td>{{.LengthString}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="5">Playlist has no tracks.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+{{end}}
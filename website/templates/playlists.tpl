@@ -0,0 +1,20 @@
+{{define "content"}}
+<h1>Playlists</h1>
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Name</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Playlists}}
+			<tr>
+				<td><a href="{{.Link}}" class="js-pjax">{{.Name}}</a></td>
+			</tr>
+		{{else}}
+			<tr><td>No playlists yet.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+{{end}}
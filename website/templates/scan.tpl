@@ -0,0 +1,33 @@
+{{define "content"}}
+{{with .Scan}}
+<h1>Scan {{.StartedString}}{{if .Cancelled}} <small>cancelled</small>{{end}}</h1>
+
+<p>
+	{{range .RootList}}{{.}}<br />{{end}}
+	Duration: {{.Duration}}<br />
+	{{.Added}} added, {{.Updated}} updated, {{.Moved}} moved,
+	{{.Deleted}} deleted, {{.Skipped}} skipped, {{.Errors}} errors
+</p>
+{{end}}
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Path</th>
+			<th>Error</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Errors}}
+			<tr>
+				<td>{{if .Path}}{{.Path}}{{else}}<em>whole scan</em>{{end}}</td>
+				<td>{{.Message}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="2">No errors.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+
+{{template "pager" .NumberPager}}
+{{end}}
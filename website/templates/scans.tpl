@@ -0,0 +1,48 @@
+{{define "content"}}
+<h1>Scans</h1>
+
+<div id="rescan">
+	<p>
+		<button class="btn btn-primary" id="rescan-start">Rescan</button>
+		<button class="btn" id="rescan-cancel" disabled="disabled">Cancel</button>
+	</p>
+	<p id="rescan-progress"></p>
+</div>
+
+<table class="table table-condensed table-striped">
+	<thead>
+		<tr>
+			<th>Started</th>
+			<th>Duration</th>
+			<th>Sources</th>
+			<th>Added</th>
+			<th>Updated</th>
+			<th>Moved</th>
+			<th>Deleted</th>
+			<th>Skipped</th>
+			<th>Errors</th>
+		</tr>
+	</thead>
+	<tbody>
+		{{range .Scans}}
+			<tr>
+				<td><a href="{{.Link}}">{{.StartedString}}</a>{{if .Cancelled}} <span class="label">cancelled</span>{{end}}</td>
+				<td>{{.Duration}}</td>
+				<td>{{range .RootList}}{{.}}<br />{{end}}</td>
+				<td>{{.Added}}</td>
+				<td>{{.Updated}}</td>
+				<td>{{.Moved}}</td>
+				<td>{{.Deleted}}</td>
+				<td>{{.Skipped}}</td>
+				<td>{{if .Errors}}<a href="{{.Link}}">{{.Errors}}</a>{{else}}0{{end}}</td>
+			</tr>
+		{{else}}
+			<tr><td colspan="9">No scans yet.</td></tr>
+		{{end}}
+	</tbody>
+</table>
+
+{{template "pager" .NumberPager}}
+
+<script src="/assets/js/scan.js"></script>
+{{end}}
@@ -0,0 +1,80 @@
+{{define "content"}}
+<h1>Statistics</h1>
+
+{{with .Stats}}
+<table class="table table-condensed">
+	<tbody>
+		<tr><th>Tracks</th><td>{{.Tracks}}</td></tr>
+		<tr><th>Albums</th><td>{{.Albums}}</td></tr>
+		<tr><th>Artists</th><td>{{.Artists}}</td></tr>
+		<tr><th>Total length</th><td>{{.LengthString}}</td></tr>
+		<tr><th>Total size</th><td>{{.SizeString}}</td></tr>
+		<tr><th>Last scan</th><td>
+			{{with .LastScan}}
+				{{.StartedString}} ({{.Duration}}):
+				{{.Added}} added, {{.Updated}} updated, {{.Moved}} moved,
+				{{.Deleted}} deleted, {{.Errors}} errors
+			{{else}}
+				never
+			{{end}}
+		</td></tr>
+	</tbody>
+</table>
+
+<div class="row">
+	<div class="span6">
+		<h2>Largest artists</h2>
+		<table class="table table-condensed table-striped">
+			<thead><tr><th>Artist</th><th>Tracks</th><th>Length</th><th>Size</th></tr></thead>
+			<tbody>
+				{{range .TopArtists}}
+					<tr><td><a href="{{.Link}}">{{.Artist}}</a></td><td>{{.Tracks}}</td><td>{{.LengthString}}</td><td>{{.SizeString}}</td></tr>
+				{{end}}
+			</tbody>
+		</table>
+
+		<h2>Formats</h2>
+		<table class="table table-condensed table-striped">
+			<thead><tr><th>Format</th><th>Tracks</th><th>Length</th><th>Size</th></tr></thead>
+			<tbody>
+				{{range .Formats}}
+					<tr><td>{{.Format}}</td><td>{{.Tracks}}</td><td>{{.LengthString}}</td><td>{{.SizeString}}</td></tr>
+				{{end}}
+			</tbody>
+		</table>
+
+		<h2>Bitrates</h2>
+		<table class="table table-condensed table-striped">
+			<thead><tr><th>Bitrate</th><th>Tracks</th><th>Length</th><th>Size</th></tr></thead>
+			<tbody>
+				{{range .Bitrates}}
+					<tr><td>{{if .Bitrate}}{{.Bitrate}} kbit/s{{else}}unknown{{end}}</td><td>{{.Tracks}}</td><td>{{.LengthString}}</td><td>{{.SizeString}}</td></tr>
+				{{end}}
+			</tbody>
+		</table>
+	</div>
+
+	<div class="span6">
+		<h2>Genres</h2>
+		<table class="table table-condensed table-striped">
+			<thead><tr><th>Genre</th><th>Tracks</th><th>Length</th><th>Size</th></tr></thead>
+			<tbody>
+				{{range .Genres}}
+					<tr><td>{{.Genre}}</td><td>{{.Tracks}}</td><td>{{.LengthString}}</td><td>{{.SizeString}}</td></tr>
+				{{end}}
+			</tbody>
+		</table>
+
+		<h2>Years</h2>
+		<table class="table table-condensed table-striped">
+			<thead><tr><th>Year</th><th>Tracks</th><th>Length</th><th>Size</th></tr></thead>
+			<tbody>
+				{{range .Years}}
+					<tr><td>{{if .Year}}{{.Year}}{{else}}unknown{{end}}</td><td>{{.Tracks}}</td><td>{{.LengthString}}</td><td>{{.SizeString}}</td></tr>
+				{{end}}
+			</tbody>
+		</table>
+	</div>
+</div>
+{{end}}
+{{end}}
@@ -0,0 +1,45 @@
+{{define "content"}}
+<h1>Tracks</h1>
+
+{{template "filter" .Filter}}
+
+<div class="table-tracks">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th></th>
+				<th><a href="{{.SortLinks.artist}}">Artist</a></th>
+				<th><a href="{{.SortLinks.album}}">Album</a></th>
+				<th><a href="{{.SortLinks.name}}">Title</a></th>
+				<th><a href="{{.SortLinks.year}}">Year</a></th>
+				<th><a href="{{.SortLinks.duration}}">Length</a></th>
+				<th>Genre</th>
+				<th>Format</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Tracks}}
+				<tr>
+					<td>
+						<a href="/api/v1/queue/track/{{.Id}}?play" class="btn btn-mini js-queue" title="Play"><i class="icon-play"></i></a>
+						<a href="/api/v1/queue/track/{{.Id}}" class="btn btn-mini js-queue" title="Add to queue"><i class="icon-plus"></i></a>
+					</td>
+					<td>{{.Artist}}</td>
+					<td>{{.Album}}</td>
+					<td><a href="{{.Link}}">{{.Title}}</a></td>
+					<td>{{if .Year}}{{.Year}}{{end}}</td>
+					<td>{{.LengthString}}</td>
+					<td>{{.Genre}}</td>
+					<td>{{.Format}}</td>
+				</tr>
+			{{else}}
+				<tr>
+					<td colspan="8">No tracks found.</td>
+				</tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+
+{{template "pager" .NumberPager}}
+{{end}}
@@ -0,0 +1,45 @@
+{{define "content"}}
+<ul class="nav nav-pills">
+	<li><a href="/track/most_played">Most played</a></li>
+	<li><a href="/track/recently_played">Recently played</a></li>
+	<li><a href="/track/top_rated">Top rated</a></li>
+</ul>
+
+<div class="table-tracks">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th></th>
+				<th><a href="{{.SortLinks.artist}}">Artist</a></th>
+				<th><a href="{{.SortLinks.album}}">Album</a></th>
+				<th><a href="{{.SortLinks.name}}">Title</a></th>
+				<th><a href="{{.SortLinks.plays}}">Plays</a></th>
+				<th><a href="{{.SortLinks.last_played}}">Last played</a></th>
+				<th><a href="{{.SortLinks.rating}}">Rating</a></th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Tracks}}
+				<tr>
+					<td>
+						<a href="/api/v1/queue/track/{{.Id}}?play" class="btn btn-mini js-queue" title="Play"><i class="icon-play"></i></a>
+						<a href="/api/v1/queue/track/{{.Id}}" class="btn btn-mini js-queue" title="Add to queue"><i class="icon-plus"></i></a>
+					</td>
+					<td>{{.Artist}}</td>
+					<td>{{.Album}}</td>
+					<td><a href="{{.Link}}">{{.Title}}</a></td>
+					<td>{{.Plays}}</td>
+					<td>{{.LastPlayedString}}</td>
+					<td>{{.Stars}}</td>
+				</tr>
+			{{else}}
+				<tr>
+					<td colspan="7">No tracks found.</td>
+				</tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+
+{{template "pager" .NumberPager}}
+{{end}}
@@ -0,0 +1,34 @@
+{{define "content"}}
+<h1>Years</h1>
+
+<div class="btn-group" style="margin-bottom: 0.5em">
+	{{range .Pager}}
+		{{if .Active}}
+			<a class="btn btn-primary" href="{{.Link}}">{{.Label}}s</a>
+		{{else}}
+			<a class="btn" href="{{.Link}}">{{.Label}}s</a>
+		{{end}}
+	{{end}}
+</div>
+
+<div class="year-table">
+	<table class="table table-condensed table-striped">
+		<thead>
+			<tr>
+				<th>Year</th>
+				<th>Albums</th>
+			</tr>
+		</thead>
+		<tbody>
+			{{range .Years}}
+				<tr>
+					<td><a href="{{.Link}}" class="js-pjax">{{.Year}}</a></td>
+					<td>{{.Albums}}</td>
+				</tr>
+			{{else}}
+				<tr><td colspan="2">No albums of known year in database.</td></tr>
+			{{end}}
+		</tbody>
+	</table>
+</div>
+{{end}}